@@ -4,9 +4,10 @@ package config
 
 import (
 	"errors"
-	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -18,27 +19,61 @@ const Bright = "brightness"
 const Temp = "temperature"
 const Power = "power"
 
+// AliasSection is the config section mapping user-defined device aliases to serial numbers
+const AliasSection = "aliases"
+
+// SettingsSection is the config section holding settings that apply to every device
+const SettingsSection = "settings"
+
+// Curve is the option selecting the brightness curve, in the settings section or a device section
+const Curve = "curve"
+
+// Calibration options, in the section of a device
+const (
+	TempOffset  = "temp-offset"
+	BrightScale = "bright-scale"
+	TempTable   = "temp-table"
+	BrightTable = "bright-table"
+)
+
+// calibrationOptions lists the options returned by GetCalibration
+var calibrationOptions = []string{TempOffset, BrightScale, TempTable, BrightTable}
+
 // Default implementations
 var defaultFS FileSystem = &DefaultFileSystem{}
 var defaultParserFactory ParserFactory = &DefaultParserFactory{}
 
-// deviceSectionName returns the config section name for a given device index.
-// Index 0 means "all devices" and maps to "current". Index N (1+) maps to "current-N".
-func deviceSectionName(deviceIndex int) string {
-	if deviceIndex == 0 {
+// deviceSectionPrefix prefixes the per-device sections, which are keyed by device identity: the serial
+// number of the light, or its serial number and USB port (serial@port) when the serial number is empty
+// or shared with another light
+const deviceSectionPrefix = "device:"
+
+// deviceSectionName returns the config section name holding the state of a device.
+// An empty identity means "all devices" and maps to "current", otherwise it maps to "device:<id>".
+func deviceSectionName(id string) string {
+	if id == "" {
 		return CurrentProfileName
 	}
-	return fmt.Sprintf("%s-%d", CurrentProfileName, deviceIndex)
+	return deviceSectionPrefix + id
 }
 
-// isDeviceSection returns true if the section name is a per-device section (e.g. "current-1", "current-2").
-func isDeviceSection(name string) bool {
+// legacyDeviceIndex returns the device index of a positional per-device section (e.g. "current-2"),
+// as written by earlier versions before state was keyed by serial number.
+func legacyDeviceIndex(name string) (int, bool) {
 	if !strings.HasPrefix(name, CurrentProfileName+"-") {
-		return false
+		return 0, false
 	}
-	suffix := strings.TrimPrefix(name, CurrentProfileName+"-")
-	_, err := strconv.Atoi(suffix)
-	return err == nil
+	index, err := strconv.Atoi(strings.TrimPrefix(name, CurrentProfileName+"-"))
+	return index, err == nil
+}
+
+// isDeviceSection returns true if the section name is a per-device section (e.g. "device:ABC123", "current-2").
+func isDeviceSection(name string) bool {
+	if strings.HasPrefix(name, deviceSectionPrefix) {
+		return true
+	}
+	_, ok := legacyDeviceIndex(name)
+	return ok
 }
 
 // getConfig loads the config file
@@ -112,10 +147,10 @@ func AddOrUpdateProfile(profileName string, brightness int, temp int, power int)
 }
 
 // UpdateCurrentState updates the temperature, brightness, and/or power for current state.
-// deviceIndex 0 means all devices (uses "current" section), 1+ targets a specific device.
+// An empty id means all devices (uses "current" section), otherwise it targets the device with that identity.
 // set any value to -1 to not set it in the section
-func UpdateCurrentState(deviceIndex int, brightness int, temperature int, power int) {
-	AddOrUpdateProfile(deviceSectionName(deviceIndex), brightness, temperature, power)
+func UpdateCurrentState(id string, brightness int, temperature int, power int) {
+	AddOrUpdateProfile(deviceSectionName(id), brightness, temperature, power)
 }
 
 // DeleteProfile removes a profile from the configuration file
@@ -157,9 +192,93 @@ func ReadProfile(profileName string) (brightness int, temperature int, power int
 }
 
 // Read the current state of the lights from the config file.
-// deviceIndex 0 means all devices (uses "current" section), 1+ targets a specific device.
-func ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
-	return ReadProfile(deviceSectionName(deviceIndex))
+// An empty id means all devices (uses "current" section), otherwise it targets the device with that identity.
+func ReadCurrentState(id string) (brightness int, temperature int, power int) {
+	return ReadProfile(deviceSectionName(id))
+}
+
+// MigrateDeviceSections converts positional "current-N" sections into "device:<id>" sections, where
+// ids lists the identities of the connected devices in enumeration order (index N is ids[N-1]). Existing
+// device sections are not overwritten, in which case the legacy section is dropped. Legacy sections of
+// indices beyond the connected devices are kept, so they are migrated once a device with that index is
+// connected. The config file is only saved if a legacy section was migrated or dropped.
+func MigrateDeviceSections(ids []string) {
+	parser, configFile := getConfigWithDefaults()
+
+	migrated := false
+	for _, section := range parser.Sections() {
+		index, ok := legacyDeviceIndex(section)
+		if !ok || index > len(ids) {
+			continue
+		}
+		migrated = true
+
+		if index >= 1 && !parser.HasSection(deviceSectionName(ids[index-1])) {
+			target := deviceSectionName(ids[index-1])
+			log.Debug().Msgf("Migrating config section %s to %s", section, target)
+			parser.AddSection(target)
+			for _, option := range []string{Bright, Temp, Power} {
+				if value, err := parser.Get(section, option); err == nil {
+					parser.Set(target, option, value)
+				}
+			}
+		}
+		parser.RemoveSection(section)
+	}
+
+	if migrated {
+		parser.SaveWithDelimiter(configFile, "=")
+	}
+}
+
+// MigrateDeviceIdentities copies the settings of lights identified by serial number and USB port from
+// where earlier versions saved them by serial number alone. ids maps the identity of each such light to
+// its serial number. Lights sharing a serial number shared its section, which is copied to each of them,
+// while the calibration of lights without a serial number was saved in the "current" section, which it
+// is moved out of. Existing device sections are not overwritten, and the config file is only saved if
+// something was migrated.
+func MigrateDeviceIdentities(ids map[string]string) {
+	parser, configFile := getConfigWithDefaults()
+
+	migrated := false
+	fromCurrent := false
+	for _, id := range slices.Sorted(maps.Keys(ids)) {
+		target := deviceSectionName(id)
+		if id == "" || parser.HasSection(target) {
+			continue
+		}
+		source := deviceSectionName(ids[id])
+		options := calibrationOptions
+		if ids[id] == "" {
+			fromCurrent = true
+		} else if options, _ = parser.Options(source); len(options) == 0 {
+			continue
+		}
+
+		for _, option := range options {
+			value, err := parser.Get(source, option)
+			if err != nil || value == "" {
+				continue
+			}
+			if !parser.HasSection(target) {
+				log.Debug().Msgf("Migrating config section %s to %s", source, target)
+				parser.AddSection(target)
+			}
+			parser.Set(target, option, value)
+			migrated = true
+		}
+	}
+
+	if fromCurrent {
+		for _, option := range calibrationOptions {
+			if parser.RemoveOption(CurrentProfileName, option) == nil {
+				migrated = true
+			}
+		}
+	}
+	if migrated {
+		parser.SaveWithDelimiter(configFile, "=")
+	}
 }
 
 // Return the list of profile names with "current" being first
@@ -170,7 +289,8 @@ func GetProfileNames() (profiles []string) {
 	profiles = append(profiles, CurrentProfileName)
 
 	for i := 0; i < len(allProfiles); i++ {
-		if allProfiles[i] != CurrentProfileName && !isDeviceSection(allProfiles[i]) {
+		if allProfiles[i] != CurrentProfileName && allProfiles[i] != AliasSection && allProfiles[i] != SettingsSection &&
+			!isDeviceSection(allProfiles[i]) {
 			profiles = append(profiles, allProfiles[i])
 		}
 	}
@@ -178,3 +298,123 @@ func GetProfileNames() (profiles []string) {
 	return profiles
 
 }
+
+// GetCurve returns the name of the brightness curve of the device with the given identity,
+// falling back to the curve set for all devices. An empty id only reads the curve set for all devices.
+// It returns an empty string when no curve is configured.
+func GetCurve(id string) string {
+	parser, _ := getConfigWithDefaults()
+	if id != "" {
+		if curve, err := parser.Get(deviceSectionName(id), Curve); err == nil && curve != "" {
+			return curve
+		}
+	}
+	curve, err := parser.Get(SettingsSection, Curve)
+	if err != nil {
+		return ""
+	}
+	return curve
+}
+
+// SetCurve stores the name of the brightness curve of the device with the given identity, or of
+// all devices for an empty id. An empty curve removes the setting.
+func SetCurve(id string, curve string) {
+	parser, configFile := getConfigWithDefaults()
+	section := SettingsSection
+	if id != "" {
+		section = deviceSectionName(id)
+	}
+	if curve == "" {
+		if err := parser.RemoveOption(section, Curve); err != nil {
+			return
+		}
+	} else {
+		if !parser.HasSection(section) {
+			parser.AddSection(section)
+		}
+		parser.Set(section, Curve, curve)
+	}
+	parser.SaveWithDelimiter(configFile, "=")
+}
+
+// GetCalibration returns the calibration options set for the device with the given identity.
+// Options that are not set are left out.
+func GetCalibration(id string) map[string]string {
+	parser, _ := getConfigWithDefaults()
+	options := make(map[string]string)
+	for _, option := range calibrationOptions {
+		if value, err := parser.Get(deviceSectionName(id), option); err == nil && value != "" {
+			options[option] = value
+		}
+	}
+	return options
+}
+
+// SetCalibration stores calibration options for the device with the given identity.
+// Options with an empty value are removed, and options that are not given are left unchanged.
+func SetCalibration(id string, options map[string]string) {
+	parser, configFile := getConfigWithDefaults()
+	section := deviceSectionName(id)
+	for _, option := range calibrationOptions {
+		value, ok := options[option]
+		switch {
+		case !ok:
+		case value == "":
+			_ = parser.RemoveOption(section, option)
+		default:
+			if !parser.HasSection(section) {
+				parser.AddSection(section)
+			}
+			parser.Set(section, option, value)
+		}
+	}
+	parser.SaveWithDelimiter(configFile, "=")
+}
+
+// SetAlias stores an alias for the device with the given serial number, identity or port:<port>.
+// Aliases are case-insensitive.
+func SetAlias(alias string, serial string) {
+	parser, configFile := getConfigWithDefaults()
+	if !parser.HasSection(AliasSection) {
+		parser.AddSection(AliasSection)
+	}
+	parser.Set(AliasSection, strings.ToLower(alias), serial)
+	parser.SaveWithDelimiter(configFile, "=")
+}
+
+// RemoveAlias deletes an alias, returning false if it was not defined
+func RemoveAlias(alias string) bool {
+	parser, configFile := getConfigWithDefaults()
+	if err := parser.RemoveOption(AliasSection, strings.ToLower(alias)); err != nil {
+		return false
+	}
+	parser.SaveWithDelimiter(configFile, "=")
+	return true
+}
+
+// GetAlias returns the serial number an alias refers to, or an empty string if it is not defined
+func GetAlias(alias string) string {
+	parser, _ := getConfigWithDefaults()
+	serial, err := parser.Get(AliasSection, strings.ToLower(alias))
+	if err != nil {
+		return ""
+	}
+	return serial
+}
+
+// GetAliases returns all defined aliases mapped to their serial numbers
+func GetAliases() map[string]string {
+	parser, _ := getConfigWithDefaults()
+	aliases := make(map[string]string)
+
+	names, err := parser.Options(AliasSection)
+	if err != nil {
+		return aliases
+	}
+	for _, name := range names {
+		if serial, err := parser.Get(AliasSection, name); err == nil {
+			aliases[name] = serial
+		}
+	}
+	return aliases
+}
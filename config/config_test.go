@@ -78,6 +78,19 @@ func (m *MockParser) RemoveSection(section string) {
 	m.Called(section)
 }
 
+func (m *MockParser) Options(section string) ([]string, error) {
+	args := m.Called(section)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockParser) RemoveOption(section, option string) error {
+	args := m.Called(section, option)
+	return args.Error(0)
+}
+
 func (m *MockParser) Sections() []string {
 	args := m.Called()
 	return args.Get(0).([]string)
@@ -302,7 +315,7 @@ func TestUpdateCurrentState(t *testing.T) {
 	mockParser.On("Set", CurrentProfileName, Power, "1").Once()
 	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
 
-	UpdateCurrentState(0, 50, 4000, 1)
+	UpdateCurrentState("", 50, 4000, 1)
 
 	mockFS.AssertExpectations(t)
 	mockParserFactory.AssertExpectations(t)
@@ -437,7 +450,7 @@ func TestReadCurrentState(t *testing.T) {
 	mockParser.On("Get", CurrentProfileName, Temp).Return("4000", nil).Once()
 	mockParser.On("Get", CurrentProfileName, Power).Return("1", nil).Once()
 
-	brightness, temperature, power := ReadCurrentState(0)
+	brightness, temperature, power := ReadCurrentState("")
 	assert.Equal(t, 50, brightness)
 	assert.Equal(t, 4000, temperature)
 	assert.Equal(t, 1, power)
@@ -492,7 +505,7 @@ func TestGetProfileNames(t *testing.T) {
 	mockParser.AssertExpectations(t)
 }
 
-// TestUpdateCurrentStatePerDevice tests UpdateCurrentState with a specific device index
+// TestUpdateCurrentStatePerDevice tests UpdateCurrentState with a specific device serial
 func TestUpdateCurrentStatePerDevice(t *testing.T) {
 	originalFS := defaultFS
 	originalParserFactory := defaultParserFactory
@@ -511,21 +524,21 @@ func TestUpdateCurrentStatePerDevice(t *testing.T) {
 	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
 	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
 
-	mockParser.On("HasSection", "current-1").Return(false).Once()
-	mockParser.On("AddSection", "current-1").Once()
-	mockParser.On("Set", "current-1", Bright, "50").Once()
-	mockParser.On("Set", "current-1", Temp, "4000").Once()
-	mockParser.On("Set", "current-1", Power, "1").Once()
+	mockParser.On("HasSection", "device:ABC123").Return(false).Once()
+	mockParser.On("AddSection", "device:ABC123").Once()
+	mockParser.On("Set", "device:ABC123", Bright, "50").Once()
+	mockParser.On("Set", "device:ABC123", Temp, "4000").Once()
+	mockParser.On("Set", "device:ABC123", Power, "1").Once()
 	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
 
-	UpdateCurrentState(1, 50, 4000, 1)
+	UpdateCurrentState("ABC123", 50, 4000, 1)
 
 	mockFS.AssertExpectations(t)
 	mockParserFactory.AssertExpectations(t)
 	mockParser.AssertExpectations(t)
 }
 
-// TestReadCurrentStatePerDevice tests ReadCurrentState with a specific device index
+// TestReadCurrentStatePerDevice tests ReadCurrentState with a specific device serial
 func TestReadCurrentStatePerDevice(t *testing.T) {
 	originalFS := defaultFS
 	originalParserFactory := defaultParserFactory
@@ -544,11 +557,11 @@ func TestReadCurrentStatePerDevice(t *testing.T) {
 	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
 	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
 
-	mockParser.On("Get", "current-2", Bright).Return("75", nil).Once()
-	mockParser.On("Get", "current-2", Temp).Return("3500", nil).Once()
-	mockParser.On("Get", "current-2", Power).Return("1", nil).Once()
+	mockParser.On("Get", "device:DEF456", Bright).Return("75", nil).Once()
+	mockParser.On("Get", "device:DEF456", Temp).Return("3500", nil).Once()
+	mockParser.On("Get", "device:DEF456", Power).Return("1", nil).Once()
 
-	brightness, temperature, power := ReadCurrentState(2)
+	brightness, temperature, power := ReadCurrentState("DEF456")
 	assert.Equal(t, 75, brightness)
 	assert.Equal(t, 3500, temperature)
 	assert.Equal(t, 1, power)
@@ -558,7 +571,7 @@ func TestReadCurrentStatePerDevice(t *testing.T) {
 	mockParser.AssertExpectations(t)
 }
 
-// TestGetProfileNamesFiltersDeviceSections tests that device sections are filtered from profile names
+// TestGetProfileNamesFiltersDeviceSections tests that device and alias sections are filtered from profile names
 func TestGetProfileNamesFiltersDeviceSections(t *testing.T) {
 	originalFS := defaultFS
 	originalParserFactory := defaultParserFactory
@@ -577,7 +590,7 @@ func TestGetProfileNamesFiltersDeviceSections(t *testing.T) {
 	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
 	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
 
-	mockParser.On("Sections").Return([]string{CurrentProfileName, "current-1", "current-2", "profile1"}).Once()
+	mockParser.On("Sections").Return([]string{CurrentProfileName, "current-1", "device:ABC123", AliasSection, SettingsSection, "profile1"}).Once()
 
 	profiles := GetProfileNames()
 	assert.Equal(t, []string{CurrentProfileName, "profile1"}, profiles)
@@ -596,4 +609,340 @@ func TestIsDeviceSection(t *testing.T) {
 	assert.False(t, isDeviceSection("current-abc"))
 	assert.False(t, isDeviceSection("myprofile"))
 	assert.False(t, isDeviceSection("current-"))
+	assert.True(t, isDeviceSection("device:ABC123"))
+	assert.False(t, isDeviceSection("devices"))
+}
+
+// TestMigrateDeviceSections tests that positional sections are moved to serial sections once
+func TestMigrateDeviceSections(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Times(3)
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Times(3)
+
+	mockParser.On("Sections").Return([]string{CurrentProfileName, "current-1", "current-2", "current-3", "profile1"}).Once()
+
+	// current-1 moves to the first serial
+	mockParser.On("HasSection", "device:ABC123").Return(false).Once()
+	mockParser.On("AddSection", "device:ABC123").Once()
+	mockParser.On("Get", "current-1", Bright).Return("75", nil).Once()
+	mockParser.On("Get", "current-1", Temp).Return("3500", nil).Once()
+	mockParser.On("Get", "current-1", Power).Return("", errors.New("option not found")).Once()
+	mockParser.On("Set", "device:ABC123", Bright, "75").Once()
+	mockParser.On("Set", "device:ABC123", Temp, "3500").Once()
+	mockParser.On("RemoveSection", "current-1").Once()
+
+	// current-2 does not overwrite an existing serial section
+	mockParser.On("HasSection", "device:DEF456").Return(true).Once()
+	mockParser.On("RemoveSection", "current-2").Once()
+
+	// current-3 has no connected device to map to, so it is kept for later
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+
+	MigrateDeviceSections([]string{"ABC123", "DEF456"})
+
+	// Nothing to migrate the second time, so the config file is not saved again
+	mockParser.On("Sections").Return([]string{CurrentProfileName, "current-3", "device:ABC123", "device:DEF456", "profile1"}).Twice()
+	MigrateDeviceSections([]string{"ABC123", "DEF456"})
+
+	// current-3 is migrated once a third device is connected
+	mockParser.On("HasSection", "device:GHI789").Return(false).Once()
+	mockParser.On("AddSection", "device:GHI789").Once()
+	mockParser.On("Get", "current-3", mock.Anything).Return("1", nil).Times(3)
+	mockParser.On("Set", "device:GHI789", mock.Anything, "1").Times(3)
+	mockParser.On("RemoveSection", "current-3").Once()
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+	MigrateDeviceSections([]string{"ABC123", "DEF456", "GHI789"})
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestMigrateDeviceIdentities tests that settings saved by serial number are copied to lights identified
+// by serial number and USB port, and that calibration is moved out of the current section
+func TestMigrateDeviceIdentities(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
+
+	// The light without a serial number gets the calibration saved in the current section
+	mockParser.On("HasSection", "device:@1-2").Return(false).Once()
+	mockParser.On("Get", CurrentProfileName, TempOffset).Return("-150", nil).Once()
+	mockParser.On("Get", CurrentProfileName, mock.Anything).Return("", errors.New("option not found")).Times(3)
+	mockParser.On("HasSection", "device:@1-2").Return(false).Once()
+	mockParser.On("AddSection", "device:@1-2").Once()
+	mockParser.On("Set", "device:@1-2", TempOffset, "-150").Once()
+
+	// Both lights sharing serial number X get its section, unless they have one already
+	mockParser.On("HasSection", "device:X@1-4.1").Return(false).Once()
+	mockParser.On("Options", "device:X").Return([]string{Bright, Curve}, nil).Once()
+	mockParser.On("Get", "device:X", Bright).Return("40", nil).Once()
+	mockParser.On("Get", "device:X", Curve).Return("perceptual", nil).Once()
+	mockParser.On("HasSection", "device:X@1-4.1").Return(false).Once()
+	mockParser.On("AddSection", "device:X@1-4.1").Once()
+	mockParser.On("HasSection", "device:X@1-4.1").Return(true).Once()
+	mockParser.On("Set", "device:X@1-4.1", Bright, "40").Once()
+	mockParser.On("Set", "device:X@1-4.1", Curve, "perceptual").Once()
+	mockParser.On("HasSection", "device:X@1-4.2").Return(true).Once()
+
+	mockParser.On("RemoveOption", CurrentProfileName, TempOffset).Return(nil).Once()
+	mockParser.On("RemoveOption", CurrentProfileName, mock.Anything).Return(errors.New("option not found")).Times(3)
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+
+	MigrateDeviceIdentities(map[string]string{"@1-2": "", "X@1-4.1": "X", "X@1-4.2": "X"})
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestSetAlias tests that aliases are stored lower-cased in the aliases section
+func TestSetAlias(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
+
+	mockParser.On("HasSection", AliasSection).Return(false).Once()
+	mockParser.On("AddSection", AliasSection).Once()
+	mockParser.On("Set", AliasSection, "desk-left", "ABC123").Once()
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+
+	SetAlias("Desk-Left", "ABC123")
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestRemoveAlias tests removing defined and undefined aliases
+func TestRemoveAlias(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Twice()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Twice()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Twice()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Twice()
+
+	mockParser.On("RemoveOption", AliasSection, "desk-left").Return(nil).Once()
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+	mockParser.On("RemoveOption", AliasSection, "missing").Return(errors.New("option not found")).Once()
+
+	assert.True(t, RemoveAlias("desk-left"))
+	assert.False(t, RemoveAlias("missing"))
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestGetAliases tests reading a single alias and the full alias list
+func TestGetAliases(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Times(3)
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Times(3)
+
+	mockParser.On("Get", AliasSection, "desk-left").Return("ABC123", nil).Once()
+	mockParser.On("Get", AliasSection, "missing").Return("", errors.New("option not found")).Once()
+	mockParser.On("Options", AliasSection).Return([]string{"desk-left", "desk-right"}, nil).Once()
+	mockParser.On("Get", AliasSection, "desk-left").Return("ABC123", nil).Once()
+	mockParser.On("Get", AliasSection, "desk-right").Return("DEF456", nil).Once()
+
+	assert.Equal(t, "ABC123", GetAlias("DESK-LEFT"))
+	assert.Equal(t, "", GetAlias("missing"))
+	assert.Equal(t, map[string]string{"desk-left": "ABC123", "desk-right": "DEF456"}, GetAliases())
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestGetCurve tests the curve of a device falls back to the curve of all devices
+func TestGetCurve(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Times(3)
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Times(3)
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Times(3)
+
+	mockParser.On("Get", "device:ABC123", Curve).Return("gamma:2.2", nil).Once()
+	mockParser.On("Get", "device:DEF456", Curve).Return("", errors.New("option not found")).Once()
+	mockParser.On("Get", SettingsSection, Curve).Return("perceptual", nil).Once()
+	mockParser.On("Get", SettingsSection, Curve).Return("", errors.New("section not found")).Once()
+
+	assert.Equal(t, "gamma:2.2", GetCurve("ABC123"))
+	assert.Equal(t, "perceptual", GetCurve("DEF456"))
+	assert.Equal(t, "", GetCurve(""))
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestSetCurve tests setting the curve of all devices and removing the curve of a device
+func TestSetCurve(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Twice()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Twice()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Twice()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Twice()
+
+	mockParser.On("HasSection", SettingsSection).Return(false).Once()
+	mockParser.On("AddSection", SettingsSection).Once()
+	mockParser.On("Set", SettingsSection, Curve, "perceptual").Once()
+	mockParser.On("RemoveOption", "device:ABC123", Curve).Return(nil).Once()
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Twice()
+
+	SetCurve("", "perceptual")
+	SetCurve("ABC123", "")
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestGetCalibration tests reading the calibration options of a device
+func TestGetCalibration(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
+
+	mockParser.On("Get", "device:ABC123", TempOffset).Return("-150", nil).Once()
+	mockParser.On("Get", "device:ABC123", BrightScale).Return("0.9", nil).Once()
+	mockParser.On("Get", "device:ABC123", TempTable).Return("", errors.New("option not found")).Once()
+	mockParser.On("Get", "device:ABC123", BrightTable).Return("", nil).Once()
+
+	assert.Equal(t, map[string]string{TempOffset: "-150", BrightScale: "0.9"}, GetCalibration("ABC123"))
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
+}
+
+// TestSetCalibration tests setting and removing calibration options, leaving the others alone
+func TestSetCalibration(t *testing.T) {
+	originalFS := defaultFS
+	originalParserFactory := defaultParserFactory
+	mockFS := &MockFileSystem{}
+	mockParserFactory := &MockParserFactory{}
+	mockParser := &MockParser{}
+	defaultFS = mockFS
+	defaultParserFactory = mockParserFactory
+	defer func() {
+		defaultFS = originalFS
+		defaultParserFactory = originalParserFactory
+	}()
+
+	mockFS.On("GetEnv", "XDG_CONFIG_HOME").Return("/xdg/config/home").Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd").Return(&MockFileInfo{}, nil).Once()
+	mockFS.On("Stat", "/xdg/config/home/llgd/config").Return(&MockFileInfo{}, nil).Once()
+	mockParserFactory.On("NewConfigParserFromFile", "/xdg/config/home/llgd/config").Return(mockParser, nil).Once()
+
+	mockParser.On("HasSection", "device:ABC123").Return(false).Once()
+	mockParser.On("AddSection", "device:ABC123").Once()
+	mockParser.On("Set", "device:ABC123", TempOffset, "-150").Once()
+	mockParser.On("RemoveOption", "device:ABC123", BrightScale).Return(errors.New("option not found")).Once()
+	mockParser.On("SaveWithDelimiter", "/xdg/config/home/llgd/config", "=").Return(nil).Once()
+
+	SetCalibration("ABC123", map[string]string{TempOffset: "-150", BrightScale: ""})
+
+	mockFS.AssertExpectations(t)
+	mockParserFactory.AssertExpectations(t)
+	mockParser.AssertExpectations(t)
 }
@@ -69,6 +69,14 @@ func (w *ConfigParserWrapper) RemoveSection(section string) {
 	w.parser.RemoveSection(section)
 }
 
+func (w *ConfigParserWrapper) Options(section string) ([]string, error) {
+	return w.parser.Options(section)
+}
+
+func (w *ConfigParserWrapper) RemoveOption(section, option string) error {
+	return w.parser.RemoveOption(section, option)
+}
+
 func (w *ConfigParserWrapper) Sections() []string {
 	return w.parser.Sections()
 }
@@ -21,6 +21,8 @@ type Parser interface {
 	Set(section, option, value string)
 	Get(section, option string) (string, error)
 	RemoveSection(section string)
+	Options(section string) ([]string, error)
+	RemoveOption(section, option string) error
 	Sections() []string
 	SaveWithDelimiter(filename, delimiter string) error
 }
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage device aliases",
+	Long: `Aliases give connected lights stable names that can be passed to --device,
+e.g. 'lcli alias set desk-left ABC123' followed by 'lcli -d desk-left on'.
+Unlike indices, aliases keep pointing at the same light when others are plugged in. Lights without
+a usable serial number can be given an alias for their USB port or their identity shown by
+'lcli devices -v' instead, e.g. 'lcli alias set desk-left port:1-2.3' or 'lcli alias set desk-left ABC123@1-2.3'.`,
+}
+
+var aliasSetCmd = &cobra.Command{
+	Use:   "set <alias> <serial|identity|port:<port>>",
+	Short: "Create or update an alias for the device with the given serial number, identity or USB port",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		if _, err := strconv.Atoi(alias); err == nil || strings.EqualFold(alias, "all") {
+			fmt.Printf("Alias %q is reserved, choose a name that is not a number or \"all\"\n", alias)
+			return nil
+		}
+		libImpl.SetAlias(alias, args[1])
+		return nil
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:     "rm <alias>",
+	Aliases: []string{"remove"},
+	Short:   "Remove an alias",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !libImpl.RemoveAlias(args[0]) {
+			fmt.Printf("No alias named %q\n", args[0])
+		}
+		return nil
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List device aliases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		aliases := libImpl.GetAliases()
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, aliases[name])
+		}
+		return nil
+	},
+}
+
+func init() {
+	aliasCmd.AddCommand(aliasSetCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	rootCmd.AddCommand(aliasCmd)
+}
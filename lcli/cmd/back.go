@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var backZone string
+
+var backCmd = &cobra.Command{
+	Use:   "back",
+	Short: "Control the RGB back light of the Beam LX",
+	Long: `Controls the RGB back light of lights that have one, such as the Beam LX. Without -d every
+light with a back light is updated and the others are left alone.`,
+}
+
+var backOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Turn the back light on",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return libImpl.BackLightOn(deviceIndex)
+	},
+	Args: cobra.NoArgs,
+}
+
+var backOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Turn the back light off",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return libImpl.BackLightOff(deviceIndex)
+	},
+	Args: cobra.NoArgs,
+}
+
+var backBrightCmd = &cobra.Command{
+	Use:   "bright <level>",
+	Short: "Sets the back light brightness level (1-100)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bright, err := strconv.Atoi(args[0])
+		if err != nil || bright < 1 || bright > 100 {
+			fmt.Printf("Brightness must be a value between 1 and 100, not %s\n", args[0])
+			return nil
+		}
+		return libImpl.BackLightBrightness(deviceIndex, bright)
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var backColorCmd = &cobra.Command{
+	Use:   "color <#rrggbb>",
+	Short: "Sets the color of a back light zone",
+	Long: `Sets the color of one zone of the back light, or of every zone with --zone all, e.g.
+'lcli back color --zone all "#ff8800"'. Quote the color or leave out the # so the shell does not
+treat it as a comment.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		color, err := lib.ParseColor(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		zone := lib.AllZones
+		if !strings.EqualFold(backZone, "all") {
+			zone, err = strconv.Atoi(backZone)
+			if err != nil || zone < 1 {
+				fmt.Printf("Zone must be all or a zone number starting at 1, not %s\n", backZone)
+				return nil
+			}
+		}
+		return libImpl.BackLightColor(deviceIndex, zone, color)
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	backColorCmd.Flags().StringVarP(&backZone, "zone", "z", "all", "Zone to color: all or a zone number starting at 1")
+
+	backCmd.AddCommand(backOnCmd)
+	backCmd.AddCommand(backOffCmd)
+	backCmd.AddCommand(backBrightCmd)
+	backCmd.AddCommand(backColorCmd)
+	rootCmd.AddCommand(backCmd)
+}
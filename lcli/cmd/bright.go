@@ -24,6 +24,7 @@ package cmd
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -31,9 +32,19 @@ import (
 // brightCmd represents the bright command
 var brightCmd = &cobra.Command{
 	Use:   "bright",
-	Short: "Sets the brightness level (0-100)",
-	Long:  `Sets the brightness level of all lights. Specify a value level between 0 and 100`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Short: "Sets the brightness level (0-100) or the light output in lumens (e.g. 180lm)",
+	Long: `Sets the brightness level of all lights. Specify a value level between 0 and 100, or a light
+output in lumens such as 180lm, which sets lights of different models to the same output and must be
+within the lumen range of every light (see 'lcli status').`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if value, ok := strings.CutSuffix(strings.ToLower(args[0]), "lm"); ok {
+			lm, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || lm <= 0 {
+				fmt.Printf("Light output must be a positive number of lumens such as 180lm, not %s\n", args[0])
+				return nil
+			}
+			return libImpl.LightLumens(deviceIndex, lm)
+		}
 		bright, err := strconv.Atoi(args[0])
 		if err != nil {
 			bright = -1
@@ -41,8 +52,9 @@ var brightCmd = &cobra.Command{
 		if bright < 0 || bright > 100 {
 			fmt.Printf("Brightness must be a value between 0 and 100, not %s", args[0])
 		} else {
-			libImpl.LightBrightness(deviceIndex, bright)
+			return libImpl.LightBrightness(deviceIndex, bright)
 		}
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
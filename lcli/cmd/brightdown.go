@@ -36,7 +36,7 @@ var brightdownCmd = &cobra.Command{
 
 # Decrement brightness by 5%
 lcli brightdown 5`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if len(args) == 0 {
 			fmt.Printf("Brightness must be specified (0 -100)")
@@ -48,9 +48,10 @@ lcli brightdown 5`,
 			if bright < 0 || bright > 100 {
 				fmt.Printf("Brightness must be a value between 0 and 100, not %s", args[0])
 			} else {
-				libImpl.LightBrightDown(deviceIndex, bright)
+				return libImpl.LightBrightDown(deviceIndex, bright)
 			}
 		}
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
@@ -36,7 +36,7 @@ var brightupCmd = &cobra.Command{
 
 # Increment brightness by 5%
 lcli brightup 5`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if len(args) == 0 {
 			fmt.Printf("Brightness must be specified, and a value between 0 and 100)")
@@ -49,9 +49,10 @@ lcli brightup 5`,
 			if bright < 0 || bright > 100 {
 				fmt.Printf("Brightness must be a value between 0 and 100, not %s", args[0])
 			} else {
-				libImpl.LightBrightUp(deviceIndex, bright)
+				return libImpl.LightBrightUp(deviceIndex, bright)
 			}
 		}
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
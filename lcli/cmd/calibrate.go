@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kharyam/go-litra-driver/config"
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	calibrateTempOffset  int
+	calibrateBrightScale float64
+	calibrateTempTable   string
+	calibrateBrightTable string
+	calibrateReset       bool
+)
+
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Shows or sets the calibration of a light",
+	Long: `Shows or sets the calibration of the light selected with -d, so that lights of different models
+set to the same values match. Temperatures are shifted by --temp-offset Kelvin and the light output is
+multiplied by --bright-scale before they are sent to the light, e.g.
+'lcli calibrate -d 2 --temp-offset -150 --bright-scale 0.9'. Tables of in:out pairs replace the
+offset or scale, e.g. --temp-table 2700:2600,6500:6300 or --bright-table 0:0,50:45,100:90 (in % of
+the light output). An empty value removes a setting and --reset removes them all. Without -d or
+flags the calibration is shown. A light needs a serial number or a known USB port to be calibrated.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := map[string]string{
+			config.TempOffset:  strconv.Itoa(calibrateTempOffset),
+			config.BrightScale: strconv.FormatFloat(calibrateBrightScale, 'f', -1, 64),
+			config.TempTable:   calibrateTempTable,
+			config.BrightTable: calibrateBrightTable,
+		}
+		changes := make(map[string]string)
+		for option, value := range flags {
+			if cmd.Flags().Changed(option) {
+				changes[option] = value
+			}
+		}
+		if calibrateReset {
+			changes = lib.Calibration{}.Options()
+		}
+
+		if deviceIndex == 0 {
+			if len(changes) > 0 {
+				fmt.Println("Calibration is per light, select one with -d")
+				return nil
+			}
+			devices, err := libImpl.ListDevices()
+			for _, d := range devices {
+				printCalibration(d, libImpl.GetCalibration(d.ID))
+			}
+			return err
+		}
+
+		device, err := selectedDevice()
+		if err != nil {
+			return err
+		}
+		options := libImpl.GetCalibration(device.ID)
+		if len(changes) == 0 {
+			printCalibration(device, options)
+			return nil
+		}
+		if !device.HasStableID() {
+			fmt.Printf("Light %d (Litra %s) has no serial number or USB port to save a calibration under\n", device.Index, device.Name)
+			return nil
+		}
+
+		for option, value := range changes {
+			options[option] = value
+		}
+		calibration, err := lib.ParseCalibration(options)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		normalized := calibration.Options()
+		for option := range changes {
+			changes[option] = normalized[option]
+		}
+		libImpl.SetCalibration(device.ID, changes)
+		printCalibration(device, calibration.Options())
+		return nil
+	},
+	Args: cobra.NoArgs,
+}
+
+// printCalibration prints the calibration options of a light
+func printCalibration(device lib.DiscoveredDevice, options map[string]string) {
+	var settings []string
+	for _, option := range []string{config.TempOffset, config.BrightScale, config.TempTable, config.BrightTable} {
+		if options[option] != "" {
+			settings = append(settings, option+" "+options[option])
+		}
+	}
+	if len(settings) == 0 {
+		settings = []string{"not calibrated"}
+	}
+	fmt.Printf("  %d: Litra %s (serial: %s): %s\n", device.Index, device.Name, device.Serial, strings.Join(settings, ", "))
+}
+
+func init() {
+	calibrateCmd.Flags().IntVar(&calibrateTempOffset, config.TempOffset, 0, "Kelvin added to requested temperatures, e.g. -150")
+	calibrateCmd.Flags().Float64Var(&calibrateBrightScale, config.BrightScale, 1, "Multiplier of the light output, e.g. 0.9")
+	calibrateCmd.Flags().StringVar(&calibrateTempTable, config.TempTable, "", "Temperature table of Kelvin in:out pairs, e.g. 2700:2600,6500:6300")
+	calibrateCmd.Flags().StringVar(&calibrateBrightTable, config.BrightTable, "", "Brightness table of output % in:out pairs, e.g. 0:0,50:45,100:90")
+	calibrateCmd.Flags().BoolVar(&calibrateReset, "reset", false, "Remove the calibration of the light")
+	rootCmd.AddCommand(calibrateCmd)
+}
@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/kharyam/go-litra-driver/config"
 	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -17,41 +26,155 @@ func (m *MockLib) ReadCurrentState(deviceIndex int) (brightness int, temperature
 	return args.Int(0), args.Int(1), args.Int(2)
 }
 
-func (m *MockLib) LightOn(deviceIndex int) {
-	m.Called(deviceIndex)
+func (m *MockLib) QueryState(deviceIndex int) (lib.DeviceState, error) {
+	args := m.Called(deviceIndex)
+	return args.Get(0).(lib.DeviceState), args.Error(1)
+}
+
+func (m *MockLib) LightOn(deviceIndex int) error {
+	args := m.Called(deviceIndex)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightOff(deviceIndex int) error {
+	args := m.Called(deviceIndex)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightBrightness(deviceIndex int, level int) error {
+	args := m.Called(deviceIndex, level)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightLumens(deviceIndex int, lm int) error {
+	args := m.Called(deviceIndex, lm)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightBrightDown(deviceIndex int, inc int) error {
+	args := m.Called(deviceIndex, inc)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightBrightUp(deviceIndex int, inc int) error {
+	args := m.Called(deviceIndex, inc)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightTemperature(deviceIndex int, temp uint16) error {
+	args := m.Called(deviceIndex, temp)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightTempDown(deviceIndex int, inc int) error {
+	args := m.Called(deviceIndex, inc)
+	return args.Error(0)
+}
+
+func (m *MockLib) LightTempUp(deviceIndex int, inc int) error {
+	args := m.Called(deviceIndex, inc)
+	return args.Error(0)
+}
+
+func (m *MockLib) BackLightOn(deviceIndex int) error {
+	args := m.Called(deviceIndex)
+	return args.Error(0)
+}
+
+func (m *MockLib) BackLightOff(deviceIndex int) error {
+	args := m.Called(deviceIndex)
+	return args.Error(0)
+}
+
+func (m *MockLib) BackLightBrightness(deviceIndex int, level int) error {
+	args := m.Called(deviceIndex, level)
+	return args.Error(0)
+}
+
+func (m *MockLib) BackLightColor(deviceIndex int, zone int, color lib.Color) error {
+	args := m.Called(deviceIndex, zone, color)
+	return args.Error(0)
 }
 
-func (m *MockLib) LightOff(deviceIndex int) {
-	m.Called(deviceIndex)
+func (m *MockLib) ListDevices() ([]lib.DiscoveredDevice, error) {
+	args := m.Called()
+	return args.Get(0).([]lib.DiscoveredDevice), args.Error(1)
+}
+
+func (m *MockLib) DeviceInfo(deviceIndex int) (lib.DiscoveredDevice, error) {
+	args := m.Called(deviceIndex)
+	return args.Get(0).(lib.DiscoveredDevice), args.Error(1)
 }
 
-func (m *MockLib) LightBrightness(deviceIndex int, level int) {
-	m.Called(deviceIndex, level)
+func (m *MockLib) Transition(ctx context.Context, deviceIndex int, targetBrightness int, targetTemp int, duration time.Duration, easing lib.Easing) error {
+	args := m.Called(ctx, deviceIndex, targetBrightness, targetTemp, duration, easing)
+	return args.Error(0)
 }
 
-func (m *MockLib) LightBrightDown(deviceIndex int, inc int) {
-	m.Called(deviceIndex, inc)
+func (m *MockLib) RunEffect(ctx context.Context, deviceIndex int, effect lib.Effect) error {
+	args := m.Called(ctx, deviceIndex, effect)
+	return args.Error(0)
 }
 
-func (m *MockLib) LightBrightUp(deviceIndex int, inc int) {
-	m.Called(deviceIndex, inc)
+func (m *MockLib) Identify(ctx context.Context, deviceIndex int) error {
+	args := m.Called(ctx, deviceIndex)
+	return args.Error(0)
 }
 
-func (m *MockLib) LightTemperature(deviceIndex int, temp uint16) {
-	m.Called(deviceIndex, temp)
+func (m *MockLib) ResolveDevice(spec string) (int, error) {
+	args := m.Called(spec)
+	return args.Int(0), args.Error(1)
 }
 
-func (m *MockLib) LightTempDown(deviceIndex int, inc int) {
-	m.Called(deviceIndex, inc)
+func (m *MockLib) SetAlias(alias string, serial string) {
+	m.Called(alias, serial)
 }
 
-func (m *MockLib) LightTempUp(deviceIndex int, inc int) {
-	m.Called(deviceIndex, inc)
+func (m *MockLib) RemoveAlias(alias string) bool {
+	args := m.Called(alias)
+	return args.Bool(0)
 }
 
-func (m *MockLib) ListDevices() []lib.DiscoveredDevice {
+func (m *MockLib) GetAliases() map[string]string {
 	args := m.Called()
-	return args.Get(0).([]lib.DiscoveredDevice)
+	return args.Get(0).(map[string]string)
+}
+
+func (m *MockLib) GetCurve(id string) string {
+	args := m.Called(id)
+	return args.String(0)
+}
+
+func (m *MockLib) SetCurve(id string, curve string) {
+	m.Called(id, curve)
+}
+
+func (m *MockLib) GetCalibration(id string) map[string]string {
+	args := m.Called(id)
+	return args.Get(0).(map[string]string)
+}
+
+func (m *MockLib) SetCalibration(id string, options map[string]string) {
+	m.Called(id, options)
+}
+
+func (m *MockLib) SetDryRun(mode lib.DryRun) {
+	m.Called(mode)
+}
+
+func (m *MockLib) SendRaw(deviceIndex int, report []byte) (lib.RawReport, []lib.RawReport, error) {
+	args := m.Called(deviceIndex, report)
+	return args.Get(0).(lib.RawReport), args.Get(1).([]lib.RawReport), args.Error(2)
+}
+
+func (m *MockLib) SendFunction(deviceIndex int, feature protocol.FeatureID, function protocol.Function, params []byte) (lib.RawReport, []lib.RawReport, error) {
+	args := m.Called(deviceIndex, feature, function, params)
+	return args.Get(0).(lib.RawReport), args.Get(1).([]lib.RawReport), args.Error(2)
+}
+
+func (m *MockLib) Replay(ctx context.Context, records []lib.TraceRecord, deviceIndex int, speed float64) error {
+	args := m.Called(ctx, records, deviceIndex, speed)
+	return args.Error(0)
 }
 
 // TestOnCmd_Run tests the Run function of the onCmd.
@@ -66,8 +189,8 @@ func TestOnCmd_Run(t *testing.T) {
 		deviceIndex = originalDeviceIndex
 	}()
 
-	mockLib.On("LightOn", 0).Return().Once()
-	onCmd.Run(onCmd, []string{})
+	mockLib.On("LightOn", 0).Return(nil).Once()
+	assert.NoError(t, onCmd.RunE(onCmd, []string{}))
 	mockLib.AssertExpectations(t)
 }
 
@@ -83,8 +206,8 @@ func TestOnCmd_RunWithDevice(t *testing.T) {
 		deviceIndex = originalDeviceIndex
 	}()
 
-	mockLib.On("LightOn", 2).Return().Once()
-	onCmd.Run(onCmd, []string{})
+	mockLib.On("LightOn", 2).Return(nil).Once()
+	assert.NoError(t, onCmd.RunE(onCmd, []string{}))
 	mockLib.AssertExpectations(t)
 }
 
@@ -100,8 +223,8 @@ func TestOffCmd_Run(t *testing.T) {
 		deviceIndex = originalDeviceIndex
 	}()
 
-	mockLib.On("LightOff", 0).Return().Once()
-	offCmd.Run(offCmd, []string{})
+	mockLib.On("LightOff", 0).Return(nil).Once()
+	assert.NoError(t, offCmd.RunE(offCmd, []string{}))
 	mockLib.AssertExpectations(t)
 }
 
@@ -119,8 +242,8 @@ func TestBrightCmd_Run(t *testing.T) {
 		}()
 
 		level := 50
-		mockLib.On("LightBrightness", 0, level).Return().Once()
-		brightCmd.Run(brightCmd, []string{"50"})
+		mockLib.On("LightBrightness", 0, level).Return(nil).Once()
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"50"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -136,8 +259,8 @@ func TestBrightCmd_Run(t *testing.T) {
 		}()
 
 		invalidLevel := 150
-		mockLib.On("LightBrightness", 0, invalidLevel).Return().Unset()
-		brightCmd.Run(brightCmd, []string{"150"})
+		mockLib.On("LightBrightness", 0, invalidLevel).Return(nil).Unset()
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"150"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -152,7 +275,30 @@ func TestBrightCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		brightCmd.Run(brightCmd, []string{"abc"})
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"abc"}))
+		mockLib.AssertNotCalled(t, "LightBrightness", mock.Anything, mock.Anything)
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("Lumens", func(t *testing.T) {
+		mockLib := new(MockLib)
+		originalLibImpl := libImpl
+		libImpl = mockLib
+		originalDeviceIndex := deviceIndex
+		deviceIndex = 0
+		defer func() {
+			libImpl = originalLibImpl
+			deviceIndex = originalDeviceIndex
+		}()
+
+		mockLib.On("LightLumens", 0, 180).Return(nil).Once()
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"180lm"}))
+		mockLib.On("LightLumens", 0, 300).Return(lib.ErrOutOfRange).Once()
+		assert.ErrorIs(t, brightCmd.RunE(brightCmd, []string{"300LM"}), lib.ErrOutOfRange)
+
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"0lm"}))
+		assert.NoError(t, brightCmd.RunE(brightCmd, []string{"brightlm"}))
+		mockLib.AssertNumberOfCalls(t, "LightLumens", 2)
 		mockLib.AssertNotCalled(t, "LightBrightness", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -172,8 +318,8 @@ func TestBrightDownCmd_Run(t *testing.T) {
 		}()
 
 		inc := 5
-		mockLib.On("LightBrightDown", 0, inc).Return().Once()
-		brightdownCmd.Run(brightdownCmd, []string{"5"})
+		mockLib.On("LightBrightDown", 0, inc).Return(nil).Once()
+		assert.NoError(t, brightdownCmd.RunE(brightdownCmd, []string{"5"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -189,7 +335,7 @@ func TestBrightDownCmd_Run(t *testing.T) {
 		}()
 
 		mockLib.AssertNotCalled(t, "LightBrightDown", mock.Anything, mock.Anything)
-		brightdownCmd.Run(brightdownCmd, []string{})
+		assert.NoError(t, brightdownCmd.RunE(brightdownCmd, []string{}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -205,7 +351,7 @@ func TestBrightDownCmd_Run(t *testing.T) {
 		}()
 
 		mockLib.AssertNotCalled(t, "LightBrightDown", mock.Anything, mock.Anything)
-		brightdownCmd.Run(brightdownCmd, []string{"abc"})
+		assert.NoError(t, brightdownCmd.RunE(brightdownCmd, []string{"abc"}))
 		mockLib.AssertExpectations(t)
 	})
 }
@@ -224,8 +370,8 @@ func TestBrightUpCmd_Run(t *testing.T) {
 		}()
 
 		inc := 5
-		mockLib.On("LightBrightUp", 0, inc).Return().Once()
-		brightupCmd.Run(brightupCmd, []string{"5"})
+		mockLib.On("LightBrightUp", 0, inc).Return(nil).Once()
+		assert.NoError(t, brightupCmd.RunE(brightupCmd, []string{"5"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -240,7 +386,7 @@ func TestBrightUpCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		brightupCmd.Run(brightupCmd, []string{})
+		assert.NoError(t, brightupCmd.RunE(brightupCmd, []string{}))
 		mockLib.AssertNotCalled(t, "LightBrightUp", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -256,7 +402,7 @@ func TestBrightUpCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		brightupCmd.Run(brightupCmd, []string{"abc"})
+		assert.NoError(t, brightupCmd.RunE(brightupCmd, []string{"abc"}))
 		mockLib.AssertNotCalled(t, "LightBrightUp", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -276,12 +422,12 @@ func TestTempCmd_Run(t *testing.T) {
 		}()
 
 		temp := uint16(4000)
-		mockLib.On("LightTemperature", 0, temp).Return().Once()
-		tempCmd.Run(tempCmd, []string{"4000"})
+		mockLib.On("LightTemperature", 0, temp).Return(nil).Once()
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"4000"}))
 		mockLib.AssertExpectations(t)
 	})
 
-	t.Run("InvalidLevelBelow", func(t *testing.T) {
+	t.Run("BelowGlowAndBeam", func(t *testing.T) {
 		mockLib := new(MockLib)
 		originalLibImpl := libImpl
 		libImpl = mockLib
@@ -292,12 +438,13 @@ func TestTempCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempCmd.Run(tempCmd, []string{"2000"})
-		mockLib.AssertNotCalled(t, "LightTemperature", mock.Anything, mock.Anything)
+		// The range of each model is applied by lib
+		mockLib.On("LightTemperature", 0, uint16(2000)).Return(nil).Once()
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"2000"}))
 		mockLib.AssertExpectations(t)
 	})
 
-	t.Run("InvalidLevelAbove", func(t *testing.T) {
+	t.Run("AboveGlowAndBeam", func(t *testing.T) {
 		mockLib := new(MockLib)
 		originalLibImpl := libImpl
 		libImpl = mockLib
@@ -308,8 +455,8 @@ func TestTempCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempCmd.Run(tempCmd, []string{"7000"})
-		mockLib.AssertNotCalled(t, "LightTemperature", mock.Anything, mock.Anything)
+		mockLib.On("LightTemperature", 0, uint16(7000)).Return(nil).Once()
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"7000"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -324,7 +471,9 @@ func TestTempCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempCmd.Run(tempCmd, []string{"abc"})
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"abc"}))
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"0"}))
+		assert.NoError(t, tempCmd.RunE(tempCmd, []string{"70000"}))
 		mockLib.AssertNotCalled(t, "LightTemperature", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -344,8 +493,8 @@ func TestTempDownCmd_Run(t *testing.T) {
 		}()
 
 		inc := 100
-		mockLib.On("LightTempDown", 0, inc).Return().Once()
-		tempdownCmd.Run(tempdownCmd, []string{"100"})
+		mockLib.On("LightTempDown", 0, inc).Return(nil).Once()
+		assert.NoError(t, tempdownCmd.RunE(tempdownCmd, []string{"100"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -360,7 +509,7 @@ func TestTempDownCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempdownCmd.Run(tempdownCmd, []string{"0"})
+		assert.NoError(t, tempdownCmd.RunE(tempdownCmd, []string{"0"}))
 		mockLib.AssertNotCalled(t, "LightTempDown", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -376,7 +525,7 @@ func TestTempDownCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempdownCmd.Run(tempdownCmd, []string{"-50"})
+		assert.NoError(t, tempdownCmd.RunE(tempdownCmd, []string{"-50"}))
 		mockLib.AssertNotCalled(t, "LightTempDown", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -392,7 +541,7 @@ func TestTempDownCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempdownCmd.Run(tempdownCmd, []string{"abc"})
+		assert.NoError(t, tempdownCmd.RunE(tempdownCmd, []string{"abc"}))
 		mockLib.AssertNotCalled(t, "LightTempDown", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -412,8 +561,8 @@ func TestTempUpCmd_Run(t *testing.T) {
 		}()
 
 		inc := 100
-		mockLib.On("LightTempUp", 0, inc).Return().Once()
-		tempupCmd.Run(tempupCmd, []string{"100"})
+		mockLib.On("LightTempUp", 0, inc).Return(nil).Once()
+		assert.NoError(t, tempupCmd.RunE(tempupCmd, []string{"100"}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -428,7 +577,7 @@ func TestTempUpCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempupCmd.Run(tempupCmd, []string{"0"})
+		assert.NoError(t, tempupCmd.RunE(tempupCmd, []string{"0"}))
 		mockLib.AssertNotCalled(t, "LightTempUp", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -444,7 +593,7 @@ func TestTempUpCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempupCmd.Run(tempupCmd, []string{"-50"})
+		assert.NoError(t, tempupCmd.RunE(tempupCmd, []string{"-50"}))
 		mockLib.AssertNotCalled(t, "LightTempUp", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -460,7 +609,7 @@ func TestTempUpCmd_Run(t *testing.T) {
 			deviceIndex = originalDeviceIndex
 		}()
 
-		tempupCmd.Run(tempupCmd, []string{"abc"})
+		assert.NoError(t, tempupCmd.RunE(tempupCmd, []string{"abc"}))
 		mockLib.AssertNotCalled(t, "LightTempUp", mock.Anything, mock.Anything)
 		mockLib.AssertExpectations(t)
 	})
@@ -480,8 +629,8 @@ func TestToggleCmd_Run(t *testing.T) {
 		}()
 
 		mockLib.On("ReadCurrentState", 0).Return(0, 0, 1).Once()
-		mockLib.On("LightOff", 0).Return().Once()
-		toggleCmd.Run(toggleCmd, []string{})
+		mockLib.On("LightOff", 0).Return(nil).Once()
+		assert.NoError(t, toggleCmd.RunE(toggleCmd, []string{}))
 		mockLib.AssertExpectations(t)
 	})
 
@@ -497,8 +646,8 @@ func TestToggleCmd_Run(t *testing.T) {
 		}()
 
 		mockLib.On("ReadCurrentState", 0).Return(0, 0, 0).Once()
-		mockLib.On("LightOn", 0).Return().Once()
-		toggleCmd.Run(toggleCmd, []string{})
+		mockLib.On("LightOn", 0).Return(nil).Once()
+		assert.NoError(t, toggleCmd.RunE(toggleCmd, []string{}))
 		mockLib.AssertExpectations(t)
 	})
 }
@@ -513,8 +662,577 @@ func TestDevicesCmd_Run(t *testing.T) {
 	mockLib.On("ListDevices").Return([]lib.DiscoveredDevice{
 		{Index: 1, Name: "Beam", Serial: "ABC123", ProductID: 0xc901},
 		{Index: 2, Name: "Glow", Serial: "DEF456", ProductID: 0xc900},
-	}).Once()
+	}, nil).Once()
+
+	assert.NoError(t, devicesCmd.RunE(devicesCmd, []string{}))
+	mockLib.AssertExpectations(t)
+}
+
+// TestDevicesCmd_Verbose tests the devicesCmd reads the full information of every light with --verbose.
+func TestDevicesCmd_Verbose(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	devicesVerbose = true
+	defer func() {
+		libImpl = originalLibImpl
+		devicesVerbose = false
+	}()
+
+	mockLib.On("ListDevices").Return([]lib.DiscoveredDevice{
+		{Index: 1, Name: "Beam", Serial: "ABC123", ProductID: 0xc901},
+		{Index: 2, Name: "Glow", Serial: "DEF456", ProductID: 0xc900},
+	}, nil).Once()
+	mockLib.On("DeviceInfo", 1).Return(lib.DiscoveredDevice{
+		Index: 1, Name: "Beam", Serial: "ABC123", ProductID: 0xc901, Path: "/dev/hidraw3", Firmware: "LIT 01.02.B0012",
+		BrightnessRange: lib.Range{Min: 20, Max: 250}, TemperatureRange: lib.Range{Min: 2700, Max: 6500},
+	}, nil).Once()
+	mockLib.On("DeviceInfo", 2).Return(lib.DiscoveredDevice{}, lib.ErrQueryFailed).Once()
+
+	// The lights that answered are still listed
+	assert.ErrorIs(t, devicesCmd.RunE(devicesCmd, []string{}), lib.ErrQueryFailed)
+	mockLib.AssertExpectations(t)
+}
+
+// TestOnCmd_RunError tests that lib errors are returned from the onCmd.
+func TestOnCmd_RunError(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 3
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+	}()
+
+	mockLib.On("LightOn", 3).Return(fmt.Errorf("%w: no device with index 3", lib.ErrDeviceNotFound)).Once()
+	err := onCmd.RunE(onCmd, []string{})
+	assert.ErrorIs(t, err, lib.ErrDeviceNotFound)
+	mockLib.AssertExpectations(t)
+}
+
+// TestToggleCmd_RunError tests that the toggleCmd returns lib errors.
+func TestToggleCmd_RunError(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 0
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+	}()
 
-	devicesCmd.Run(devicesCmd, []string{})
+	mockLib.On("ReadCurrentState", 0).Return(0, 0, 0).Once()
+	mockLib.On("LightOn", 0).Return(lib.ErrNoDevices).Once()
+	err := toggleCmd.RunE(toggleCmd, []string{})
+	assert.ErrorIs(t, err, lib.ErrNoDevices)
 	mockLib.AssertExpectations(t)
 }
+
+// TestExitCode tests the mapping from lib errors to exit codes.
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitNoDevices, exitCode(lib.ErrNoDevices))
+	assert.Equal(t, exitDeviceNotFound, exitCode(fmt.Errorf("%w: index 4", lib.ErrDeviceNotFound)))
+	assert.Equal(t, exitDeviceNotFound, exitCode(lib.ErrAmbiguousDevice))
+	assert.Equal(t, exitOpenFailed, exitCode(fmt.Errorf("%w: permission denied", lib.ErrOpenFailed)))
+	assert.Equal(t, exitWriteFailed, exitCode(errors.Join(fmt.Errorf("%w: timeout", lib.ErrWriteFailed))))
+	assert.Equal(t, exitWriteFailed, exitCode(lib.ErrShortWrite))
+	assert.Equal(t, exitPartialFailure, exitCode(&lib.WriteError{Results: []lib.WriteResult{
+		{Index: 1, Name: "Beam", Serial: "ABC123", Err: fmt.Errorf("%w: write timeout", lib.ErrWriteFailed)},
+		{Index: 2, Name: "Glow", Serial: "DEF456", Bytes: 20},
+	}}))
+	assert.Equal(t, exitOpenFailed, exitCode(&lib.WriteError{Results: []lib.WriteResult{
+		{Index: 1, Name: "Beam", Serial: "ABC123", Err: fmt.Errorf("%w: permission denied", lib.ErrOpenFailed)},
+	}}))
+	assert.Equal(t, exitError, exitCode(errors.New("unknown command")))
+}
+
+// TestRootCmd_ResolveDevice tests that the --device flag is resolved before a command runs.
+func TestRootCmd_ResolveDevice(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		rootCmd.PersistentFlags().Set("device", "0")
+		rootCmd.PersistentFlags().Lookup("device").Changed = false
+		rootCmd.SetArgs(nil)
+	}()
+
+	mockLib.On("ResolveDevice", "desk-left").Return(2, nil).Once()
+	mockLib.On("LightOn", 2).Return(nil).Once()
+	rootCmd.SetArgs([]string{"-d", "desk-left", "on"})
+	assert.NoError(t, rootCmd.Execute())
+
+	mockLib.On("ResolveDevice", "beam").Return(0, lib.ErrAmbiguousDevice).Once()
+	rootCmd.SetArgs([]string{"-d", "beam", "off"})
+	assert.ErrorIs(t, rootCmd.Execute(), lib.ErrAmbiguousDevice)
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNotCalled(t, "LightOff", mock.Anything)
+}
+
+// TestRootCmd_DryRun tests that the --dry-run flag is applied before the device is resolved.
+func TestRootCmd_DryRun(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		rootCmd.PersistentFlags().Set("device", "0")
+		rootCmd.PersistentFlags().Lookup("device").Changed = false
+		rootCmd.PersistentFlags().Set("dry-run", "off")
+		rootCmd.PersistentFlags().Lookup("dry-run").Changed = false
+		rootCmd.SetArgs(nil)
+	}()
+
+	mockLib.On("SetDryRun", lib.DryRunOn).Once()
+	mockLib.On("ResolveDevice", "desk-left").Return(2, nil).Once()
+	mockLib.On("LightOn", 2).Return(nil).Once()
+	rootCmd.SetArgs([]string{"--dry-run", "-d", "desk-left", "on"})
+	assert.NoError(t, rootCmd.Execute())
+
+	mockLib.On("SetDryRun", lib.DryRunState).Once()
+	mockLib.On("ResolveDevice", "desk-left").Return(2, nil).Once()
+	mockLib.On("LightOff", 2).Return(nil).Once()
+	rootCmd.SetArgs([]string{"--dry-run=state", "-d", "desk-left", "off"})
+	assert.NoError(t, rootCmd.Execute())
+
+	rootCmd.SetArgs([]string{"--dry-run=maybe", "on"})
+	assert.Error(t, rootCmd.Execute())
+
+	mockLib.AssertExpectations(t)
+}
+
+// TestAliasCmds_Run tests setting, removing and listing aliases.
+func TestAliasCmds_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	defer func() { libImpl = originalLibImpl }()
+
+	mockLib.On("SetAlias", "desk-left", "ABC123").Once()
+	assert.NoError(t, aliasSetCmd.RunE(aliasSetCmd, []string{"desk-left", "ABC123"}))
+
+	// Names that would be parsed as an index are rejected
+	assert.NoError(t, aliasSetCmd.RunE(aliasSetCmd, []string{"2", "ABC123"}))
+	assert.NoError(t, aliasSetCmd.RunE(aliasSetCmd, []string{"All", "ABC123"}))
+
+	mockLib.On("RemoveAlias", "desk-left").Return(true).Once()
+	assert.NoError(t, aliasRemoveCmd.RunE(aliasRemoveCmd, []string{"desk-left"}))
+
+	mockLib.On("GetAliases").Return(map[string]string{"desk-right": "DEF456"}).Once()
+	assert.NoError(t, aliasListCmd.RunE(aliasListCmd, []string{}))
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNumberOfCalls(t, "SetAlias", 1)
+}
+
+// TestFadeCmd_Run tests the Run function of the fadeCmd.
+func TestFadeCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 1
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		fadeCmd.Flags().Set("to-bright", "-1")
+		fadeCmd.Flags().Set("to-temp", "-1")
+		fadeCmd.Flags().Set("over", "1s")
+		fadeCmd.Flags().Set("easing", "ease-in-out")
+	}()
+
+	t.Run("brightness and temperature", func(t *testing.T) {
+		fadeCmd.Flags().Set("to-bright", "80")
+		fadeCmd.Flags().Set("to-temp", "4000")
+		fadeCmd.Flags().Set("over", "3s")
+		mockLib.On("Transition", mock.Anything, 1, 80, 4000, 3*time.Second, mock.Anything).Return(nil).Once()
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		fadeCmd.Flags().Set("to-bright", "20")
+		fadeCmd.Flags().Set("to-temp", "-1")
+		mockLib.On("Transition", mock.Anything, 1, 20, -1, 3*time.Second, mock.Anything).Return(context.Canceled).Once()
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		mockLib.On("Transition", mock.Anything, 1, 20, -1, 3*time.Second, mock.Anything).Return(lib.ErrNoDevices).Once()
+		assert.ErrorIs(t, fadeCmd.RunE(fadeCmd, []string{}), lib.ErrNoDevices)
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("temperature outside the range of the Glow and Beam", func(t *testing.T) {
+		fadeCmd.Flags().Set("to-bright", "-1")
+		fadeCmd.Flags().Set("to-temp", "8000")
+		mockLib.On("Transition", mock.Anything, 1, -1, 8000, 3*time.Second, mock.Anything).Return(nil).Once()
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		fadeCmd.Flags().Set("to-temp", "0")
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		fadeCmd.Flags().Set("to-temp", "-1")
+		fadeCmd.Flags().Set("to-bright", "120")
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		fadeCmd.Flags().Set("to-bright", "50")
+		fadeCmd.Flags().Set("easing", "bounce")
+		assert.NoError(t, fadeCmd.RunE(fadeCmd, []string{}))
+		mockLib.AssertNumberOfCalls(t, "Transition", 4)
+	})
+}
+
+// TestEffectCmd_Run tests the Run function of the effectCmd.
+func TestEffectCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 2
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		effectCmd.Flags().Set("count", "3")
+		effectCmd.Flags().Set("period", "0s")
+		effectCmd.Flags().Set("min", "10")
+		effectCmd.Flags().Set("from", "2700")
+		effectCmd.Flags().Set("to", "6500")
+	}()
+
+	t.Run("blink with defaults", func(t *testing.T) {
+		mockLib.On("RunEffect", mock.Anything, 2, lib.Blink{Count: 3, Period: 500 * time.Millisecond}).Return(nil).Once()
+		assert.NoError(t, effectCmd.RunE(effectCmd, []string{"blink"}))
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("pulse with flags, interrupted", func(t *testing.T) {
+		effectCmd.Flags().Set("count", "0")
+		effectCmd.Flags().Set("period", "1s")
+		effectCmd.Flags().Set("min", "20")
+		mockLib.On("RunEffect", mock.Anything, 2, lib.Pulse{Min: 20, Max: 100, Period: time.Second}).Return(context.Canceled).Once()
+		assert.NoError(t, effectCmd.RunE(effectCmd, []string{"pulse"}))
+		mockLib.AssertExpectations(t)
+	})
+
+	t.Run("unknown effect", func(t *testing.T) {
+		assert.NoError(t, effectCmd.RunE(effectCmd, []string{"rainbow"}))
+		mockLib.AssertNumberOfCalls(t, "RunEffect", 2)
+	})
+
+	t.Run("device errors are returned", func(t *testing.T) {
+		mockLib.On("RunEffect", mock.Anything, 2, mock.Anything).Return(lib.ErrNoDevices).Once()
+		assert.ErrorIs(t, effectCmd.RunE(effectCmd, []string{"sweep"}), lib.ErrNoDevices)
+	})
+
+	t.Run("sweep temperatures are left to the range of each light", func(t *testing.T) {
+		effectCmd.Flags().Set("count", "1")
+		effectCmd.Flags().Set("period", "4s")
+		effectCmd.Flags().Set("from", "2000")
+		effectCmd.Flags().Set("to", "9000")
+		mockLib.On("RunEffect", mock.Anything, 2, lib.TemperatureSweep{From: 2000, To: 9000, Period: 4 * time.Second, Count: 1}).Return(nil).Once()
+		assert.NoError(t, effectCmd.RunE(effectCmd, []string{"sweep"}))
+
+		effectCmd.Flags().Set("from", "0")
+		assert.NoError(t, effectCmd.RunE(effectCmd, []string{"sweep"}))
+		mockLib.AssertExpectations(t)
+		mockLib.AssertNumberOfCalls(t, "RunEffect", 4)
+	})
+}
+
+// TestIdentifyCmd_Run tests the Run function of the identifyCmd.
+func TestIdentifyCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+	}()
+
+	// A specific device is required
+	deviceIndex = 0
+	assert.NoError(t, identifyCmd.RunE(identifyCmd, []string{}))
+	mockLib.AssertNotCalled(t, "Identify", mock.Anything, mock.Anything)
+
+	deviceIndex = 2
+	mockLib.On("Identify", mock.Anything, 2).Return(nil).Once()
+	assert.NoError(t, identifyCmd.RunE(identifyCmd, []string{}))
+	mockLib.AssertExpectations(t)
+}
+
+// TestBackCmds_Run tests the Run functions of the back light commands.
+func TestBackCmds_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 0
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		backColorCmd.Flags().Set("zone", "all")
+	}()
+
+	mockLib.On("BackLightOn", 0).Return(nil).Once()
+	assert.NoError(t, backOnCmd.RunE(backOnCmd, []string{}))
+	mockLib.On("BackLightOff", 0).Return(nil).Once()
+	assert.NoError(t, backOffCmd.RunE(backOffCmd, []string{}))
+	mockLib.On("BackLightBrightness", 0, 40).Return(nil).Once()
+	assert.NoError(t, backBrightCmd.RunE(backBrightCmd, []string{"40"}))
+
+	orange := lib.Color{Red: 0xff, Green: 0x88}
+	mockLib.On("BackLightColor", 0, lib.AllZones, orange).Return(nil).Once()
+	assert.NoError(t, backColorCmd.RunE(backColorCmd, []string{"#ff8800"}))
+
+	deviceIndex = 2
+	backColorCmd.Flags().Set("zone", "3")
+	mockLib.On("BackLightColor", 2, 3, orange).Return(lib.ErrFeatureNotSupported).Once()
+	assert.ErrorIs(t, backColorCmd.RunE(backColorCmd, []string{"ff8800"}), lib.ErrFeatureNotSupported)
+
+	// Invalid values are reported without calling the lib
+	assert.NoError(t, backBrightCmd.RunE(backBrightCmd, []string{"0"}))
+	assert.NoError(t, backColorCmd.RunE(backColorCmd, []string{"orange"}))
+	backColorCmd.Flags().Set("zone", "left")
+	assert.NoError(t, backColorCmd.RunE(backColorCmd, []string{"#ff8800"}))
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNumberOfCalls(t, "BackLightBrightness", 1)
+	mockLib.AssertNumberOfCalls(t, "BackLightColor", 2)
+}
+
+// TestStatusCmd_Run tests the Run function of the statusCmd.
+func TestStatusCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 0
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+	}()
+
+	devices := []lib.DiscoveredDevice{
+		{Index: 1, Name: "Beam", Serial: "ABC123", ProductID: 0xc901},
+		{Index: 2, Name: "Glow", Serial: "DEF456", ProductID: 0xc900},
+	}
+	mockLib.On("ListDevices").Return(devices, nil)
+	mockLib.On("QueryState", 1).Return(lib.DeviceState{Power: 1, Brightness: 50, Temperature: 4000, Lumens: 215}, nil).Once()
+	mockLib.On("QueryState", 2).Return(lib.DeviceState{}, lib.ErrQueryFailed).Once()
+
+	// Lights that cannot be queried are still listed, and the error is returned
+	assert.ErrorIs(t, statusCmd.RunE(statusCmd, []string{}), lib.ErrQueryFailed)
+
+	// -d only shows the selected light
+	deviceIndex = 1
+	mockLib.On("QueryState", 1).Return(lib.DeviceState{Power: 0, Brightness: 10, Temperature: 2700, Lumens: 67}, nil).Once()
+	assert.NoError(t, statusCmd.RunE(statusCmd, []string{}))
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNumberOfCalls(t, "QueryState", 3)
+}
+
+// TestCurveCmd_Run tests the Run function of the curveCmd.
+func TestCurveCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 0
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+	}()
+
+	// Without -d the curve of all lights is shown and set
+	mockLib.On("GetCurve", "").Return("").Once()
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{}))
+	mockLib.On("SetCurve", "", "perceptual").Once()
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{"perceptual"}))
+
+	// Unknown curves are rejected
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{"sigmoid"}))
+
+	// With -d the curve of that light is set under its identity
+	deviceIndex = 2
+	mockLib.On("ListDevices").Return([]lib.DiscoveredDevice{
+		{Index: 1, Name: "Beam", Serial: "ABC123", ID: "ABC123"},
+		{Index: 2, Name: "Glow", Serial: "", ID: "@1-4", Port: "1-4"},
+		{Index: 3, Name: "Glow", Serial: "", ID: "@/dev/hidraw2"},
+	}, nil)
+	mockLib.On("SetCurve", "@1-4", "gamma:2.2").Once()
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{"gamma:2.2"}))
+
+	// A light without a serial number or port has no curve of its own, and the shared one is left alone
+	deviceIndex = 3
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{"gamma:2.2"}))
+	assert.NoError(t, curveCmd.RunE(curveCmd, []string{}))
+
+	deviceIndex = 5
+	assert.ErrorIs(t, curveCmd.RunE(curveCmd, []string{"linear"}), lib.ErrDeviceNotFound)
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNumberOfCalls(t, "SetCurve", 2)
+}
+
+// TestCalibrateCmd_Run tests the Run function of the calibrateCmd.
+func TestCalibrateCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 0
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		for _, name := range []string{config.TempOffset, config.BrightScale, config.TempTable, config.BrightTable, "reset"} {
+			flag := calibrateCmd.Flags().Lookup(name)
+			flag.Value.Set(flag.DefValue)
+			flag.Changed = false
+		}
+	}()
+
+	mockLib.On("ListDevices").Return([]lib.DiscoveredDevice{
+		{Index: 1, Name: "Beam", Serial: "ABC123", ID: "ABC123"},
+		{Index: 2, Name: "Glow", Serial: "", ID: "@1-4", Port: "1-4"},
+		{Index: 3, Name: "Glow", Serial: "", ID: "@/dev/hidraw2"},
+	}, nil)
+	mockLib.On("GetCalibration", "ABC123").Return(map[string]string{config.TempOffset: "-150"})
+	mockLib.On("GetCalibration", "@1-4").Return(map[string]string{})
+	mockLib.On("GetCalibration", "@/dev/hidraw2").Return(map[string]string{})
+
+	// Without -d the calibration of every light is shown, but none can be set
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+	calibrateCmd.Flags().Set(config.BrightScale, "0.9")
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+
+	// With -d only the flags given are changed
+	deviceIndex = 1
+	calibrateCmd.Flags().Set(config.TempOffset, "-200")
+	mockLib.On("SetCalibration", "ABC123", map[string]string{config.TempOffset: "-200", config.BrightScale: "0.9"}).Once()
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+
+	// Invalid tables are rejected
+	calibrateCmd.Flags().Set(config.TempTable, "2700:2600")
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+
+	// --reset removes every setting
+	deviceIndex = 2
+	calibrateCmd.Flags().Set("reset", "true")
+	mockLib.On("SetCalibration", "@1-4", map[string]string{config.TempOffset: "", config.BrightScale: "",
+		config.TempTable: "", config.BrightTable: ""}).Once()
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+
+	// A light without a serial number or port cannot be calibrated
+	deviceIndex = 3
+	assert.NoError(t, calibrateCmd.RunE(calibrateCmd, []string{}))
+
+	deviceIndex = 5
+	assert.ErrorIs(t, calibrateCmd.RunE(calibrateCmd, []string{}), lib.ErrDeviceNotFound)
+
+	mockLib.AssertExpectations(t)
+	mockLib.AssertNumberOfCalls(t, "SetCalibration", 2)
+}
+
+// TestReplayCmd_Run tests the Run function of the replayCmd.
+func TestReplayCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 2
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		replayCmd.Flags().Set("speed", "1")
+	}()
+
+	trace := filepath.Join(t.TempDir(), "trace.jsonl")
+	assert.NoError(t, os.WriteFile(trace, []byte(
+		`{"time":"2026-01-02T03:04:05Z","serial":"ABC123","name":"Beam","direction":"write","data":"11ff041c01"}`+"\n"), 0o644))
+
+	replayCmd.Flags().Set("speed", "2.5")
+	mockLib.On("Replay", mock.Anything, mock.MatchedBy(func(records []lib.TraceRecord) bool {
+		return len(records) == 1 && records[0].Serial == "ABC123" && records[0].Data == "11ff041c01"
+	}), 2, 2.5).Return(nil).Once()
+	assert.NoError(t, replayCmd.RunE(replayCmd, []string{trace}))
+	mockLib.AssertExpectations(t)
+
+	// Interrupting the replay is not an error
+	mockLib.On("Replay", mock.Anything, mock.Anything, 2, 2.5).Return(context.Canceled).Once()
+	assert.NoError(t, replayCmd.RunE(replayCmd, []string{trace}))
+
+	// Invalid speeds, missing files and invalid traces are not replayed
+	replayCmd.Flags().Set("speed", "-1")
+	assert.NoError(t, replayCmd.RunE(replayCmd, []string{trace}))
+	replayCmd.Flags().Set("speed", "1")
+	assert.Error(t, replayCmd.RunE(replayCmd, []string{filepath.Join(t.TempDir(), "missing.jsonl")}))
+	assert.NoError(t, os.WriteFile(trace, []byte("not json\n"), 0o644))
+	assert.ErrorContains(t, replayCmd.RunE(replayCmd, []string{trace}), "line 1")
+	mockLib.AssertNumberOfCalls(t, "Replay", 2)
+}
+
+// TestRawCmd_Run tests the Run function of the rawCmd.
+func TestRawCmd_Run(t *testing.T) {
+	mockLib := new(MockLib)
+	originalLibImpl := libImpl
+	libImpl = mockLib
+	originalDeviceIndex := deviceIndex
+	deviceIndex = 1
+	defer func() {
+		libImpl = originalLibImpl
+		deviceIndex = originalDeviceIndex
+		rawCmd.Flags().Set("feature", "")
+		rawCmd.Flags().Set("function", "")
+	}()
+
+	response := lib.RawReport{Data: []byte{0x11, 0xff, 0x04, 0x01, 0x01}, Decoded: "GetPower(on=true)"}
+	mockLib.On("SendRaw", 1, []byte{0x11, 0xff, 0x04, 0x01}).Return(lib.RawReport{}, []lib.RawReport{response}, nil).Once()
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{"11", "0xFF", "0401"}))
+
+	rawCmd.Flags().Set("feature", "illumination")
+	rawCmd.Flags().Set("function", "SetPower")
+	mockLib.On("SendFunction", 1, protocol.IlluminationFeature, protocol.SetPowerFunction, []byte{0x01}).
+		Return(lib.RawReport{}, []lib.RawReport(nil), nil).Once()
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{"1"}))
+
+	rawCmd.Flags().Set("feature", "0x8070")
+	rawCmd.Flags().Set("function", "0x1c")
+	mockLib.On("SendFunction", 1, protocol.FeatureID(0x8070), protocol.Function(0x1c), []byte(nil)).
+		Return(lib.RawReport{}, []lib.RawReport(nil), lib.ErrFeatureNotSupported).Once()
+	assert.ErrorIs(t, rawCmd.RunE(rawCmd, []string{}), lib.ErrFeatureNotSupported)
+
+	// Invalid bytes, features and functions, and a missing device, are rejected before sending
+	rawCmd.Flags().Set("function", "Dim")
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{}))
+	rawCmd.Flags().Set("feature", "lamp")
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{}))
+	rawCmd.Flags().Set("feature", "")
+	rawCmd.Flags().Set("function", "")
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{"11", "zz"}))
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{}))
+	deviceIndex = 0
+	assert.NoError(t, rawCmd.RunE(rawCmd, []string{"11"}))
+	mockLib.AssertExpectations(t)
+}
+
+// TestParseHexBytes tests bytes are parsed one per argument or run together
+func TestParseHexBytes(t *testing.T) {
+	data, err := parseHexBytes([]string{"11", "0xff", "4", "1C01"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x11, 0xff, 0x04, 0x1c, 0x01}, data)
+
+	for _, arg := range []string{"", "0x", "g1", "1-2"} {
+		_, err = parseHexBytes([]string{arg})
+		assert.Error(t, err, arg)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var curveCmd = &cobra.Command{
+	Use:   "curve [linear|perceptual|gamma:<value>]",
+	Short: "Shows or sets the brightness curve",
+	Long: `Shows or sets the curve mapping brightness levels onto the lights. With the perceptual curve
+(CIE L*) or a gamma above 1, each step of bright, brightup, brightdown and the lcui slider looks
+like the same change in brightness. Without -d the curve applies to every light that has no curve
+of its own, e.g. 'lcli curve perceptual' or 'lcli -d 2 curve gamma:2.2'. A light needs a serial
+number or a known USB port to have a curve of its own.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Without -d the empty identity selects the curve shared by all lights
+		id := ""
+		if deviceIndex != 0 {
+			device, err := selectedDevice()
+			if err != nil {
+				return err
+			}
+			if !device.HasStableID() {
+				fmt.Printf("Light %d (Litra %s) has no serial number or USB port to save a curve under\n", device.Index, device.Name)
+				return nil
+			}
+			id = device.ID
+		}
+
+		if len(args) == 0 {
+			curve := libImpl.GetCurve(id)
+			if curve == "" {
+				curve = "linear"
+			}
+			fmt.Println(curve)
+			return nil
+		}
+		if _, err := lib.CurveByName(args[0]); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		libImpl.SetCurve(id, args[0])
+		return nil
+	},
+	Args: cobra.MaximumNArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(curveCmd)
+}
+
+// selectedDevice returns the light selected with -d
+func selectedDevice() (lib.DiscoveredDevice, error) {
+	devices, err := libImpl.ListDevices()
+	for _, d := range devices {
+		if d.Index == deviceIndex {
+			return d, nil
+		}
+	}
+	return lib.DiscoveredDevice{}, errors.Join(fmt.Errorf("%w: no device with index %d", lib.ErrDeviceNotFound, deviceIndex), err)
+}
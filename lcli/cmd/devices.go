@@ -1,27 +1,78 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/kharyam/go-litra-driver/lib"
 	"github.com/spf13/cobra"
 )
 
+var devicesVerbose bool
+
 var devicesCmd = &cobra.Command{
 	Use:   "devices",
 	Short: "List connected Litra devices",
-	Long:  `Lists all connected Litra devices (Glow and Beam) with their indices.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		devices := libImpl.ListDevices()
-		if len(devices) == 0 {
+	Long: `Lists all connected Litra devices (Glow and Beam) with their indices.
+Lights on a known USB port also show the port, which can be used to address a light with -d port:<port>.
+With --verbose, also shows the firmware version, HID path, USB interface, identity and supported ranges of
+each light. The identity is what settings of the light are saved under: its serial number, or serial@port
+when the serial number is empty or shared with another light.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		devices, err := libImpl.ListDevices()
+		if len(devices) == 0 && err == nil {
 			fmt.Println("No Litra devices found.")
-			return
+			return nil
 		}
 		for _, d := range devices {
-			fmt.Printf("  %d: Litra %s (serial: %s)\n", d.Index, d.Name, d.Serial)
+			if !devicesVerbose {
+				printDevice(d)
+				continue
+			}
+			info, infoErr := libImpl.DeviceInfo(d.Index)
+			if infoErr != nil {
+				printDevice(d)
+				err = errors.Join(err, infoErr)
+				continue
+			}
+			printDeviceInfo(info)
 		}
+		return err
 	},
 }
 
+// printDevice prints the index, model, serial number and USB port of a light
+func printDevice(d lib.DiscoveredDevice) {
+	if d.Port == "" {
+		fmt.Printf("  %d: Litra %s (serial: %s)\n", d.Index, d.Name, d.Serial)
+		return
+	}
+	fmt.Printf("  %d: Litra %s (serial: %s, port: %s)\n", d.Index, d.Name, d.Serial, d.Port)
+}
+
+// printDeviceInfo prints the full metadata of a light
+func printDeviceInfo(d lib.DiscoveredDevice) {
+	firmware := d.Firmware
+	if firmware == "" {
+		firmware = "unknown"
+	}
+	port := d.Port
+	if port == "" {
+		port = "unknown"
+	}
+	fmt.Printf("  %d: Litra %s (serial: %s)\n", d.Index, d.Name, d.Serial)
+	fmt.Printf("       Product ID:  0x%04x\n", d.ProductID)
+	fmt.Printf("       Firmware:    %s\n", firmware)
+	fmt.Printf("       HID path:    %s\n", d.Path)
+	fmt.Printf("       Interface:   %d\n", d.Interface)
+	fmt.Printf("       USB port:    %s\n", port)
+	fmt.Printf("       Identity:    %s\n", d.ID)
+	fmt.Printf("       Brightness:  %d-%d (raw)\n", d.BrightnessRange.Min, d.BrightnessRange.Max)
+	fmt.Printf("       Temperature: %d-%dK\n", d.TemperatureRange.Min, d.TemperatureRange.Max)
+}
+
 func init() {
 	rootCmd.AddCommand(devicesCmd)
+
+	devicesCmd.Flags().BoolVarP(&devicesVerbose, "verbose", "v", false, "Show firmware, HID path, identity and supported ranges")
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var effectCount int
+var effectPeriod time.Duration
+var effectMin int
+var effectMax int
+var effectFrom int
+var effectTo int
+
+// effectBuilders create the named effects from the flags. period is the --period flag,
+// or the default period of the effect when the flag is not set.
+var effectBuilders = map[string]struct {
+	defaultPeriod time.Duration
+	build         func(period time.Duration) lib.Effect
+}{
+	"blink": {500 * time.Millisecond, func(period time.Duration) lib.Effect {
+		return lib.Blink{Count: effectCount, Period: period}
+	}},
+	"strobe": {150 * time.Millisecond, func(period time.Duration) lib.Effect {
+		return lib.Blink{Count: effectCount, Period: period}
+	}},
+	"pulse": {2 * time.Second, func(period time.Duration) lib.Effect {
+		return lib.Pulse{Min: effectMin, Max: effectMax, Period: period, Count: effectCount}
+	}},
+	"breathe": {4 * time.Second, func(period time.Duration) lib.Effect {
+		return lib.Breathe{Min: effectMin, Max: effectMax, Period: period, Count: effectCount}
+	}},
+	"sweep": {6 * time.Second, func(period time.Duration) lib.Effect {
+		return lib.TemperatureSweep{From: effectFrom, To: effectTo, Period: period, Count: effectCount}
+	}},
+}
+
+// effectNames returns the names of the available effects
+func effectNames() []string {
+	names := make([]string, 0, len(effectBuilders))
+	for name := range effectBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// effectCmd represents the effect command
+var effectCmd = &cobra.Command{
+	Use:   "effect <name>",
+	Short: "Plays a light effect (blink, strobe, pulse, breathe, sweep)",
+	Long: `Plays a light effect and then restores the previous state of the lights.
+  blink    switch the lights on and off --count times
+  strobe   blink quickly
+  pulse    vary the brightness smoothly between --min and --max
+  breathe  like pulse, lingering at --min
+  sweep    move the temperature from --from to --to and back
+Each repetition lasts --period. A --count of 0 repeats until Ctrl+C is pressed.`,
+	ValidArgs: effectNames(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		builder, ok := effectBuilders[strings.ToLower(args[0])]
+		if !ok {
+			fmt.Printf("Unknown effect %s, choose one of: %s\n", args[0], strings.Join(effectNames(), ", "))
+			return nil
+		}
+		if effectCount < 0 {
+			fmt.Printf("Count must be 0 or more, not %d\n", effectCount)
+			return nil
+		}
+		if effectMin < 0 || effectMax > 100 || effectMin > effectMax {
+			fmt.Printf("Brightness range must be within 0 and 100, not %d-%d\n", effectMin, effectMax)
+			return nil
+		}
+		if !isTemperature(effectFrom) || !isTemperature(effectTo) {
+			fmt.Printf("Temperatures must be positive numbers of Kelvin, not %d-%d\n", effectFrom, effectTo)
+			return nil
+		}
+
+		period := effectPeriod
+		if period <= 0 {
+			period = builder.defaultPeriod
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := libImpl.RunEffect(ctx, deviceIndex, builder.build(period))
+		// Interrupting an effect is the normal way to end one that repeats forever
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(effectCmd)
+
+	effectCmd.Flags().IntVar(&effectCount, "count", 3, "Number of repetitions (0 repeats until interrupted)")
+	effectCmd.Flags().DurationVar(&effectPeriod, "period", 0, "Duration of one repetition (default depends on the effect)")
+	effectCmd.Flags().IntVar(&effectMin, "min", 10, "Lowest brightness for pulse and breathe (0-100)")
+	effectCmd.Flags().IntVar(&effectMax, "max", 100, "Highest brightness for pulse and breathe (0-100)")
+	effectCmd.Flags().IntVar(&effectFrom, "from", 2700, "Starting temperature for sweep in Kelvin")
+	effectCmd.Flags().IntVar(&effectTo, "to", 6500, "Turning temperature for sweep in Kelvin")
+}
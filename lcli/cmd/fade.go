@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var fadeBrightness int
+var fadeTemperature int
+var fadeDuration time.Duration
+var fadeEasing string
+
+// fadeCmd represents the fade command
+var fadeCmd = &cobra.Command{
+	Use:   "fade",
+	Short: "Gradually changes the brightness and/or temperature",
+	Long: `Fades the lights from their current state to the given brightness and/or temperature,
+e.g. 'lcli fade --to-bright 80 --to-temp 4000 --over 3s'. Press Ctrl+C to stop the fade.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fadeBrightness == -1 && fadeTemperature == -1 {
+			fmt.Println("Specify --to-bright and/or --to-temp")
+			return nil
+		}
+		if fadeBrightness != -1 && (fadeBrightness < 0 || fadeBrightness > 100) {
+			fmt.Printf("Brightness must be a value between 0 and 100, not %d\n", fadeBrightness)
+			return nil
+		}
+		if fadeTemperature != -1 && !isTemperature(fadeTemperature) {
+			fmt.Printf("Temperature must be a positive number of Kelvin, not %d\n", fadeTemperature)
+			return nil
+		}
+		easing, err := lib.EasingByName(fadeEasing)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = libImpl.Transition(ctx, deviceIndex, fadeBrightness, fadeTemperature, fadeDuration, easing)
+		// Interrupting a fade leaves the lights at the last step, like stopping an effect
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	rootCmd.AddCommand(fadeCmd)
+
+	fadeCmd.Flags().IntVar(&fadeBrightness, "to-bright", -1, "Target brightness (0-100)")
+	fadeCmd.Flags().IntVar(&fadeTemperature, "to-temp", -1, "Target temperature in Kelvin")
+	fadeCmd.Flags().DurationVar(&fadeDuration, "over", time.Second, "Duration of the fade, e.g. 500ms or 3s")
+	fadeCmd.Flags().StringVar(&fadeEasing, "easing", "ease-in-out", "Easing curve: linear or ease-in-out")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+// identifyCmd represents the identify command
+var identifyCmd = &cobra.Command{
+	Use:   "identify",
+	Short: "Blinks the device selected with -d so you can tell which light it is",
+	Long: `Blinks only the device selected with -d a few times and then returns it to its
+previous power, brightness and temperature, e.g. 'lcli identify -d 2'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if deviceIndex == 0 {
+			fmt.Println("Select the device to identify with -d, use 'devices' command to list them")
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := libImpl.Identify(ctx, deviceIndex)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	rootCmd.AddCommand(identifyCmd)
+}
@@ -1,67 +1,224 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/kharyam/go-litra-driver/config"
 	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
 )
 
 // LitraLib defines the interface for the lib package functions used by the commands.
 type LitraLib interface {
-	LightOn(deviceIndex int)
-	LightOff(deviceIndex int)
-	LightBrightness(deviceIndex int, level int)
-	LightBrightDown(deviceIndex int, inc int)
-	LightBrightUp(deviceIndex int, inc int)
-	LightTemperature(deviceIndex int, temp uint16)
-	LightTempDown(deviceIndex int, inc int)
-	LightTempUp(deviceIndex int, inc int)
+	LightOn(deviceIndex int) error
+	LightOff(deviceIndex int) error
+	LightBrightness(deviceIndex int, level int) error
+	LightLumens(deviceIndex int, lm int) error
+	LightBrightDown(deviceIndex int, inc int) error
+	LightBrightUp(deviceIndex int, inc int) error
+	LightTemperature(deviceIndex int, temp uint16) error
+	LightTempDown(deviceIndex int, inc int) error
+	LightTempUp(deviceIndex int, inc int) error
+	BackLightOn(deviceIndex int) error
+	BackLightOff(deviceIndex int) error
+	BackLightBrightness(deviceIndex int, level int) error
+	BackLightColor(deviceIndex int, zone int, color lib.Color) error
+	Transition(ctx context.Context, deviceIndex int, targetBrightness int, targetTemp int, duration time.Duration, easing lib.Easing) error
+	RunEffect(ctx context.Context, deviceIndex int, effect lib.Effect) error
+	Identify(ctx context.Context, deviceIndex int) error
+	Replay(ctx context.Context, records []lib.TraceRecord, deviceIndex int, speed float64) error
+	SendRaw(deviceIndex int, report []byte) (lib.RawReport, []lib.RawReport, error)
+	SendFunction(deviceIndex int, feature protocol.FeatureID, function protocol.Function, params []byte) (lib.RawReport, []lib.RawReport, error)
 	ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int)
-	ListDevices() []lib.DiscoveredDevice
+	QueryState(deviceIndex int) (lib.DeviceState, error)
+	ListDevices() ([]lib.DiscoveredDevice, error)
+	DeviceInfo(deviceIndex int) (lib.DiscoveredDevice, error)
+	ResolveDevice(spec string) (int, error)
+	SetAlias(alias string, serial string)
+	RemoveAlias(alias string) bool
+	GetAliases() map[string]string
+	GetCurve(id string) string
+	SetCurve(id string, curve string)
+	GetCalibration(id string) map[string]string
+	SetCalibration(id string, options map[string]string)
+	SetDryRun(mode lib.DryRun)
 }
 
 // DefaultLitraLib is the default implementation of the LitraLib interface using the actual lib package.
-type DefaultLitraLib struct{}
+type DefaultLitraLib struct {
+	dryRun lib.DryRun // lib.DryRunOn leaves the config file alone
+}
 
 func (l *DefaultLitraLib) ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
-	return config.ReadCurrentState(deviceIndex)
+	return lib.ReadCurrentState(deviceIndex)
+}
+
+func (l *DefaultLitraLib) QueryState(deviceIndex int) (lib.DeviceState, error) {
+	return lib.QueryState(deviceIndex)
+}
+
+func (l *DefaultLitraLib) LightOn(deviceIndex int) error {
+	return lib.LightOn(deviceIndex)
+}
+
+func (l *DefaultLitraLib) LightOff(deviceIndex int) error {
+	return lib.LightOff(deviceIndex)
+}
+
+func (l *DefaultLitraLib) LightBrightness(deviceIndex int, level int) error {
+	return lib.LightBrightness(deviceIndex, level)
+}
+
+func (l *DefaultLitraLib) LightLumens(deviceIndex int, lm int) error {
+	return lib.LightLumens(deviceIndex, lm)
+}
+
+func (l *DefaultLitraLib) LightBrightDown(deviceIndex int, inc int) error {
+	return lib.LightBrightDown(deviceIndex, inc)
+}
+
+func (l *DefaultLitraLib) LightBrightUp(deviceIndex int, inc int) error {
+	return lib.LightBrightUp(deviceIndex, inc)
+}
+
+func (l *DefaultLitraLib) LightTemperature(deviceIndex int, temp uint16) error {
+	return lib.LightTemperature(deviceIndex, temp)
+}
+
+func (l *DefaultLitraLib) LightTempDown(deviceIndex int, inc int) error {
+	return lib.LightTempDown(deviceIndex, inc)
+}
+
+func (l *DefaultLitraLib) LightTempUp(deviceIndex int, inc int) error {
+	return lib.LightTempUp(deviceIndex, inc)
+}
+
+func (l *DefaultLitraLib) BackLightOn(deviceIndex int) error {
+	return lib.BackLightOn(deviceIndex)
 }
 
-func (l *DefaultLitraLib) LightOn(deviceIndex int) {
-	lib.LightOn(deviceIndex)
+func (l *DefaultLitraLib) BackLightOff(deviceIndex int) error {
+	return lib.BackLightOff(deviceIndex)
 }
 
-func (l *DefaultLitraLib) LightOff(deviceIndex int) {
-	lib.LightOff(deviceIndex)
+func (l *DefaultLitraLib) BackLightBrightness(deviceIndex int, level int) error {
+	return lib.BackLightBrightness(deviceIndex, level)
 }
 
-func (l *DefaultLitraLib) LightBrightness(deviceIndex int, level int) {
-	lib.LightBrightness(deviceIndex, level)
+func (l *DefaultLitraLib) BackLightColor(deviceIndex int, zone int, color lib.Color) error {
+	return lib.BackLightColor(deviceIndex, zone, color)
 }
 
-func (l *DefaultLitraLib) LightBrightDown(deviceIndex int, inc int) {
-	lib.LightBrightDown(deviceIndex, inc)
+func (l *DefaultLitraLib) Transition(ctx context.Context, deviceIndex int, targetBrightness int, targetTemp int, duration time.Duration, easing lib.Easing) error {
+	return lib.Transition(ctx, deviceIndex, targetBrightness, targetTemp, duration, easing)
 }
 
-func (l *DefaultLitraLib) LightBrightUp(deviceIndex int, inc int) {
-	lib.LightBrightUp(deviceIndex, inc)
+func (l *DefaultLitraLib) RunEffect(ctx context.Context, deviceIndex int, effect lib.Effect) error {
+	return lib.RunEffect(ctx, deviceIndex, effect)
 }
 
-func (l *DefaultLitraLib) LightTemperature(deviceIndex int, temp uint16) {
-	lib.LightTemperature(deviceIndex, temp)
+func (l *DefaultLitraLib) Replay(ctx context.Context, records []lib.TraceRecord, deviceIndex int, speed float64) error {
+	return lib.Replay(ctx, records, deviceIndex, speed)
 }
 
-func (l *DefaultLitraLib) LightTempDown(deviceIndex int, inc int) {
-	lib.LightTempDown(deviceIndex, inc)
+func (l *DefaultLitraLib) SendRaw(deviceIndex int, report []byte) (lib.RawReport, []lib.RawReport, error) {
+	return lib.SendRaw(deviceIndex, report)
 }
 
-func (l *DefaultLitraLib) LightTempUp(deviceIndex int, inc int) {
-	lib.LightTempUp(deviceIndex, inc)
+func (l *DefaultLitraLib) SendFunction(deviceIndex int, feature protocol.FeatureID, function protocol.Function, params []byte) (lib.RawReport, []lib.RawReport, error) {
+	return lib.SendFunction(deviceIndex, feature, function, params)
 }
 
-func (l *DefaultLitraLib) ListDevices() []lib.DiscoveredDevice {
+func (l *DefaultLitraLib) Identify(ctx context.Context, deviceIndex int) error {
+	return lib.Identify(ctx, deviceIndex)
+}
+
+func (l *DefaultLitraLib) ListDevices() ([]lib.DiscoveredDevice, error) {
 	return lib.ListDevices()
 }
 
+func (l *DefaultLitraLib) DeviceInfo(deviceIndex int) (lib.DiscoveredDevice, error) {
+	return lib.DeviceInfo(deviceIndex)
+}
+
+// ResolveDevice looks spec up as an alias from the config file before resolving it as an index,
+// serial number or model name.
+func (l *DefaultLitraLib) ResolveDevice(spec string) (int, error) {
+	if _, err := strconv.Atoi(spec); err != nil {
+		if serial := config.GetAlias(spec); serial != "" {
+			index, err := lib.ResolveDevice(serial)
+			if err != nil {
+				return 0, fmt.Errorf("alias %s: %w", spec, err)
+			}
+			return index, nil
+		}
+	}
+	return lib.ResolveDevice(spec)
+}
+
+func (l *DefaultLitraLib) SetAlias(alias string, serial string) {
+	if l.skipConfig("set alias %s to %s", alias, serial) {
+		return
+	}
+	config.SetAlias(alias, serial)
+}
+
+func (l *DefaultLitraLib) RemoveAlias(alias string) bool {
+	if l.skipConfig("remove alias %s", alias) {
+		// Aliases are saved in lower case, see config.SetAlias
+		_, ok := config.GetAliases()[strings.ToLower(alias)]
+		return ok
+	}
+	return config.RemoveAlias(alias)
+}
+
+func (l *DefaultLitraLib) GetAliases() map[string]string {
+	return config.GetAliases()
+}
+
+func (l *DefaultLitraLib) GetCurve(id string) string {
+	return config.GetCurve(id)
+}
+
+func (l *DefaultLitraLib) SetCurve(id string, curve string) {
+	if l.skipConfig("set the brightness curve of %s to %s", id, curve) {
+		return
+	}
+	config.SetCurve(id, curve)
+}
+
+func (l *DefaultLitraLib) GetCalibration(id string) map[string]string {
+	return config.GetCalibration(id)
+}
+
+func (l *DefaultLitraLib) SetCalibration(id string, options map[string]string) {
+	if l.skipConfig("set the calibration of %s to %v", id, options) {
+		return
+	}
+	config.SetCalibration(id, options)
+}
+
+// SetDryRun sets the dry-run mode of the lib package, and of the config file updates made by the commands
+func (l *DefaultLitraLib) SetDryRun(mode lib.DryRun) {
+	l.dryRun = mode
+	lib.SetDryRun(mode, os.Stdout)
+}
+
+// skipConfig prints the config file change described by format and returns true when a dry run leaves
+// the config file alone
+func (l *DefaultLitraLib) skipConfig(format string, args ...any) bool {
+	if l.dryRun != lib.DryRunOn {
+		return false
+	}
+	fmt.Printf("Dry run: would "+format+" in the config file\n", args...)
+	return true
+}
+
 // libImpl is the variable that will hold the implementation of the LitraLib interface.
 // It is initialized with the default implementation.
 var libImpl LitraLib = &DefaultLitraLib{}
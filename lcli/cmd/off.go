@@ -30,8 +30,8 @@ var offCmd = &cobra.Command{
 	Use:   "off",
 	Short: "Turn lights off",
 	Long:  `Turns all connected Litra devices (Glow and Beam) Off`,
-	Run: func(cmd *cobra.Command, args []string) {
-		libImpl.LightOff(deviceIndex)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return libImpl.LightOff(deviceIndex)
 	},
 }
 
@@ -30,8 +30,8 @@ var onCmd = &cobra.Command{
 	Use:   "on",
 	Short: "Turn lights on",
 	Long:  `Turns all connected Litra devices (Glow and Beam) On`,
-	Run: func(cmd *cobra.Command, args []string) {
-		libImpl.LightOn(deviceIndex)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return libImpl.LightOn(deviceIndex)
 	},
 }
 
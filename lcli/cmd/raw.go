@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/spf13/cobra"
+)
+
+var rawFeature string
+var rawFunction string
+
+var rawCmd = &cobra.Command{
+	Use:   "raw <bytes>...",
+	Short: "Sends a raw HID++ report to a light and shows the response",
+	Long: `Sends a HID++ report to the light selected with -d, padded with zeros to 20 bytes, and prints
+the reports the light answers with, decoded where possible. Bytes are given in hex, e.g.
+'lcli raw -d 1 11 ff 04 1c 01' turns the light on if the illumination feature is at index 4.
+With --feature and --function the bytes are the parameters of a function, and the index of the
+feature is looked up on the light, e.g. 'lcli raw -d 1 --feature illumination --function SetPower 01'.
+Features and functions are given by name or number, e.g. --feature 0x1990 --function 0x1c.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if deviceIndex == 0 {
+			fmt.Println("Select the light to send the report to with -d")
+			return nil
+		}
+		data, err := parseHexBytes(args)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+
+		var sent lib.RawReport
+		var responses []lib.RawReport
+		if rawFeature == "" && rawFunction == "" {
+			if len(data) == 0 {
+				fmt.Println("Specify the bytes of the report, or --feature and --function")
+				return nil
+			}
+			sent, responses, err = libImpl.SendRaw(deviceIndex, data)
+		} else {
+			feature, function, parseErr := parseFeatureFunction(rawFeature, rawFunction)
+			if parseErr != nil {
+				fmt.Println(parseErr)
+				return nil
+			}
+			sent, responses, err = libImpl.SendFunction(deviceIndex, feature, function, data)
+		}
+		if err != nil {
+			return err
+		}
+
+		printRawReport(">", sent)
+		for _, response := range responses {
+			printRawReport("<", response)
+		}
+		if len(responses) == 0 {
+			fmt.Println("  No response")
+		}
+		return nil
+	},
+}
+
+// parseHexBytes parses bytes written in hex, either one per argument or several run together,
+// with or without a 0x prefix
+func parseHexBytes(args []string) ([]byte, error) {
+	var data []byte
+	for _, arg := range args {
+		digits := strings.TrimPrefix(strings.ToLower(arg), "0x")
+		if len(digits)%2 == 1 {
+			digits = "0" + digits
+		}
+		decoded, err := hex.DecodeString(digits)
+		if err != nil || len(digits) == 0 {
+			return nil, fmt.Errorf("invalid byte %q, expected hex such as 1c or 0x1c", arg)
+		}
+		data = append(data, decoded...)
+	}
+	return data, nil
+}
+
+// parseFeatureFunction parses a feature and one of its functions, each given by name or number
+func parseFeatureFunction(featureSpec string, functionSpec string) (protocol.FeatureID, protocol.Function, error) {
+	if featureSpec == "" || functionSpec == "" {
+		return 0, 0, fmt.Errorf("--feature and --function must be given together")
+	}
+	feature, ok := protocol.LookupFeature(featureSpec)
+	if !ok {
+		id, err := strconv.ParseUint(featureSpec, 0, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown feature %q, expected a name such as illumination or an ID such as 0x1990", featureSpec)
+		}
+		feature = protocol.FeatureID(id)
+	}
+	function, ok := protocol.LookupFunction(feature, functionSpec)
+	if !ok {
+		code, err := strconv.ParseUint(functionSpec, 0, 8)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown function %q of feature %s, expected a name such as SetPower or a code such as 0x1c", functionSpec, feature)
+		}
+		function = protocol.Function(code)
+	}
+	return feature, function, nil
+}
+
+// printRawReport prints a report in hex, followed by its meaning when known
+func printRawReport(direction string, report lib.RawReport) {
+	line := fmt.Sprintf("  %s % x", direction, report.Data)
+	if report.Decoded != "" {
+		line += "  " + report.Decoded
+	}
+	fmt.Println(line)
+}
+
+func init() {
+	rootCmd.AddCommand(rawCmd)
+
+	rawCmd.Flags().StringVar(&rawFeature, "feature", "", "Feature to address by name or ID, e.g. illumination or 0x1990")
+	rawCmd.Flags().StringVar(&rawFunction, "function", "", "Function of the feature by name or code, e.g. SetPower or 0x1c")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var replaySpeed float64
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Re-sends the packets of a trace recorded with LLGD_TRACE",
+	Long: `Re-sends the packets written to the lights in a trace recorded with LLGD_TRACE=<file>, with the
+original timing or faster or slower with --speed, e.g. 'lcli replay session.jsonl --speed 2'. A --speed
+of 0 sends the packets without waiting. Packets go to the lights they were recorded for, found by serial
+number, or all to the light selected with -d. Feature indices can differ between models, so only
+redirect a trace to a light of the same model. Press Ctrl+C to stop the replay.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replaySpeed < 0 {
+			fmt.Printf("Speed must be 0 or more, not %g\n", replaySpeed)
+			return nil
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		records, err := lib.ReadTrace(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = libImpl.Replay(ctx, records, deviceIndex, replaySpeed)
+		// Interrupting a replay leaves the lights as the packets sent so far set them, like stopping a fade
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "Replay speed, e.g. 2 for twice as fast or 0 for no waits")
+}
@@ -22,13 +22,30 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
 	"os"
 
+	"github.com/kharyam/go-litra-driver/lib"
 	"github.com/spf13/cobra"
 )
 
+// deviceSpec is the --device flag as given, deviceIndex the device it resolves to
+var deviceSpec string
 var deviceIndex int
 
+// dryRunSpec is the --dry-run flag: on, off or state
+var dryRunSpec string
+
+// Exit codes used when a command fails, so scripts can tell failures apart
+const (
+	exitError          = 1
+	exitNoDevices      = 2
+	exitDeviceNotFound = 3
+	exitOpenFailed     = 4
+	exitWriteFailed    = 5
+	exitPartialFailure = 6
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "lcli",
@@ -38,18 +55,61 @@ device using the commands described below.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Arguments have been validated at this point, so don't print usage for device errors
+		cmd.SilenceUsage = true
+
+		// Set before resolving the device, which opens the lights
+		if cmd.Flags().Changed("dry-run") {
+			mode, err := lib.ParseDryRun(dryRunSpec)
+			if err != nil {
+				return err
+			}
+			libImpl.SetDryRun(mode)
+		}
+
+		if !cmd.Flags().Changed("device") {
+			deviceIndex = 0
+			return nil
+		}
+		var err error
+		deviceIndex, err = libImpl.ResolveDevice(deviceSpec)
+		return err
+	},
+}
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, lib.ErrPartialWrite):
+		return exitPartialFailure
+	case errors.Is(err, lib.ErrNoDevices):
+		return exitNoDevices
+	case errors.Is(err, lib.ErrDeviceNotFound), errors.Is(err, lib.ErrAmbiguousDevice):
+		return exitDeviceNotFound
+	case errors.Is(err, lib.ErrOpenFailed):
+		return exitOpenFailed
+	case errors.Is(err, lib.ErrWriteFailed), errors.Is(err, lib.ErrShortWrite):
+		return exitWriteFailed
+	default:
+		return exitError
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	lib.Close()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().IntVarP(&deviceIndex, "device", "d", 0,
-		"Device index to control (0=all, 1+=specific device). Use 'devices' command to list.")
+	rootCmd.PersistentFlags().StringVarP(&deviceSpec, "device", "d", "0",
+		"Device to control: index (0=all, 1+=specific device), serial number, model name, port:<usb port> or alias. Use 'devices' command to list.")
+	rootCmd.PersistentFlags().StringVar(&dryRunSpec, "dry-run", "off",
+		"Print the devices and packets a command would send without writing to the lights or the config file. Use --dry-run=state to still update the config file.")
+	rootCmd.PersistentFlags().Lookup("dry-run").NoOptDefVal = "on"
 }
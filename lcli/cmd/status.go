@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kharyam/go-litra-driver/lib"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the power, brightness, light output and temperature of the lights",
+	Long: `Reads the state of each light directly from the device, including its light output in lumens,
+e.g. 'lcli status' or 'lcli -d 2 status'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		devices, err := libImpl.ListDevices()
+		if len(devices) == 0 && err == nil {
+			fmt.Println("No Litra devices found.")
+			return nil
+		}
+		for _, d := range devices {
+			if deviceIndex != 0 && d.Index != deviceIndex {
+				continue
+			}
+			state, stateErr := libImpl.QueryState(d.Index)
+			if stateErr != nil {
+				fmt.Printf("  %d: Litra %s (serial: %s): state unavailable\n", d.Index, d.Name, d.Serial)
+				err = errors.Join(err, stateErr)
+				continue
+			}
+			printDeviceState(d, state)
+		}
+		return err
+	},
+	Args: cobra.NoArgs,
+}
+
+// printDeviceState prints the state of a light on one line
+func printDeviceState(d lib.DiscoveredDevice, state lib.DeviceState) {
+	power := "off"
+	if state.Power == 1 {
+		power = "on"
+	}
+	fmt.Printf("  %d: Litra %s (serial: %s): %s, %d%% (%d lm), %dK\n",
+		d.Index, d.Name, d.Serial, power, state.Brightness, state.Lumens, state.Temperature)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
@@ -23,6 +23,7 @@ package cmd
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -31,23 +32,29 @@ import (
 // tempCmd represents the temp command
 var tempCmd = &cobra.Command{
 	Use:   "temp",
-	Short: "Sets the temperature of the lights (2700 - 6500)",
-	Long:  `Sets the light temperature.  Valid values are 2700 - 6500 `,
-	Run: func(cmd *cobra.Command, args []string) {
+	Short: "Sets the temperature of the lights in Kelvin",
+	Long:  `Sets the light temperature in Kelvin. Temperatures outside the range of a light are clamped to it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		temp, err := strconv.Atoi(args[0])
 		if err != nil {
 			temp = -1
 		}
-		if temp < 2700 || temp > 6500 {
-			fmt.Printf("Temperature must be a value between 2700 and 6500, not %s", args[0])
+		if !isTemperature(temp) {
+			fmt.Printf("Temperature must be a positive number of Kelvin, not %s\n", args[0])
 		} else {
-			libImpl.LightTemperature(deviceIndex, uint16(temp))
+			return libImpl.LightTemperature(deviceIndex, uint16(temp))
 		}
-
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
 
+// isTemperature returns true if kelvin can be sent to a light. The range of each model is left to lib,
+// which clamps temperatures to it.
+func isTemperature(kelvin int) bool {
+	return kelvin > 0 && kelvin <= math.MaxUint16
+}
+
 func init() {
 	rootCmd.AddCommand(tempCmd)
 
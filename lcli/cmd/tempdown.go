@@ -36,7 +36,7 @@ var tempdownCmd = &cobra.Command{
 
 # Decrement temperature by 100k
 lcli tempdown 100`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		temp, err := strconv.Atoi(args[0])
 		if err != nil {
 			temp = -1
@@ -44,8 +44,9 @@ lcli tempdown 100`,
 		if temp < 1 {
 			fmt.Printf("Temperature decrement must be a value greater than 0, not %s", args[0])
 		} else {
-			libImpl.LightTempDown(deviceIndex, temp)
+			return libImpl.LightTempDown(deviceIndex, temp)
 		}
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
@@ -36,7 +36,7 @@ var tempupCmd = &cobra.Command{
 
 # Increment temperature by 100K
 lcli tempup 100`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		temp, err := strconv.Atoi(args[0])
 		if err != nil {
 			temp = -1
@@ -44,8 +44,9 @@ lcli tempup 100`,
 		if temp < 1 {
 			fmt.Printf("Temperature increment must be a value greater than 0, not %s", args[0])
 		} else {
-			libImpl.LightTempUp(deviceIndex, temp)
+			return libImpl.LightTempUp(deviceIndex, temp)
 		}
+		return nil
 	},
 	Args: cobra.ExactArgs(1),
 }
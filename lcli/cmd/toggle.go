@@ -9,16 +9,21 @@ import (
 var toggleCmd = &cobra.Command{
 	Use:   "toggle",
 	Short: "Toggles the light on or off",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		_, _, currentPower := libImpl.ReadCurrentState(deviceIndex)
 
 		if currentPower == 1 {
-			libImpl.LightOff(deviceIndex)
+			if err := libImpl.LightOff(deviceIndex); err != nil {
+				return err
+			}
 			fmt.Println("Light turned off")
 		} else {
-			libImpl.LightOn(deviceIndex)
+			if err := libImpl.LightOn(deviceIndex); err != nil {
+				return err
+			}
 			fmt.Println("Light turned on")
 		}
+		return nil
 	},
 }
 
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image/color"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -18,6 +23,59 @@ import (
 
 var selectedDeviceIndex int = 0
 
+// presetFadeDuration is how long applying a preset takes when "Fade" is checked
+const presetFadeDuration = 2 * time.Second
+
+// reportError shows an error dialog when a light command fails
+func reportError(err error, window fyne.Window) {
+	if err != nil {
+		dialog.ShowError(err, window)
+	}
+}
+
+// deviceOptions returns the device selector entries for the connected devices
+func deviceOptions(devices []lib.DiscoveredDevice) []string {
+	options := []string{"All Devices"}
+	for _, d := range devices {
+		options = append(options, fmt.Sprintf("Device %d: Litra %s", d.Index, d.Name))
+	}
+	return options
+}
+
+// deviceInfoText describes a light for the device info panel
+func deviceInfoText(d lib.DiscoveredDevice) string {
+	firmware := d.Firmware
+	if firmware == "" {
+		firmware = "unknown"
+	}
+	port := d.Port
+	if port == "" {
+		port = "unknown"
+	}
+	return fmt.Sprintf("Litra %s (serial: %s)\nFirmware: %s\nHID path: %s (interface %d, USB port %s)\nBrightness: %d-%d (raw)\nTemperature: %d-%dK",
+		d.Name, d.Serial, firmware, d.Path, d.Interface, port,
+		d.BrightnessRange.Min, d.BrightnessRange.Max, d.TemperatureRange.Min, d.TemperatureRange.Max)
+}
+
+// hasBackLight returns true if the device at deviceIndex, or any device for 0, has an RGB back light
+func hasBackLight(devices []lib.DiscoveredDevice, deviceIndex int) bool {
+	for _, d := range devices {
+		if deviceIndex != 0 && d.Index != deviceIndex {
+			continue
+		}
+		if product, ok := lib.LookupProduct(d.ProductID); ok && product.HasBackLight() {
+			return true
+		}
+	}
+	return false
+}
+
+// backLightColor converts a color from the color picker to a back light color
+func backLightColor(c color.Color) lib.Color {
+	r, g, b, _ := c.RGBA()
+	return lib.Color{Red: uint8(r >> 8), Green: uint8(g >> 8), Blue: uint8(b >> 8)}
+}
+
 //go:generate fyne bundle -o icons.go Icon.png
 func main() {
 	application := app.NewWithID("net.khary.lcui")
@@ -34,10 +92,10 @@ func main() {
 				mainWindow.Hide()
 			}),
 			fyne.NewMenuItem("Off", func() {
-				lib.LightOff(0)
+				reportError(lib.LightOff(0), mainWindow)
 			}),
 			fyne.NewMenuItem("On", func() {
-				lib.LightOn(0)
+				reportError(lib.LightOn(0), mainWindow)
 			}),
 		)
 		desk.SetSystemTrayMenu(systrayMenu)
@@ -50,9 +108,9 @@ func main() {
 	// Power
 	powerRadio := widget.NewRadioGroup([]string{"Off", "On"}, func(power string) {
 		if power == "Off" {
-			lib.LightOff(selectedDeviceIndex)
+			reportError(lib.LightOff(selectedDeviceIndex), mainWindow)
 		} else {
-			lib.LightOn(selectedDeviceIndex)
+			reportError(lib.LightOn(selectedDeviceIndex), mainWindow)
 		}
 	})
 	powerRadio.Horizontal = true
@@ -72,16 +130,33 @@ func main() {
 	tempGroup := container.New(layout.NewVBoxLayout(), tempLabel, tempSlider)
 
 	// Device Selector
-	devices := lib.ListDevices()
-	deviceOptions := []string{"All Devices"}
-	for _, d := range devices {
-		deviceOptions = append(deviceOptions, fmt.Sprintf("Device %d: Litra %s", d.Index, d.Name))
-	}
+	devices, err := lib.ListDevices()
+	reportError(err, mainWindow)
 	deviceLabel := widget.NewLabel("Device:")
-	deviceSelector := widget.NewSelect(deviceOptions, func(selection string) {
+	identifyButton := widget.NewButton("Identify", nil)
+	infoLabel := widget.NewLabel("")
+	backLightButton := widget.NewButton("Back Light Color...", func() {
+		picker := dialog.NewColorPicker("Back Light Color", "Color of every back light zone", func(c color.Color) {
+			reportError(lib.BackLightColor(selectedDeviceIndex, lib.AllZones, backLightColor(c)), mainWindow)
+		}, mainWindow)
+		picker.Advanced = true
+		picker.Show()
+	})
+	// Only lights with an RGB back light, such as the Beam LX, get a color picker
+	updateBackLightButton := func() {
+		if hasBackLight(devices, selectedDeviceIndex) {
+			backLightButton.Show()
+		} else {
+			backLightButton.Hide()
+		}
+	}
+	deviceSelector := widget.NewSelect(deviceOptions(devices), func(selection string) {
 		if selection == "All Devices" {
 			selectedDeviceIndex = 0
+			identifyButton.Disable()
+			infoLabel.SetText("Select a device to see its details")
 		} else {
+			identifyButton.Enable()
 			// Parse index from "Device N: ..."
 			parts := strings.SplitN(selection, ":", 2)
 			if len(parts) > 0 {
@@ -90,9 +165,15 @@ func main() {
 					selectedDeviceIndex = idx
 				}
 			}
+			if info, err := lib.DeviceInfo(selectedDeviceIndex); err != nil {
+				infoLabel.SetText(fmt.Sprintf("Unable to read device details: %v", err))
+			} else {
+				infoLabel.SetText(deviceInfoText(info))
+			}
 		}
+		updateBackLightButton()
 		// Refresh UI from selected device's state
-		bright, temp, power := config.ReadCurrentState(selectedDeviceIndex)
+		bright, temp, power := lib.ReadCurrentState(selectedDeviceIndex)
 		brightnessSlider.SetValue(float64(bright))
 		brightnessLabel.SetText(fmt.Sprintf("Brightness %d%%", int(bright)))
 		tempSlider.SetValue(float64(temp))
@@ -103,8 +184,43 @@ func main() {
 			powerRadio.SetSelected("Off")
 		}
 	})
+	identifyButton.OnTapped = func() {
+		// Blink in the background; the button stays disabled until the light is restored
+		identifyButton.Disable()
+		deviceIndex := selectedDeviceIndex
+		go func() {
+			err := lib.Identify(context.Background(), deviceIndex)
+			fyne.Do(func() {
+				reportError(err, mainWindow)
+				if selectedDeviceIndex != 0 {
+					identifyButton.Enable()
+				}
+			})
+		}()
+	}
 	deviceSelector.SetSelected("All Devices")
-	deviceGroup := container.New(layout.NewHBoxLayout(), deviceLabel, deviceSelector)
+	deviceGroup := container.New(layout.NewHBoxLayout(), deviceLabel, deviceSelector, identifyButton, backLightButton)
+	infoCard := widget.NewCard("Device Info", "", infoLabel)
+
+	// Update the device selector as lights are plugged in and unplugged
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	go func() {
+		for range lib.Watch(watchCtx) {
+			// Devices that fail to open are reported by ListDevices
+			lib.Refresh()
+			connected, err := lib.ListDevices()
+			fyne.Do(func() {
+				reportError(err, mainWindow)
+				devices = connected
+				options := deviceOptions(devices)
+				deviceSelector.SetOptions(options)
+				if !slices.Contains(options, deviceSelector.Selected) {
+					deviceSelector.SetSelected("All Devices")
+				}
+				updateBackLightButton()
+			})
+		}
+	}()
 
 	// Profiles
 	profileNew := widget.NewButton("New...", func() {
@@ -116,6 +232,8 @@ func main() {
 	profileDelete.Disable()
 	profileNew.Enable()
 	profileLabel := widget.NewLabel("Preset:")
+	profileFade := widget.NewCheck("Fade", nil)
+	var cancelFade context.CancelFunc = func() {}
 	profileSelector := widget.NewSelect(config.GetProfileNames(), func(selection string) {
 		if selection == config.CurrentProfileName {
 			profileNew.Enable()
@@ -123,14 +241,27 @@ func main() {
 		} else {
 			profileNew.Disable()
 			profileDelete.Enable()
-			bright, temp, power := config.ReadProfile(selection)
+			bright, temp, _ := config.ReadProfile(selection)
 			brightnessSlider.SetValue(float64(bright))
 			brightnessLabel.SetText(fmt.Sprintf("Brightness %d%%", int(bright)))
 			tempSlider.SetValue(float64(temp))
 			tempLabel.SetText(fmt.Sprintf("Temperature %dk", uint16(temp)))
-			config.UpdateCurrentState(selectedDeviceIndex, bright, temp, power)
-			lib.LightBrightness(selectedDeviceIndex, bright)
-			lib.LightTemperature(selectedDeviceIndex, uint16(temp))
+			cancelFade()
+			if profileFade.Checked {
+				// Fade in the background so the window stays responsive; picking another preset cancels it
+				var fadeCtx context.Context
+				fadeCtx, cancelFade = context.WithCancel(context.Background())
+				deviceIndex := selectedDeviceIndex
+				go func() {
+					err := lib.Transition(fadeCtx, deviceIndex, bright, temp, presetFadeDuration, lib.EaseInOut)
+					if err != nil && !errors.Is(err, context.Canceled) {
+						fyne.Do(func() { reportError(err, mainWindow) })
+					}
+				}()
+			} else {
+				reportError(lib.LightBrightness(selectedDeviceIndex, bright), mainWindow)
+				reportError(lib.LightTemperature(selectedDeviceIndex, uint16(temp)), mainWindow)
+			}
 		}
 	})
 	profileDelete.OnTapped = func() {
@@ -145,14 +276,14 @@ func main() {
 
 	profileNew.OnTapped = func() {
 		dialog.ShowEntryDialog("New Profile", "Name", func(profileName string) {
-			_, _, currentPower := config.ReadCurrentState(selectedDeviceIndex)
+			_, _, currentPower := lib.ReadCurrentState(selectedDeviceIndex)
 			config.AddOrUpdateProfile(profileName, int(brightnessSlider.Value), int(tempSlider.Value), currentPower)
 			profileSelector.SetOptions(config.GetProfileNames())
 			profileSelector.SetSelected(profileName)
 		}, mainWindow)
 	}
 	profileSelector.SetSelected(config.CurrentProfileName)
-	profileGroup := container.New(layout.NewHBoxLayout(), profileLabel, profileSelector, profileNew, profileDelete)
+	profileGroup := container.New(layout.NewHBoxLayout(), profileLabel, profileSelector, profileFade, profileNew, profileDelete)
 
 	// Exit
 	exitButton := widget.NewButton("Exit", func() {
@@ -168,21 +299,21 @@ func main() {
 	}
 
 	brightnessSlider.OnChangeEnded = func(brightness float64) {
-		lib.LightBrightness(selectedDeviceIndex, int(brightness))
+		reportError(lib.LightBrightness(selectedDeviceIndex, int(brightness)), mainWindow)
 		brightnessLabel.SetText(fmt.Sprintf("Brightness %d%%", int(brightness)))
-		_, _, currentPower := config.ReadCurrentState(selectedDeviceIndex)
+		_, _, currentPower := lib.ReadCurrentState(selectedDeviceIndex)
 		config.AddOrUpdateProfile(profileSelector.Selected, int(brightness), -1, currentPower)
 	}
 
 	tempSlider.OnChangeEnded = func(temp float64) {
-		lib.LightTemperature(selectedDeviceIndex, uint16(temp))
+		reportError(lib.LightTemperature(selectedDeviceIndex, uint16(temp)), mainWindow)
 		tempLabel.SetText(fmt.Sprintf("Temperature %dk", uint16(temp)))
-		_, _, currentPower := config.ReadCurrentState(selectedDeviceIndex)
+		_, _, currentPower := lib.ReadCurrentState(selectedDeviceIndex)
 		config.AddOrUpdateProfile(profileSelector.Selected, -1, int(temp), currentPower)
 	}
 
 	// Set Current Values
-	currentBright, currentTemp, currentPower := config.ReadCurrentState(selectedDeviceIndex)
+	currentBright, currentTemp, currentPower := lib.ReadCurrentState(selectedDeviceIndex)
 	brightnessSlider.SetValue(float64(currentBright))
 	tempSlider.SetValue(float64(currentTemp))
 	brightnessLabel.SetText(fmt.Sprintf("Brightness %d%%", int(currentBright)))
@@ -194,9 +325,12 @@ func main() {
 	}
 
 	// Add all widgets to the container
-	mainGroup := container.New(layout.NewVBoxLayout(), deviceGroup, powerGroup, profileGroup, brightnessGroup, tempGroup, exitButton)
+	mainGroup := container.New(layout.NewVBoxLayout(), deviceGroup, infoCard, powerGroup, profileGroup, brightnessGroup, tempGroup, exitButton)
 
 	mainWindow.SetContent(mainGroup)
 
 	mainWindow.ShowAndRun()
+	cancelFade()
+	stopWatching()
+	lib.Close()
 }
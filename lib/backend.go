@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// BackendEnv selects the HID backend: "hid" talks to real lights through hidapi, "hidraw" talks to
+// them through the Linux hidraw device nodes without cgo and "sim" uses the Simulator configured by
+// SimDevicesEnv and SimStateEnv. By default hid is used when it is part of the build, and hidraw
+// otherwise.
+const BackendEnv = "LLGD_BACKEND"
+
+func init() {
+	if err := UseBackend(os.Getenv(BackendEnv)); err != nil {
+		log.Error().Msgf("Ignoring %s: %v", BackendEnv, err)
+		if err := UseBackend(""); err != nil {
+			defaultHIDEnumerator = noBackend{err}
+			defaultHIDOpener = noBackend{err}
+		}
+	}
+}
+
+// UseBackend switches the backend used to enumerate and open lights ("hid", "hidraw" or "sim", with
+// an empty name choosing hid or hidraw as described for BackendEnv). Devices held open by the
+// package-level functions are released first.
+func UseBackend(name string) error {
+	var enumerator HIDEnumerator
+	var opener HIDOpener
+	var err error
+	switch name {
+	case "":
+		if enumerator, opener, err = hidapiBackend(); err != nil {
+			var hidrawErr error
+			if enumerator, opener, hidrawErr = hidrawBackend(); hidrawErr == nil {
+				err = nil
+			}
+		}
+	case "hid":
+		enumerator, opener, err = hidapiBackend()
+	case "hidraw":
+		enumerator, opener, err = hidrawBackend()
+	case "sim":
+		var simulator *Simulator
+		simulator, err = NewSimulatorFromEnv()
+		enumerator, opener = simulator, simulator
+	default:
+		err = fmt.Errorf("unknown backend %q, expected hid, hidraw or sim", name)
+	}
+	if err != nil {
+		return err
+	}
+	Close()
+	defaultHIDEnumerator = enumerator
+	defaultHIDOpener = opener
+	return nil
+}
+
+// noBackend is installed when no backend is available, so that every lookup reports why
+type noBackend struct {
+	err error
+}
+
+func (b noBackend) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error {
+	return b.err
+}
+
+func (b noBackend) Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error) {
+	return nil, b.err
+}
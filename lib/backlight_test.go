@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readSimulatedState returns the persisted state of a simulated light
+func readSimulatedState(t *testing.T, statePath string, serial string) simulatedState {
+	data, err := os.ReadFile(statePath)
+	assert.NoError(t, err)
+	var states map[string]simulatedState
+	assert.NoError(t, json.Unmarshal(data, &states))
+	return states[serial]
+}
+
+// Test colors are parsed from #rrggbb
+func TestParseColor(t *testing.T) {
+	color, err := ParseColor("#ff8800")
+	assert.NoError(t, err)
+	assert.Equal(t, Color{Red: 0xff, Green: 0x88, Blue: 0x00}, color)
+	assert.Equal(t, "#ff8800", color.String())
+
+	color, err = ParseColor("0A0b0C")
+	assert.NoError(t, err)
+	assert.Equal(t, Color{Red: 0x0a, Green: 0x0b, Blue: 0x0c}, color)
+
+	for _, invalid := range []string{"", "#fff", "#ff88001", "orange", "#gg8800", "#-f8800"} {
+		_, err = ParseColor(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// Test the back light is controlled on the Beam LX and lights without one are skipped or rejected
+func TestBackLight(t *testing.T) {
+	statePath, cleanup := setupSimulatorTest(t, "glow:SIM1,beam lx:SIM3")
+	defer cleanup()
+
+	orange := Color{Red: 0xff, Green: 0x88}
+	assert.NoError(t, BackLightOn(0))
+	assert.NoError(t, BackLightBrightness(0, 150))
+	assert.NoError(t, BackLightColor(0, AllZones, orange))
+	assert.NoError(t, BackLightColor(2, 3, Color{Blue: 0xff}))
+
+	state := readSimulatedState(t, statePath, "SIM3")
+	assert.Equal(t, byte(1), state.BackPower)
+	assert.Equal(t, byte(100), state.BackBrightness)
+	expected := slices.Repeat([]string{"#ff8800"}, 7)
+	expected[2] = "#0000ff"
+	assert.Equal(t, expected, state.BackColors)
+
+	assert.ErrorIs(t, BackLightOn(1), ErrFeatureNotSupported)
+	assert.ErrorContains(t, BackLightColor(2, 8, orange), "zones 1-7, not 8")
+	assert.ErrorIs(t, BackLightOff(3), ErrDeviceNotFound)
+
+	assert.NoError(t, BackLightOff(2))
+	assert.Equal(t, byte(0), readSimulatedState(t, statePath, "SIM3").BackPower)
+}
+
+// Test back light commands fail when no connected light has a back light
+func TestBackLightUnsupported(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1,beam:SIM2")
+	defer cleanup()
+
+	assert.ErrorIs(t, BackLightOn(0), ErrFeatureNotSupported)
+	glow, _ := LookupProduct(GlowProductID)
+	assert.False(t, glow.HasBackLight())
+	beamLX, _ := LookupProduct(BeamLXProductID)
+	assert.True(t, beamLX.HasBackLight())
+}
@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kharyam/go-litra-driver/config"
+	"github.com/rs/zerolog/log"
+)
+
+// CalibrationPoint maps a requested value to the value sent to the light
+type CalibrationPoint struct {
+	In  float64
+	Out float64
+}
+
+// Calibration corrects a light so that lights of different models or batches set to the same values
+// match. Requested temperatures are shifted by TempOffset Kelvin, and the light output is multiplied
+// by BrightScale. A table replaces the offset or scale with a piecewise linear mapping: TempTable maps
+// Kelvin to Kelvin and BrightTable maps percentages of the light output to percentages.
+// The zero Calibration changes nothing.
+type Calibration struct {
+	TempOffset  int
+	BrightScale float64 // 0 means 1
+	TempTable   []CalibrationPoint
+	BrightTable []CalibrationPoint
+}
+
+// ParseCalibration parses the calibration options of a light, as stored in the config file.
+// Tables are written as comma separated in:out pairs, e.g. "2700:2600,6500:6300", with increasing
+// values in both columns.
+func ParseCalibration(options map[string]string) (Calibration, error) {
+	var calibration Calibration
+	var err error
+	if value := options[config.TempOffset]; value != "" {
+		if calibration.TempOffset, err = strconv.Atoi(value); err != nil {
+			return Calibration{}, fmt.Errorf("invalid %s %q, expected Kelvin such as -150", config.TempOffset, value)
+		}
+	}
+	if value := options[config.BrightScale]; value != "" {
+		calibration.BrightScale, err = strconv.ParseFloat(value, 64)
+		if err != nil || calibration.BrightScale <= 0 || calibration.BrightScale > 10 {
+			return Calibration{}, fmt.Errorf("invalid %s %q, expected a multiplier such as 0.9", config.BrightScale, value)
+		}
+	}
+	if calibration.TempTable, err = parseCalibrationTable(config.TempTable, options[config.TempTable]); err != nil {
+		return Calibration{}, err
+	}
+	if calibration.BrightTable, err = parseCalibrationTable(config.BrightTable, options[config.BrightTable]); err != nil {
+		return Calibration{}, err
+	}
+	return calibration, nil
+}
+
+// parseCalibrationTable parses a table of in:out pairs, returning nil for an empty table
+func parseCalibrationTable(option string, value string) ([]CalibrationPoint, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var table []CalibrationPoint
+	for _, pair := range strings.Split(value, ",") {
+		in, out, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		inValue, inErr := strconv.ParseFloat(in, 64)
+		outValue, outErr := strconv.ParseFloat(out, 64)
+		if !ok || inErr != nil || outErr != nil {
+			return nil, fmt.Errorf("invalid %s entry %q, expected in:out", option, pair)
+		}
+		if len(table) > 0 && (inValue <= table[len(table)-1].In || outValue <= table[len(table)-1].Out) {
+			return nil, fmt.Errorf("invalid %s %q, both columns must increase", option, value)
+		}
+		table = append(table, CalibrationPoint{In: inValue, Out: outValue})
+	}
+	if len(table) < 2 {
+		return nil, fmt.Errorf("invalid %s %q, at least two in:out pairs are needed", option, value)
+	}
+	return table, nil
+}
+
+// Options returns the calibration as config options, the inverse of ParseCalibration. Unset values
+// are returned as empty strings so they can be removed from the config file.
+func (c Calibration) Options() map[string]string {
+	options := map[string]string{config.TempOffset: "", config.BrightScale: "", config.TempTable: "", config.BrightTable: ""}
+	if c.TempOffset != 0 {
+		options[config.TempOffset] = strconv.Itoa(c.TempOffset)
+	}
+	if c.BrightScale != 0 && c.BrightScale != 1 {
+		options[config.BrightScale] = strconv.FormatFloat(c.BrightScale, 'f', -1, 64)
+	}
+	options[config.TempTable] = formatCalibrationTable(c.TempTable)
+	options[config.BrightTable] = formatCalibrationTable(c.BrightTable)
+	return options
+}
+
+// formatCalibrationTable writes a table as in:out pairs
+func formatCalibrationTable(table []CalibrationPoint) string {
+	pairs := make([]string, len(table))
+	for i, point := range table {
+		pairs[i] = strconv.FormatFloat(point.In, 'f', -1, 64) + ":" + strconv.FormatFloat(point.Out, 'f', -1, 64)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// IsZero returns true if the calibration changes nothing
+func (c Calibration) IsZero() bool {
+	return c.TempOffset == 0 && (c.BrightScale == 0 || c.BrightScale == 1) && c.TempTable == nil && c.BrightTable == nil
+}
+
+// temperature returns the temperature to send to the light for a requested temperature
+func (c Calibration) temperature(kelvin int) int {
+	if c.TempTable != nil {
+		return int(math.Round(lookupTable(c.TempTable, float64(kelvin))))
+	}
+	return kelvin + c.TempOffset
+}
+
+// requestedTemperature returns the requested temperature a temperature reported by a light of the model
+// was set for. Since the calibrated temperature is clamped and rounded to the steps of the model before it
+// is sent, the step of the model next to the uncalibrated temperature that is sent as kelvin is preferred,
+// so that reading the temperature and setting it again, or stepping it up and down, does not drift.
+// The result is always within the range of the model.
+func (c Calibration) requestedTemperature(product Product, kelvin int) int {
+	requested := kelvin - c.TempOffset
+	if c.TempTable != nil {
+		inverse := make([]CalibrationPoint, len(c.TempTable))
+		for i, point := range c.TempTable {
+			inverse[i] = CalibrationPoint{In: point.Out, Out: point.In}
+		}
+		requested = int(math.Round(lookupTable(inverse, float64(kelvin))))
+	}
+
+	limits := product.Temperature
+	step := max(product.TemperatureStep, 1)
+	below := limits.Min + int(math.Floor(float64(requested-limits.Min)/float64(step)))*step
+	candidates := []int{below, below + step}
+	if requested-below > below+step-requested {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	for _, candidate := range candidates {
+		candidate = min(max(candidate, limits.Min), limits.Max)
+		if int(product.clampTemperature(c.temperature(candidate))) == kelvin {
+			return candidate
+		}
+	}
+	return min(max(requested, limits.Min), limits.Max)
+}
+
+// output returns the fraction of the raw brightness range to send for a requested fraction (0 to 1)
+func (c Calibration) output(fraction float64) float64 {
+	switch {
+	case c.BrightTable != nil:
+		fraction = lookupTable(c.BrightTable, fraction*100) / 100
+	case c.BrightScale != 0:
+		fraction *= c.BrightScale
+	}
+	return min(max(fraction, 0), 1)
+}
+
+// curve returns the brightness curve of a light with this calibration, given its uncalibrated curve
+// (nil for linear). It returns nil when both are linear.
+func (c Calibration) curve(base Curve) Curve {
+	if c.BrightTable == nil && (c.BrightScale == 0 || c.BrightScale == 1) {
+		return base
+	}
+	if base == nil {
+		base = Linear
+	}
+	return func(level float64) float64 {
+		return c.output(base(level))
+	}
+}
+
+// rawLumens returns the raw brightness to send to a light of the model for lm lumens
+func (c Calibration) rawLumens(product Product, lm int) uint16 {
+	raw := product.rawLumens(lm)
+	span := float64(product.Brightness.Max - product.Brightness.Min)
+	if span <= 0 {
+		return raw
+	}
+	fraction := c.output(float64(int(raw)-product.Brightness.Min) / span)
+	return uint16(product.Brightness.Min + int(math.Round(fraction*span)))
+}
+
+// lumens returns the requested light output a raw brightness reported by a light of the model was set for
+func (c Calibration) lumens(product Product, raw uint16) int {
+	span := float64(product.Brightness.Max - product.Brightness.Min)
+	if span <= 0 || c.curve(nil) == nil {
+		return product.lumens(raw)
+	}
+	fraction := min(max(float64(int(raw)-product.Brightness.Min)/span, 0), 1)
+	requested := invertCurve(c.output, fraction)
+	return product.lumens(uint16(product.Brightness.Min + int(math.Round(requested*span))))
+}
+
+// lookupTable maps value through a table, extrapolating from the first or last two points outside it
+func lookupTable(table []CalibrationPoint, value float64) float64 {
+	i, _ := slices.BinarySearchFunc(table, value, func(point CalibrationPoint, value float64) int {
+		switch {
+		case point.In < value:
+			return -1
+		case point.In > value:
+			return 1
+		}
+		return 0
+	})
+	i = min(max(i, 1), len(table)-1)
+	low, high := table[i-1], table[i]
+	return low.Out + (value-low.In)*(high.Out-low.Out)/(high.In-low.In)
+}
+
+// loadCalibration returns the calibration configured for the light with the given identity
+func loadCalibration(id string) Calibration {
+	calibration, err := ParseCalibration(defaultConfigUpdater.ReadCalibration(id))
+	if err != nil {
+		log.Warn().Msgf("Ignoring the calibration of %s: %v", id, err)
+		return Calibration{}
+	}
+	return calibration
+}
@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/config"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test calibration options are parsed and written back unchanged
+func TestParseCalibration(t *testing.T) {
+	options := map[string]string{
+		config.TempOffset:  "-150",
+		config.BrightScale: "0.9",
+		config.TempTable:   "2700:2650,6500:6300",
+		config.BrightTable: "0:0,50:40,100:95",
+	}
+	calibration, err := ParseCalibration(options)
+	assert.NoError(t, err)
+	assert.Equal(t, Calibration{
+		TempOffset:  -150,
+		BrightScale: 0.9,
+		TempTable:   []CalibrationPoint{{In: 2700, Out: 2650}, {In: 6500, Out: 6300}},
+		BrightTable: []CalibrationPoint{{In: 0, Out: 0}, {In: 50, Out: 40}, {In: 100, Out: 95}},
+	}, calibration)
+	assert.Equal(t, options, calibration.Options())
+	assert.False(t, calibration.IsZero())
+
+	calibration, err = ParseCalibration(map[string]string{})
+	assert.NoError(t, err)
+	assert.True(t, calibration.IsZero())
+	assert.Equal(t, map[string]string{config.TempOffset: "", config.BrightScale: "", config.TempTable: "", config.BrightTable: ""},
+		calibration.Options())
+
+	for _, invalid := range []map[string]string{
+		{config.TempOffset: "cold"},
+		{config.BrightScale: "0"},
+		{config.BrightScale: "-1"},
+		{config.TempTable: "2700:2650"},
+		{config.TempTable: "2700-2650,6500-6300"},
+		{config.BrightTable: "0:0,50:60,100:50"},
+		{config.BrightTable: "50:40,0:0"},
+	} {
+		_, err := ParseCalibration(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// Test calibrated values are converted back to the requested values when read from a light
+func TestCalibrationReadBack(t *testing.T) {
+	beam, _ := LookupProduct(BeamProductID)
+
+	for _, calibration := range []Calibration{
+		{TempOffset: -200, BrightScale: 0.9},
+		{TempTable: []CalibrationPoint{{In: 2700, Out: 2700}, {In: 6500, Out: 6100}},
+			BrightTable: []CalibrationPoint{{In: 0, Out: 0}, {In: 50, Out: 40}, {In: 100, Out: 95}}},
+	} {
+		for _, curve := range []Curve{nil, Perceptual} {
+			brightness := target{product: beam, curve: curve, calibration: calibration}.brightnessCurve()
+			for level := 10; level <= 100; level++ {
+				assert.InDelta(t, level, beam.brightnessLevel(beam.rawBrightness(level, brightness), brightness), 1)
+			}
+		}
+		for lm := beam.Lumens.Min; lm <= beam.Lumens.Max; lm += 10 {
+			assert.InDelta(t, lm, calibration.lumens(beam, calibration.rawLumens(beam, lm)), 2)
+		}
+		for kelvin := 2700; kelvin <= 6500; kelvin += 100 {
+			sent := int(beam.clampTemperature(calibration.temperature(kelvin)))
+			back := calibration.requestedTemperature(beam, sent)
+			if sent == calibration.temperature(kelvin) {
+				assert.Equal(t, kelvin, back)
+			}
+			assert.Equal(t, sent, int(beam.clampTemperature(calibration.temperature(back))), "%dK is set again as sent", kelvin)
+		}
+	}
+
+	// Values beyond a table follow its first or last segment
+	table := Calibration{TempTable: []CalibrationPoint{{In: 3000, Out: 2900}, {In: 5000, Out: 4900}}}
+	assert.Equal(t, 6400, table.temperature(6500))
+	assert.Equal(t, 2600, table.temperature(2700))
+}
+
+// Test the calibration of a light is read from the config file, ignoring invalid calibrations
+func TestLoadCalibration(t *testing.T) {
+	originalConfigUpdater := defaultConfigUpdater
+	defer func() { defaultConfigUpdater = originalConfigUpdater }()
+	mockConfigUpdater := new(MockConfigUpdater)
+	defaultConfigUpdater = mockConfigUpdater
+
+	mockConfigUpdater.On("ReadCalibration", "ABC").Return(map[string]string{config.TempOffset: "-150"}).Once()
+	mockConfigUpdater.On("ReadCalibration", "DEF").Return(map[string]string{config.BrightScale: "dim"}).Once()
+
+	assert.Equal(t, Calibration{TempOffset: -150}, loadCalibration("ABC"))
+	assert.Equal(t, Calibration{}, loadCalibration("DEF"))
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test commands are calibrated per light, leaving uncalibrated lights and the saved state alone
+func TestLightCalibrated(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	controller := getDefaultController()
+	controller.devices[0].calibration = Calibration{TempOffset: -200, BrightScale: 0.9} // the Beam
+
+	beamBytes := protocol.Encode(protocol.SetTemperature{Kelvin: 4800})
+	glowBytes := protocol.Encode(protocol.SetTemperature{Kelvin: 5000})
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, 5000, -1).Once()
+	assert.NoError(t, LightTemperature(0, 5000))
+
+	// 90% of the Beam's range of 30-400
+	beamBytes = protocol.Encode(protocol.SetBrightness{Raw: 363})
+	glowBytes = brightnessReport(GlowProductID, 100)
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", 100, -1, -1).Once()
+	assert.NoError(t, LightBrightness(0, 100))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test an offset that is not a multiple of the temperature step reads back the requested temperature,
+// so relative changes do not drift, and never reads back a temperature outside the model's range
+func TestCalibrationOffsetBetweenSteps(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1")
+	defer cleanup()
+	getDefaultController().devices[0].calibration = Calibration{TempOffset: -150}
+
+	assertTemperature := func(requested int) {
+		t.Helper()
+		state, err := QueryState(1)
+		assert.NoError(t, err)
+		assert.Equal(t, requested, state.Temperature)
+	}
+
+	// 3850K is rounded to 3900K, which reads back as 4000K rather than 4050K
+	assert.NoError(t, LightTemperature(1, 4000))
+	assertTemperature(4000)
+	for _, want := range []int{4100, 4200, 4300} {
+		assert.NoError(t, LightTempUp(1, 100))
+		assertTemperature(want)
+	}
+	for _, want := range []int{4200, 4100, 4000} {
+		assert.NoError(t, LightTempDown(1, 100))
+		assertTemperature(want)
+	}
+
+	assert.NoError(t, LightTemperature(1, 6500))
+	assertTemperature(6500)
+}
@@ -0,0 +1,619 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Controller keeps connected Litra devices open so that many commands can be issued without
+// enumerating and opening the devices again. Devices are enumerated when the controller is created
+// and on Refresh. A Controller is safe for concurrent use.
+type Controller struct {
+	mu      sync.Mutex
+	openMu  sync.Mutex // held while a device is reopened, see reopen
+	devices []*discoveredDeviceInternal
+	policy  *RetryPolicy            // nil for DefaultRetryPolicy
+	stats   map[string]*DeviceStats // keyed by device identity, see deviceIDs
+}
+
+// legacyStateMigration counts the devices index-keyed state in the config file was last converted for.
+// It is converted again when more devices are connected, since sections of indices beyond the
+// connected devices are kept until a device with that index shows up.
+var legacyStateMigration struct {
+	sync.Mutex
+	devices int
+}
+
+// NewController enumerates and opens all connected Litra devices. Devices that fail to open are
+// reported in the returned error (wrapping ErrOpenFailed); the controller is usable regardless
+// and retries opening them on the next command. Call Close to release the devices.
+func NewController() (*Controller, error) {
+	c := &Controller{}
+	return c, c.Refresh()
+}
+
+// Refresh re-enumerates the connected devices. Handles of devices that are still connected are kept,
+// new devices are opened and disconnected devices are closed. Indices are reassigned by serial number.
+// Lights are recognized by serial number, or by serial number and USB port when their serial number
+// is empty or shared with another light (see deviceIDs).
+func (c *Controller) Refresh() error {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	enumerated := enumerateDevices()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing := make(map[string]*discoveredDeviceInternal, len(c.devices))
+	for _, d := range c.devices {
+		existing[d.metadata.ID] = d
+	}
+
+	var opened []*discoveredDeviceInternal
+	devices := make([]*discoveredDeviceInternal, 0, len(enumerated))
+	for _, metadata := range enumerated {
+		d, ok := existing[metadata.ID]
+		delete(existing, metadata.ID)
+		if ok && d.device != nil {
+			d.metadata = metadata
+			devices = append(devices, d)
+			continue
+		}
+
+		log.Debug().Msgf("Found device %s (serial: %s, location: %s)", metadata.Name, metadata.Serial, metadata.location())
+		d = &discoveredDeviceInternal{metadata: metadata, stats: c.deviceStats(metadata.ID, metadata)}
+		opened = append(opened, d)
+		devices = append(devices, d)
+	}
+
+	// Settings of lights that are no longer identified by serial number alone are moved before they are loaded
+	identities := make(map[string]string)
+	for _, d := range opened {
+		if d.metadata.ID != d.metadata.Serial {
+			identities[d.metadata.ID] = d.metadata.Serial
+		}
+	}
+	if len(identities) > 0 && savesState() {
+		defaultConfigUpdater.MigrateDeviceIdentities(identities)
+	}
+
+	var openErrors []error
+	for _, d := range opened {
+		if err := c.reopen(d); err != nil {
+			openErrors = append(openErrors, err)
+		}
+	}
+
+	// Anything left over has been disconnected
+	for _, d := range existing {
+		if d.device != nil {
+			d.device.Close()
+		}
+	}
+
+	c.devices = devices
+
+	if savesState() {
+		migrateLegacyState(enumerated)
+	}
+
+	return errors.Join(openErrors...)
+}
+
+// migrateLegacyState converts index-keyed state in the config file when more devices are connected
+// than it was last converted for
+func migrateLegacyState(enumerated []DiscoveredDevice) {
+	legacyStateMigration.Lock()
+	defer legacyStateMigration.Unlock()
+	if len(enumerated) <= legacyStateMigration.devices {
+		return
+	}
+	legacyStateMigration.devices = len(enumerated)
+
+	ids := make([]string, len(enumerated))
+	for i, metadata := range enumerated {
+		ids[i] = metadata.ID
+	}
+	defaultConfigUpdater.MigrateDeviceSections(ids)
+}
+
+// Close closes all open device handles
+func (c *Controller) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, d := range c.devices {
+		if d.device != nil {
+			errs = append(errs, d.device.Close())
+			d.device = nil
+		}
+	}
+	c.devices = nil
+	return errors.Join(errs...)
+}
+
+// isEmpty returns true when the controller knows of no devices
+func (c *Controller) isEmpty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.devices) == 0
+}
+
+// ListDevices returns the connected Litra devices with their metadata. Devices that could not be
+// opened are omitted from the list and reported in the returned error.
+func (c *Controller) ListDevices() ([]DiscoveredDevice, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result = []DiscoveredDevice{}
+	var openErrors []error
+	for _, d := range c.devices {
+		if d.device == nil {
+			openErrors = append(openErrors, d.openErr)
+			continue
+		}
+		result = append(result, d.metadata)
+	}
+	return result, errors.Join(openErrors...)
+}
+
+// reopen closes the handle of a device, if any, and opens it again. Must be called with c.mu held.
+// Devices are written to in parallel, but reopened one at a time since hidapi does not document
+// enumerating and opening devices as safe from several threads.
+func (c *Controller) reopen(d *discoveredDeviceInternal) error {
+	c.openMu.Lock()
+	defer c.openMu.Unlock()
+	return c.reopenDevice(d)
+}
+
+// reopenDevice reopens a device. Must be called with c.mu and c.openMu held.
+func (c *Controller) reopenDevice(d *discoveredDeviceInternal) error {
+	if d.device != nil {
+		d.device.Close()
+		d.device = nil
+	}
+	d.features = nil
+	d.device, d.openErr = openDevice(d.metadata)
+	if d.openErr != nil {
+		return d.openErr
+	}
+	d.curve = loadCurve(d.metadata.ID)
+	d.calibration = loadCalibration(d.metadata.ID)
+
+	// Look up the illumination feature straight away, so a light that cannot be controlled is
+	// reported like one that cannot be opened. A dry run does not ask the device.
+	if dryRun() != DryRunOff {
+		return nil
+	}
+	if _, err := featureIndex(d, protocol.IlluminationFeature); err != nil {
+		d.device.Close()
+		d.device = nil
+		d.openErr = fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	return d.openErr
+}
+
+// targets returns the devices addressed by deviceIndex. Must be called with c.mu held.
+// deviceIndex 0 targets all devices, 1+ targets a specific device.
+func (c *Controller) targets(deviceIndex int) ([]*discoveredDeviceInternal, error) {
+	if len(c.devices) == 0 {
+		return nil, ErrNoDevices
+	}
+	if deviceIndex == 0 {
+		return c.devices, nil
+	}
+	for _, d := range c.devices {
+		if d.metadata.Index == deviceIndex {
+			return []*discoveredDeviceInternal{d}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no device with index %d", ErrDeviceNotFound, deviceIndex)
+}
+
+// stateKey returns the identity under which the state of deviceIndex is saved in the config file.
+// deviceIndex 0 (all devices) and unknown indices map to the shared state.
+func (c *Controller) stateKey(deviceIndex int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, d := range c.devices {
+		if deviceIndex != 0 && d.metadata.Index == deviceIndex {
+			return d.metadata.ID
+		}
+	}
+	return ""
+}
+
+// ResolveDevice returns the device index addressed by spec. Numeric specs are returned as-is, with
+// "all" and the empty string meaning 0 (all devices), and "port:<port>" addresses the light on a USB
+// port (e.g. port:1-2.3). Otherwise spec is matched case-insensitively against the identities of lights
+// with an empty or shared serial number (e.g. ABC123@1-2.3, see DiscoveredDevice.ID), serial numbers and then
+// model names ("beam", "glow" or "Litra Beam"); a serial number or model name matching several devices
+// returns ErrAmbiguousDevice.
+func (c *Controller) ResolveDevice(spec string) (int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "all") {
+		return 0, nil
+	}
+	if index, err := strconv.Atoi(spec); err == nil {
+		if index < 0 {
+			return 0, fmt.Errorf("%w: invalid device index %d", ErrDeviceNotFound, index)
+		}
+		return index, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.targets(0); err != nil {
+		return 0, err
+	}
+
+	if port, ok := strings.CutPrefix(spec, "port:"); ok {
+		for _, d := range c.devices {
+			if d.metadata.Port == port {
+				return d.metadata.Index, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: no device on USB port %s", ErrDeviceNotFound, port)
+	}
+	for _, d := range c.devices {
+		if d.metadata.ID != d.metadata.Serial && strings.EqualFold(d.metadata.ID, spec) {
+			return d.metadata.Index, nil
+		}
+	}
+
+	var matches []DiscoveredDevice
+	for _, d := range c.devices {
+		if strings.EqualFold(d.metadata.Serial, spec) {
+			matches = append(matches, d.metadata)
+		}
+	}
+	if len(matches) > 1 {
+		return 0, fmt.Errorf("%w: serial number %q is shared by %d devices, use port:<port> instead", ErrAmbiguousDevice, spec, len(matches))
+	}
+	if len(matches) == 0 {
+		model := strings.TrimPrefix(strings.ToLower(spec), "litra ")
+		for _, d := range c.devices {
+			if strings.EqualFold(d.metadata.Name, model) {
+				matches = append(matches, d.metadata)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("%w: no device matching %q", ErrDeviceNotFound, spec)
+	case 1:
+		return matches[0].Index, nil
+	default:
+		return 0, fmt.Errorf("%w: %q matches %d devices, use a serial number or alias instead", ErrAmbiguousDevice, spec, len(matches))
+	}
+}
+
+// send writes a command to a device, addressed to the index of its feature on that device, and
+// returns the number of bytes written. Devices that are not open are opened first. In a dry run
+// the command is printed instead. Must be called with c.mu held, and only for one device at a time.
+func (c *Controller) send(d *discoveredDeviceInternal, cmd protocol.Command) (int, error) {
+	if d.device == nil {
+		if err := c.reopen(d); err != nil {
+			return 0, err
+		}
+	}
+	if dryRun() != DryRunOff {
+		return dryRunSend(d, cmd), nil
+	}
+	header, err := featureHeader(d, cmd.Feature())
+	if err != nil {
+		return 0, err
+	}
+	return c.write(d, protocol.EncodeWith(header, cmd))
+}
+
+// WriteResult is the outcome of sending a command to one light
+type WriteResult struct {
+	Index  int
+	Name   string
+	Serial string
+	Bytes  int   // bytes written to the light
+	Err    error // nil when the light was updated
+}
+
+// WriteError is returned when a command could not be written to some or all of the targeted lights.
+// It wraps the error of each light that failed, and ErrPartialWrite when other lights were updated.
+type WriteError struct {
+	Results []WriteResult // one per targeted light, in index order
+}
+
+// Updated returns the number of lights that were updated
+func (e *WriteError) Updated() int {
+	updated := 0
+	for _, r := range e.Results {
+		if r.Err == nil {
+			updated++
+		}
+	}
+	return updated
+}
+
+// Error describes the failed lights, e.g. "2 of 3 lights updated; failed to write to device: ...".
+// A single targeted light is described by its error alone.
+func (e *WriteError) Error() string {
+	var failures []string
+	for _, r := range e.Results {
+		if r.Err != nil {
+			failures = append(failures, r.Err.Error())
+		}
+	}
+	if len(e.Results) == 1 {
+		return failures[0]
+	}
+	return fmt.Sprintf("%d of %d lights updated; %s", e.Updated(), len(e.Results), strings.Join(failures, "; "))
+}
+
+// Unwrap returns the errors of the failed lights, and ErrPartialWrite when other lights were updated
+func (e *WriteError) Unwrap() []error {
+	var errs []error
+	for _, r := range e.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	if e.Updated() > 0 {
+		errs = append(errs, ErrPartialWrite)
+	}
+	return errs
+}
+
+// sendAll sends commands[i] to devices[i], writing to all of the devices at the same time so a
+// change reaches every light together. The commands of one device are sent in order, stopping at
+// the first failure. A dry run goes through the devices one at a time, so they are printed in order.
+// Must be called with c.mu held.
+func (c *Controller) sendAll(devices []*discoveredDeviceInternal, commands [][]protocol.Command) []WriteResult {
+	results := make([]WriteResult, len(devices))
+	sendDevice := func(i int, d *discoveredDeviceInternal) {
+		for _, cmd := range commands[i] {
+			n, err := c.send(d, cmd)
+			results[i].Bytes += n
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+		}
+	}
+
+	concurrent := dryRun() == DryRunOff
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		results[i] = WriteResult{Index: d.metadata.Index, Name: d.metadata.Name, Serial: d.metadata.Serial}
+		if !concurrent {
+			sendDevice(i, d)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendDevice(i, d)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// writeError returns a *WriteError when any of the results failed, nil otherwise
+func writeError(results []WriteResult) error {
+	for _, r := range results {
+		if r.Err != nil {
+			return &WriteError{Results: results}
+		}
+	}
+	return nil
+}
+
+// command sends a command to the devices addressed by deviceIndex, building it for each device.
+// deviceIndex 0 writes to all devices at the same time, deviceIndex > 0 writes only to the matching device.
+// It returns ErrNoDevices when nothing is connected and ErrDeviceNotFound when deviceIndex matches
+// no device. When writing fails for any device it returns a *WriteError wrapping ErrOpenFailed,
+// ErrFeatureNotSupported, ErrWriteFailed or ErrShortWrite errors, and ErrPartialWrite when other
+// devices were updated.
+func (c *Controller) command(build commandBuilder, deviceIndex int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return err
+	}
+
+	commands := make([][]protocol.Command, len(devices))
+	for i, d := range devices {
+		commands[i] = []protocol.Command{build(d.target())}
+	}
+	return writeError(c.sendAll(devices, commands))
+}
+
+// commandBuilder returns the command to send to a light, so that values can be scaled, calibrated and
+// clamped to what each model supports
+type commandBuilder func(t target) protocol.Command
+
+// powerCommand returns the command switching a light on (LightOnCode) or off (LightOffCode)
+func powerCommand(code byte) commandBuilder {
+	return func(target) protocol.Command {
+		return protocol.SetPower{On: code == LightOnCode}
+	}
+}
+
+// brightnessCommand returns the command setting the brightness to level (0-100) of the model's range,
+// following the brightness curve and calibration of the light
+func brightnessCommand(level int) commandBuilder {
+	return func(t target) protocol.Command {
+		return protocol.SetBrightness{Raw: t.product.rawBrightness(level, t.brightnessCurve())}
+	}
+}
+
+// lumensCommand returns the command setting the light output to lm lumens
+func lumensCommand(lm int) commandBuilder {
+	return func(t target) protocol.Command {
+		return protocol.SetBrightness{Raw: t.calibration.rawLumens(t.product, lm)}
+	}
+}
+
+// temperatureCommand returns the command setting the temperature to temp Kelvin, calibrated, then
+// clamped to the model's range and rounded to its step
+func temperatureCommand(temp uint16) commandBuilder {
+	return func(t target) protocol.Command {
+		calibrated := t.calibration.temperature(int(temp))
+		kelvin := t.product.clampTemperature(calibrated)
+		if int(kelvin) != calibrated {
+			log.Debug().Msgf("Litra %s supports %d-%dK in steps of %d, using %dK instead of %dK", t.product.Name,
+				t.product.Temperature.Min, t.product.Temperature.Max, t.product.TemperatureStep, kelvin, calibrated)
+		}
+		return protocol.SetTemperature{Kelvin: kelvin}
+	}
+}
+
+// temperatureRange returns the temperatures supported by all of the devices addressed by deviceIndex
+func (c *Controller) temperatureRange(deviceIndex int) Range {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limits := Range{Min: 0, Max: math.MaxUint16}
+	devices, _ := c.targets(deviceIndex)
+	for _, d := range devices {
+		product := d.product()
+		limits.Min = max(limits.Min, product.Temperature.Min)
+		limits.Max = min(limits.Max, product.Temperature.Max)
+	}
+	return limits
+}
+
+// LightOn turns on lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightOn(deviceIndex int) error {
+	if err := c.command(powerCommand(LightOnCode), deviceIndex); err != nil {
+		return err
+	}
+	updateCurrentState(c.stateKey(deviceIndex), -1, -1, 1)
+	return nil
+}
+
+// LightOff turns off lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightOff(deviceIndex int) error {
+	if err := c.command(powerCommand(LightOffCode), deviceIndex); err != nil {
+		return err
+	}
+	updateCurrentState(c.stateKey(deviceIndex), -1, -1, 0)
+	return nil
+}
+
+// LightBrightness sets the brightness of lights. Specify a brightness between 0 and 100, which is
+// mapped onto the range of each model through the brightness curve of the light. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightBrightness(deviceIndex int, level int) error {
+	level = min(max(level, 0), 100)
+	if err := c.command(brightnessCommand(level), deviceIndex); err != nil {
+		return err
+	}
+	updateCurrentState(c.stateKey(deviceIndex), level, -1, -1)
+	return nil
+}
+
+// LightLumens sets the light output of lights in lumens. Lights of different models are set to the
+// same output, so lm must be within the lumen range of every targeted model or ErrOutOfRange is
+// returned without changing any light. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightLumens(deviceIndex int, lm int) error {
+	level, err := c.lumensLevel(deviceIndex, lm)
+	if err != nil {
+		return err
+	}
+	if err := c.command(lumensCommand(lm), deviceIndex); err != nil {
+		return err
+	}
+	updateCurrentState(c.stateKey(deviceIndex), level, -1, -1)
+	return nil
+}
+
+// lumensLevel checks lm against the lumen range of the devices addressed by deviceIndex and returns
+// the brightness level it sets the first of them to, which is saved as the brightness
+func (c *Controller) lumensLevel(deviceIndex int, lm int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range devices {
+		product := d.product()
+		if lm < product.Lumens.Min || lm > product.Lumens.Max {
+			return 0, fmt.Errorf("%w: the Litra %s (serial: %s) supports %d-%d lm, not %d lm", ErrOutOfRange,
+				product.Name, d.metadata.Serial, product.Lumens.Min, product.Lumens.Max, lm)
+		}
+	}
+	t := devices[0].target()
+	return t.product.brightnessLevel(t.calibration.rawLumens(t.product, lm), t.brightnessCurve()), nil
+}
+
+// LightBrightDown decreases the brightness by the amount specified.
+// deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightBrightDown(deviceIndex int, inc int) error {
+	brightness, _, _ := c.ReadCurrentState(deviceIndex)
+	brightness -= inc
+
+	if brightness < 1 {
+		brightness = 0
+	}
+
+	return c.LightBrightness(deviceIndex, brightness)
+}
+
+// LightBrightUp increases the brightness by the amount specified.
+// deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightBrightUp(deviceIndex int, inc int) error {
+	brightness, _, _ := c.ReadCurrentState(deviceIndex)
+	brightness += inc
+
+	if brightness > 100 {
+		brightness = 100
+	}
+
+	return c.LightBrightness(deviceIndex, brightness)
+}
+
+// LightTemperature sets a light temperature in Kelvin. Temperatures outside the range of a model
+// (see Product.Temperature) are clamped to it. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightTemperature(deviceIndex int, temp uint16) error {
+	limits := c.temperatureRange(deviceIndex)
+	temp = uint16(min(max(int(temp), limits.Min), limits.Max))
+	if err := c.command(temperatureCommand(temp), deviceIndex); err != nil {
+		return err
+	}
+	updateCurrentState(c.stateKey(deviceIndex), -1, int(temp), -1)
+	return nil
+}
+
+// LightTempDown decreases the temperature by the amount specified, down to the lowest temperature
+// of the targeted lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightTempDown(deviceIndex int, inc int) error {
+	_, temp, _ := c.ReadCurrentState(deviceIndex)
+	temp -= inc
+
+	limits := c.temperatureRange(deviceIndex)
+	return c.LightTemperature(deviceIndex, uint16(min(max(temp, limits.Min), limits.Max)))
+}
+
+// LightTempUp increases the temperature by the amount specified, up to the highest temperature
+// of the targeted lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func (c *Controller) LightTempUp(deviceIndex int, inc int) error {
+	_, temp, _ := c.ReadCurrentState(deviceIndex)
+	temp += inc
+
+	limits := c.temperatureRange(deviceIndex)
+	return c.LightTemperature(deviceIndex, uint16(min(max(temp, limits.Min), limits.Max)))
+}
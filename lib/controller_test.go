@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test that a controller enumerates once and keeps handles open across commands
+func TestControllerReusesHandles(t *testing.T) {
+	mockDevice1, mockDevice2, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	tempBytes := []byte{0x11, 0xff, 0x04, 0x9c, 0x0f, 0xa0, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	mockDevice1.On("Write", onBytes).Return(len(onBytes), nil).Once()
+	mockDevice1.On("Write", tempBytes).Return(len(tempBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, -1, 1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, 4000, -1).Once()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	assert.NoError(t, controller.LightOn(1))
+	assert.NoError(t, controller.LightTemperature(1, 4000))
+
+	// Enumerate and Open are set up to succeed only once per device
+	mockEnumerator.AssertExpectations(t)
+	mockOpener.AssertExpectations(t)
+	mockDevice1.AssertNotCalled(t, "Close")
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+
+	assert.NoError(t, controller.Close())
+	mockDevice1.AssertCalled(t, "Close")
+	mockDevice2.AssertCalled(t, "Close")
+	mockDevice1.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test that a failed write reopens the device and is retried transparently
+func TestControllerReopensAfterFailedWrite(t *testing.T) {
+	mockDevice1, _, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	offBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOffCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	reopenedDevice := new(MockHIDDevice)
+	mockDevice1.On("Write", offBytes).Return(0, errors.New("stale handle")).Once()
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	mockOpener.On("Open", uint16(VendorId), uint16(0xc901), "test-serial-Beam").Return(reopenedDevice, nil).Once()
+	reopenedDevice.On("Write", offBytes).Return(len(offBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, -1, 0).Once()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	assert.NoError(t, controller.LightOff(1))
+
+	mockDevice1.AssertCalled(t, "Close")
+	mockDevice1.AssertExpectations(t)
+	reopenedDevice.AssertExpectations(t)
+	mockOpener.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test that all targeted lights are written to at the same time: the write to the Beam only
+// returns once the Glow has been written to, which would time out if the writes were sequential
+func TestControllerWritesConcurrently(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	glowWritten := make(chan struct{})
+	mockDevice1.On("Write", onBytes).Return(len(onBytes), nil).Run(func(mock.Arguments) {
+		select {
+		case <-glowWritten:
+		case <-time.After(time.Second):
+			t.Error("the Glow was not written to while the Beam write was in progress")
+		}
+	}).Once()
+	mockDevice2.On("Write", onBytes).Return(len(onBytes), nil).Run(func(mock.Arguments) {
+		close(glowWritten)
+	}).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, -1, 1).Once()
+
+	assert.NoError(t, LightOn(0))
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+}
+
+// Test that a command reaching only some of the lights reports the result of each light
+func TestControllerPartialWrite(t *testing.T) {
+	mockDevice1, mockDevice2, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	mockDevice1.On("Write", onBytes).Return(0, errors.New("write timeout")).Twice()
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	mockOpener.On("Open", uint16(VendorId), uint16(0xc901), "test-serial-Beam").Return(mockDevice1, nil).Once()
+	mockDevice2.On("Write", onBytes).Return(len(onBytes), nil).Once()
+
+	err := LightOn(0)
+
+	assert.ErrorIs(t, err, ErrPartialWrite)
+	assert.ErrorIs(t, err, ErrWriteFailed)
+	var writeErr *WriteError
+	assert.True(t, errors.As(err, &writeErr))
+	assert.Equal(t, 1, writeErr.Updated())
+	assert.Len(t, writeErr.Results, 2)
+	assert.Equal(t, "test-serial-Beam", writeErr.Results[0].Serial)
+	assert.ErrorContains(t, writeErr.Results[0].Err, "write timeout")
+	assert.Equal(t, WriteResult{Index: 2, Name: "Glow", Serial: "test-serial-Glow", Bytes: len(onBytes)}, writeErr.Results[1])
+	assert.Equal(t, "1 of 2 lights updated; failed to write to device: device 1 (Litra Beam, serial: test-serial-Beam): write timeout",
+		err.Error())
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// A light that fails on its own is described by its error alone, and is not a partial write
+	mockDevice1.On("Write", onBytes).Return(0, errors.New("write timeout")).Twice()
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	mockOpener.On("Open", uint16(VendorId), uint16(0xc901), "test-serial-Beam").Return(mockDevice1, nil).Once()
+	err = LightOn(1)
+	assert.ErrorIs(t, err, ErrWriteFailed)
+	assert.NotErrorIs(t, err, ErrPartialWrite)
+	assert.Equal(t, "failed to write to device: device 1 (Litra Beam, serial: test-serial-Beam): write timeout", err.Error())
+}
+
+// Test that the package-level functions share the default controller
+func TestDefaultControllerIsReused(t *testing.T) {
+	mockDevice1, mockDevice2, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	mockDevice1.On("Write", onBytes).Return(len(onBytes), nil).Twice()
+	mockDevice2.On("Write", onBytes).Return(len(onBytes), nil).Twice()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, -1, 1).Twice()
+
+	assert.NoError(t, LightOn(0))
+	assert.NoError(t, LightOn(0))
+
+	mockEnumerator.AssertExpectations(t)
+	mockOpener.AssertExpectations(t)
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+
+	assert.NoError(t, Close())
+	assert.Nil(t, defaultController)
+	mockDevice1.AssertCalled(t, "Close")
+	mockDevice2.AssertCalled(t, "Close")
+}
+
+// Test device specifiers resolve by index, serial number and model name
+func TestResolveDevice(t *testing.T) {
+	_, _, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	for spec, expected := range map[string]int{
+		"":                 0,
+		"all":              0,
+		"2":                2,
+		"test-serial-Glow": 2,
+		"TEST-SERIAL-BEAM": 1,
+		"beam":             1,
+		"Litra Glow":       2,
+	} {
+		index, err := controller.ResolveDevice(spec)
+		assert.NoError(t, err, spec)
+		assert.Equal(t, expected, index, spec)
+	}
+
+	_, err = controller.ResolveDevice("desk-left")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	_, err = controller.ResolveDevice("-1")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
+
+// Test a model name shared by several devices is rejected as ambiguous
+func TestResolveDeviceAmbiguous(t *testing.T) {
+	controller := &Controller{devices: []*discoveredDeviceInternal{
+		{metadata: DiscoveredDevice{Index: 1, Name: "Beam", Serial: "A"}},
+		{metadata: DiscoveredDevice{Index: 2, Name: "Beam", Serial: "B"}},
+	}}
+
+	_, err := controller.ResolveDevice("beam")
+	assert.ErrorIs(t, err, ErrAmbiguousDevice)
+
+	index, err := controller.ResolveDevice("b")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, index)
+
+	_, err = (&Controller{}).ResolveDevice("beam")
+	assert.ErrorIs(t, err, ErrNoDevices)
+}
+
+// Test that index-keyed state in the config file is migrated in enumeration order, and again only
+// when more devices are connected
+func TestControllerMigratesLegacyState(t *testing.T) {
+	_, _, mockEnumerator, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	mockEnumerator.On("Enumerate", uint16(VendorId), mock.Anything, mock.Anything).Return(nil)
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Refresh())
+
+	mockConfigUpdater.AssertCalled(t, "MigrateDeviceSections", []string{"test-serial-Beam", "test-serial-Glow"})
+	mockConfigUpdater.AssertNumberOfCalls(t, "MigrateDeviceSections", 1)
+
+	migrateLegacyState([]DiscoveredDevice{{ID: "A"}})
+	mockConfigUpdater.AssertNumberOfCalls(t, "MigrateDeviceSections", 1)
+	migrateLegacyState([]DiscoveredDevice{{ID: "A"}, {ID: "B"}, {ID: "C"}})
+	mockConfigUpdater.AssertCalled(t, "MigrateDeviceSections", []string{"A", "B", "C"})
+	mockConfigUpdater.AssertNumberOfCalls(t, "MigrateDeviceSections", 2)
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Curve maps a brightness level (0 to 1) to the fraction of the raw brightness range of a light
+// (0 to 1). Curves must be increasing, so that the level can be read back from the light.
+type Curve func(level float64) float64
+
+// Perceptual spaces brightness levels evenly for the eye, following the CIE 1976 lightness (L*)
+func Perceptual(level float64) float64 {
+	lightness := level * 100
+	if lightness > 8 {
+		return math.Pow((lightness+16)/116, 3)
+	}
+	return lightness / 903.3
+}
+
+// Gamma returns the curve raising levels to the power gamma. Gammas above 1 give finer control of
+// low brightness levels, like Perceptual.
+func Gamma(gamma float64) Curve {
+	return func(level float64) float64 {
+		return math.Pow(level, gamma)
+	}
+}
+
+// CurveByName returns the brightness curve with the given name: "linear", "perceptual" or
+// "gamma:<value>", e.g. "gamma:2.2". An empty name is linear.
+func CurveByName(name string) (Curve, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", "linear":
+		return Linear, nil
+	case "perceptual":
+		return Perceptual, nil
+	}
+	if value, ok := strings.CutPrefix(name, "gamma:"); ok {
+		gamma, err := strconv.ParseFloat(value, 64)
+		if err == nil && gamma > 0 && !math.IsInf(gamma, 0) {
+			return Gamma(gamma), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown brightness curve %q, expected linear, perceptual or gamma:<value> (e.g. gamma:2.2)", name)
+}
+
+// loadCurve returns the brightness curve configured for the light with the given identity,
+// falling back to the global curve. It returns nil for linear, which converts levels exactly.
+func loadCurve(id string) Curve {
+	name := strings.TrimSpace(defaultConfigUpdater.ReadCurve(id))
+	if name == "" || strings.EqualFold(name, "linear") {
+		return nil
+	}
+	curve, err := CurveByName(name)
+	if err != nil {
+		log.Warn().Msgf("Ignoring the brightness curve of %s: %v", id, err)
+		return nil
+	}
+	return curve
+}
+
+// invertCurve returns the level at which curve reaches output, by bisection
+func invertCurve(curve Curve, output float64) float64 {
+	low, high := 0.0, 1.0
+	for range 50 {
+		middle := (low + high) / 2
+		if curve(middle) < output {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return (low + high) / 2
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test curves are looked up by name and map the ends of the range onto themselves
+func TestCurveByName(t *testing.T) {
+	for _, name := range []string{"", "linear", "Perceptual", "gamma:2.2", " gamma:0.5 "} {
+		curve, err := CurveByName(name)
+		assert.NoError(t, err, name)
+		assert.InDelta(t, 0, curve(0), 1e-9, name)
+		assert.InDelta(t, 1, curve(1), 1e-9, name)
+		for level := 0.01; level <= 1; level += 0.01 {
+			assert.Greater(t, curve(level), curve(level-0.01), name)
+		}
+	}
+
+	for _, name := range []string{"log", "gamma", "gamma:", "gamma:-1", "gamma:0", "gamma:abc"} {
+		_, err := CurveByName(name)
+		assert.Error(t, err, name)
+	}
+
+	assert.InDelta(t, 0.1842, Perceptual(0.5), 1e-4)
+	assert.InDelta(t, 0.25, Gamma(2)(0.5), 1e-9)
+	assert.InDelta(t, 0.5, invertCurve(Perceptual, Perceptual(0.5)), 1e-9)
+}
+
+// Test brightness levels go through the curve in both directions
+func TestBrightnessCurve(t *testing.T) {
+	beam, _ := LookupProduct(BeamProductID)
+
+	// Half brightness looks half as bright with the perceptual curve, at about 18% of the raw range
+	assert.Equal(t, uint16(98), beam.rawBrightness(50, Perceptual))
+	assert.Equal(t, 50, beam.brightnessLevel(98, Perceptual))
+	assert.Equal(t, uint16(122), beam.rawBrightness(25, nil))
+
+	// Levels read back from the light match the level that was set
+	for _, curve := range []Curve{Perceptual, Gamma(2.2), Gamma(0.5)} {
+		for level := 10; level <= 100; level++ {
+			assert.InDelta(t, level, beam.brightnessLevel(beam.rawBrightness(level, curve), curve), 1)
+		}
+	}
+}
+
+// Test the curve of a light is read from the config file when it is opened
+func TestLoadCurve(t *testing.T) {
+	originalConfigUpdater := defaultConfigUpdater
+	defer func() { defaultConfigUpdater = originalConfigUpdater }()
+	mockConfigUpdater := new(MockConfigUpdater)
+	defaultConfigUpdater = mockConfigUpdater
+
+	mockConfigUpdater.On("ReadCurve", "ABC").Return("perceptual").Once()
+	mockConfigUpdater.On("ReadCurve", "DEF").Return("Linear").Once()
+	mockConfigUpdater.On("ReadCurve", "GHI").Return("sigmoid").Once()
+
+	assert.InDelta(t, Perceptual(0.3), loadCurve("ABC")(0.3), 1e-9)
+	assert.Nil(t, loadCurve("DEF"))
+	assert.Nil(t, loadCurve("GHI"))
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test LightBrightness and relative changes follow the curve of each light
+func TestLightBrightnessCurve(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	controller := getDefaultController()
+	controller.devices[0].curve = Perceptual // the Beam
+
+	glowBytes := brightnessReport(GlowProductID, 50)
+	beamBytes := protocol.Encode(protocol.SetBrightness{Raw: 98})
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", 50, -1, -1).Once()
+
+	assert.NoError(t, LightBrightness(0, 50))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+)
+
+// DryRun selects whether commands reach the lights and the config file
+type DryRun int
+
+const (
+	// DryRunOff sends commands to the lights and saves their state to the config file
+	DryRunOff DryRun = iota
+	// DryRunOn prints the packets that would be sent instead of writing them, and leaves the config file alone
+	DryRunOn
+	// DryRunState prints the packets that would be sent instead of writing them, but updates the config file
+	DryRunState
+)
+
+// ParseDryRun parses a dry-run mode: off (or false), on (or true) or state
+func ParseDryRun(s string) (DryRun, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "false":
+		return DryRunOff, nil
+	case "on", "true":
+		return DryRunOn, nil
+	case "state":
+		return DryRunState, nil
+	default:
+		return DryRunOff, fmt.Errorf("invalid dry-run mode %q, expected on, off or state", s)
+	}
+}
+
+func (m DryRun) String() string {
+	switch m {
+	case DryRunOff:
+		return "off"
+	case DryRunOn:
+		return "on"
+	case DryRunState:
+		return "state"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	dryRunMu     sync.Mutex
+	dryRunMode   DryRun
+	dryRunOutput io.Writer = os.Stdout
+)
+
+// SetDryRun sets the dry-run mode of every controller. While it is on, commands still select the
+// lights and compute their values, but the packets are printed to w (standard output if nil) rather
+// than written, queries fail with ErrDryRun and the config file is only updated in DryRunState.
+// Set it before the first command, since the default controller updates the config file when it is created.
+func SetDryRun(mode DryRun, w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	dryRunMode, dryRunOutput = mode, w
+}
+
+// dryRun returns the current dry-run mode
+func dryRun() DryRun {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	return dryRunMode
+}
+
+// savesState returns true unless a dry run leaves the config file alone
+func savesState() bool {
+	return dryRun() != DryRunOn
+}
+
+// updateCurrentState saves the state of a light to the config file, unless in a dry run
+func updateCurrentState(serial string, brightness int, temperature int, power int) {
+	if savesState() {
+		defaultConfigUpdater.UpdateCurrentState(serial, brightness, temperature, power)
+	}
+}
+
+// printDryRun prints a report that a dry run did not write to a device, with its meaning when known.
+// The feature index is printed as ?? when it is not known.
+func printDryRun(d *discoveredDeviceInternal, report []byte, knownIndex bool, decoded string) {
+	bytes := strings.Fields(fmt.Sprintf("% x", report))
+	if !knownIndex && len(bytes) > 2 {
+		bytes[2] = "??"
+	}
+	line := fmt.Sprintf("Dry run: device %d (Litra %s, serial: %s): %s", d.metadata.Index, d.metadata.Name,
+		d.metadata.Serial, strings.Join(bytes, " "))
+	if decoded != "" {
+		line += "  " + decoded
+	}
+
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	fmt.Fprintln(dryRunOutput, line)
+}
+
+// dryRunSend prints a command instead of sending it to a device and returns the length of its report.
+// A dry run does not ask the device for feature indices, so those not looked up before are taken from
+// the layout of its model (see Product.defaultFeatureIndex).
+func dryRunSend(d *discoveredDeviceInternal, cmd protocol.Command) int {
+	index, known := d.features[cmd.Feature()]
+	if !known {
+		index, known = d.product().defaultFeatureIndex(cmd.Feature())
+	}
+	report := protocol.EncodeWith(protocol.Header{DeviceIndex: hidppDeviceIndex, FeatureIndex: index}, cmd)
+	printDryRun(d, report, known, cmd.String())
+	return len(report)
+}
+
+// dryRunWrite prints a report instead of writing it to a device and returns its length
+func dryRunWrite(d *discoveredDeviceInternal, report []byte) int {
+	printDryRun(d, report, true, describeReport(d, report, true))
+	return len(report)
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test dry-run modes are parsed
+func TestParseDryRun(t *testing.T) {
+	for s, want := range map[string]DryRun{"": DryRunOff, "off": DryRunOff, "false": DryRunOff, "true": DryRunOn, "On": DryRunOn, "state": DryRunState} {
+		mode, err := ParseDryRun(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, mode, s)
+	}
+	_, err := ParseDryRun("maybe")
+	assert.Error(t, err)
+	assert.Equal(t, "state", DryRunState.String())
+}
+
+// Test a dry run prints the packets for every targeted light without writing to the lights or changing the config file
+func TestDryRun(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1,beam:SIM2")
+	defer cleanup()
+	defer SetDryRun(DryRunOff, nil)
+
+	before, err := QueryState(2)
+	assert.NoError(t, err)
+	Close()
+
+	configUpdater := new(MockConfigUpdater)
+	configUpdater.On("ReadCurve", mock.Anything).Return("").Maybe()
+	configUpdater.On("ReadCalibration", mock.Anything).Return(map[string]string{}).Maybe()
+	defaultConfigUpdater = configUpdater
+
+	var output, trace bytes.Buffer
+	SetTracer(NewTracer(&trace))
+	defer SetTracer(nil)
+	SetDryRun(DryRunOn, &output)
+	assert.NoError(t, LightOn(0))
+	assert.NoError(t, LightTemperature(2, 9000))
+	assert.Equal(t, []string{
+		"Dry run: device 1 (Litra Glow, serial: SIM1): 11 ff 04 1c 01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00  SetPower(on=true)",
+		"Dry run: device 2 (Litra Beam, serial: SIM2): 11 ff 04 1c 01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00  SetPower(on=true)",
+		"Dry run: device 2 (Litra Beam, serial: SIM2): 11 ff 04 9c 19 64 00 00 00 00 00 00 00 00 00 00 00 00 00 00  SetTemperature(kelvin=6500)",
+	}, strings.Split(strings.TrimSpace(output.String()), "\n"))
+	// The feature indices come from the layout of the models rather than from the lights
+	assert.Empty(t, trace.String())
+
+	// Queries are not sent either, so the state comes from the config file
+	_, err = QueryState(1)
+	assert.ErrorIs(t, err, ErrQueryFailed)
+	assert.ErrorIs(t, err, ErrDryRun)
+	configUpdater.On("ReadCurrentState", "SIM2").Return(40, 4000, 1).Once()
+	assert.NoError(t, LightBrightUp(2, 10))
+	assert.Contains(t, output.String(), "device 2 (Litra Beam, serial: SIM2)")
+	configUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	configUpdater.AssertNotCalled(t, "MigrateDeviceSections", mock.Anything)
+
+	// Raw reports are printed, with no responses
+	output.Reset()
+	sent, responses, err := SendRaw(1, []byte{0x11, 0xff, 0x04, 0x1c, 0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, protocol.Encode(protocol.SetPower{On: false}), sent.Data)
+	assert.Empty(t, responses)
+	assert.Contains(t, output.String(), "Dry run: device 1 (Litra Glow, serial: SIM1): 11 ff 04 1c 00")
+	assert.Empty(t, trace.String())
+
+	SetDryRun(DryRunOff, nil)
+	after, err := QueryState(2)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+// Test the state of the lights is saved to the config file in DryRunState
+func TestDryRunState(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1")
+	defer cleanup()
+	defer SetDryRun(DryRunOff, nil)
+	configUpdater := defaultConfigUpdater.(*MockConfigUpdater)
+
+	var output bytes.Buffer
+	SetDryRun(DryRunState, &output)
+	assert.NoError(t, LightBrightness(1, 30))
+	assert.Contains(t, output.String(), "SetBrightness(")
+	configUpdater.AssertCalled(t, "UpdateCurrentState", "SIM1", 30, -1, -1)
+
+	SetDryRun(DryRunOff, nil)
+	state, err := QueryState(1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, 30, state.Brightness)
+}
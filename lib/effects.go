@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Effect is a light pattern played by RunEffect. Frame returns the state the lights should have once
+// elapsed has passed since the effect started, with fields set to -1 left unchanged, and whether the
+// effect has finished. Effects with a Count of 0 repeat until they are cancelled.
+type Effect interface {
+	Frame(elapsed time.Duration) (state DeviceState, done bool)
+}
+
+// Blink switches the lights on and off Count times, spending half of each Period on and half off.
+// A short Period gives a strobe.
+type Blink struct {
+	Count  int
+	Period time.Duration
+}
+
+// Frame implements Effect
+func (b Blink) Frame(elapsed time.Duration) (DeviceState, bool) {
+	if b.Period <= 0 || finished(elapsed, b.Period, b.Count) {
+		return DeviceState{}, true
+	}
+	power := 1
+	if elapsed%b.Period >= b.Period/2 {
+		power = 0
+	}
+	return DeviceState{Power: power, Brightness: -1, Temperature: -1}, false
+}
+
+// Pulse varies the brightness sinusoidally between Min and Max (0-100), Count times, starting at Min
+type Pulse struct {
+	Min    int
+	Max    int
+	Period time.Duration
+	Count  int
+}
+
+// Frame implements Effect
+func (p Pulse) Frame(elapsed time.Duration) (DeviceState, bool) {
+	if p.Period <= 0 || finished(elapsed, p.Period, p.Count) {
+		return DeviceState{}, true
+	}
+	wave := (1 - math.Cos(2*math.Pi*cycleProgress(elapsed, p.Period))) / 2
+	return DeviceState{Power: 1, Brightness: interpolate(p.Min, p.Max, wave), Temperature: -1}, false
+}
+
+// Breathe is like Pulse but lingers near Min and rises and falls quickly, like a sleeping laptop's LED
+type Breathe struct {
+	Min    int
+	Max    int
+	Period time.Duration
+	Count  int
+}
+
+// Frame implements Effect
+func (b Breathe) Frame(elapsed time.Duration) (DeviceState, bool) {
+	if b.Period <= 0 || finished(elapsed, b.Period, b.Count) {
+		return DeviceState{}, true
+	}
+	// exp(sin) normalised to 0-1, shifted so each cycle starts at Min
+	x := math.Sin(2*math.Pi*cycleProgress(elapsed, b.Period) - math.Pi/2)
+	wave := (math.Exp(x) - 1/math.E) / (math.E - 1/math.E)
+	return DeviceState{Power: 1, Brightness: interpolate(b.Min, b.Max, wave), Temperature: -1}, false
+}
+
+// TemperatureSweep moves the temperature from From to To (in Kelvin, clamped to the range of each light)
+// and back, Count times
+type TemperatureSweep struct {
+	From   int
+	To     int
+	Period time.Duration
+	Count  int
+}
+
+// Frame implements Effect
+func (s TemperatureSweep) Frame(elapsed time.Duration) (DeviceState, bool) {
+	if s.Period <= 0 || finished(elapsed, s.Period, s.Count) {
+		return DeviceState{}, true
+	}
+	wave := (1 - math.Cos(2*math.Pi*cycleProgress(elapsed, s.Period))) / 2
+	return DeviceState{Power: 1, Brightness: -1, Temperature: interpolate(s.From, s.To, wave)}, false
+}
+
+// finished returns true once count cycles of period have elapsed. A count of 0 never finishes.
+func finished(elapsed time.Duration, period time.Duration, count int) bool {
+	return count > 0 && elapsed >= period*time.Duration(count)
+}
+
+// cycleProgress returns how far (0 to 1) elapsed is into the current cycle of period
+func cycleProgress(elapsed time.Duration, period time.Duration) float64 {
+	return float64(elapsed%period) / float64(period)
+}
+
+// RunEffect plays an effect on lights until it finishes or ctx is cancelled, then restores the state
+// the lights had before. deviceIndex 0 targets all, 1+ targets a specific device.
+func RunEffect(ctx context.Context, deviceIndex int, effect Effect) error {
+	return getDefaultController().RunEffect(ctx, deviceIndex, effect)
+}
+
+// RunEffect plays an effect on lights, updating them at TransitionFrameRate. The previous state of each
+// light is saved (see saveStates) and written back when the effect ends, fails or is cancelled, in which
+// case ctx.Err() is returned. The config file is not touched, since the lights end where they started.
+func (c *Controller) RunEffect(ctx context.Context, deviceIndex int, effect Effect) (err error) {
+	saved := c.saveStates(deviceIndex)
+	defer func() {
+		var restoreErrs []error
+		for _, s := range saved {
+			restoreErrs = append(restoreErrs, c.restore(s.index, s.Brightness, s.Temperature, s.Power))
+		}
+		if restoreErr := errors.Join(restoreErrs...); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second / time.Duration(TransitionFrameRate))
+	defer ticker.Stop()
+
+	written := DeviceState{Power: -1, Brightness: -1, Temperature: -1}
+	start := time.Now()
+	for {
+		state, done := effect.Frame(time.Since(start))
+		if done {
+			return nil
+		}
+		if err := c.applyFrame(deviceIndex, state, &written); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyFrame writes the values of state that differ from the last values written
+func (c *Controller) applyFrame(deviceIndex int, state DeviceState, written *DeviceState) error {
+	if state.Brightness != -1 && state.Brightness != written.Brightness {
+		if err := c.command(brightnessCommand(state.Brightness), deviceIndex); err != nil {
+			return err
+		}
+		written.Brightness = state.Brightness
+	}
+	if state.Temperature != -1 && state.Temperature != written.Temperature {
+		if err := c.command(temperatureCommand(uint16(state.Temperature)), deviceIndex); err != nil {
+			return err
+		}
+		written.Temperature = state.Temperature
+	}
+	if state.Power != -1 && state.Power != written.Power {
+		code := byte(LightOffCode)
+		if state.Power == 1 {
+			code = LightOnCode
+		}
+		if err := c.command(powerCommand(code), deviceIndex); err != nil {
+			return err
+		}
+		written.Power = state.Power
+	}
+	return nil
+}
+
+// savedState is the state of one light before an effect
+type savedState struct {
+	DeviceState
+	index int
+}
+
+// saveStates returns the state of each light addressed by deviceIndex, read from the light itself so
+// that every light gets its own state back. When a light cannot be queried, its state saved in the
+// config file is used.
+func (c *Controller) saveStates(deviceIndex int) []savedState {
+	c.mu.Lock()
+	devices, _ := c.targets(deviceIndex)
+	indices := make([]int, len(devices))
+	for i, d := range devices {
+		indices[i] = d.metadata.Index
+	}
+	c.mu.Unlock()
+
+	saved := make([]savedState, len(indices))
+	for i, index := range indices {
+		saved[i].index = index
+		state, err := queryStateFunc(c, index)
+		if err != nil {
+			log.Debug().Msgf("Unable to query device state, using config file: %v", err)
+			state.Brightness, state.Temperature, state.Power = defaultConfigUpdater.ReadCurrentState(c.stateKey(index))
+		}
+		saved[i].DeviceState = state
+	}
+	return saved
+}
+
+// restore writes back a saved state, skipping values that were unknown (-1). The power is set last
+// so a light that was off does not flash at the restored brightness.
+func (c *Controller) restore(deviceIndex int, brightness int, temp int, power int) error {
+	log.Debug().Msgf("Restoring brightness %d, temperature %d, power %d", brightness, temp, power)
+	written := DeviceState{Power: -1, Brightness: -1, Temperature: -1}
+	return c.applyFrame(deviceIndex, DeviceState{Power: power, Brightness: brightness, Temperature: temp}, &written)
+}
+
+// IdentifyEffect is the blink played by Identify
+var IdentifyEffect Effect = Blink{Count: 3, Period: 600 * time.Millisecond}
+
+// Identify blinks a light so it can be told apart from the others, then restores its previous state.
+// deviceIndex should be 1+ to target a specific device; 0 blinks all devices.
+func Identify(ctx context.Context, deviceIndex int) error {
+	return RunEffect(ctx, deviceIndex, IdentifyEffect)
+}
@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// frameEffect plays a fixed list of frames, one per update, regardless of the elapsed time
+type frameEffect struct {
+	frames []DeviceState
+	next   int
+}
+
+func (e *frameEffect) Frame(elapsed time.Duration) (DeviceState, bool) {
+	if e.next >= len(e.frames) {
+		return DeviceState{}, true
+	}
+	e.next++
+	return e.frames[e.next-1], false
+}
+
+// Test RunEffect writes only changed values and restores the previous state at the end
+func TestRunEffect(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	originalFrameRate := TransitionFrameRate
+	TransitionFrameRate = 1000
+	defer func() { TransitionFrameRate = originalFrameRate }()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 0, Brightness: 30, Temperature: 4000}, nil
+	}
+
+	effect := &frameEffect{frames: []DeviceState{
+		{Power: 1, Brightness: 50, Temperature: -1},
+		{Power: 1, Brightness: 50, Temperature: -1},
+		{Power: 1, Brightness: 70, Temperature: 3000},
+	}}
+
+	calls := []*mock.Call{
+		mockDevice2.On("Write", commandBytes(brightnessCommand(50), GlowProductID)).Return(20, nil).Once(),
+		mockDevice2.On("Write", commandBytes(powerCommand(LightOnCode), GlowProductID)).Return(20, nil).Once(),
+		mockDevice2.On("Write", commandBytes(brightnessCommand(70), GlowProductID)).Return(20, nil).Once(),
+		mockDevice2.On("Write", commandBytes(temperatureCommand(3000), GlowProductID)).Return(20, nil).Once(),
+		// Restore, switching the light off last
+		mockDevice2.On("Write", commandBytes(brightnessCommand(30), GlowProductID)).Return(20, nil).Once(),
+		mockDevice2.On("Write", commandBytes(temperatureCommand(4000), GlowProductID)).Return(20, nil).Once(),
+		mockDevice2.On("Write", commandBytes(powerCommand(LightOffCode), GlowProductID)).Return(20, nil).Once(),
+	}
+	mock.InOrder(calls...)
+
+	assert.NoError(t, RunEffect(context.Background(), 2, effect))
+
+	mockDevice2.AssertExpectations(t)
+	mockDevice1.AssertNotCalled(t, "Write", mock.Anything)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test a cancelled effect still restores the previous state
+func TestRunEffectCancelled(t *testing.T) {
+	mockDevice1, _, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 1, Brightness: 30, Temperature: 4000}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mockDevice1.On("Write", commandBytes(powerCommand(LightOnCode), BeamProductID)).Return(20, nil).Twice()
+	mockDevice1.On("Write", commandBytes(brightnessCommand(30), BeamProductID)).Return(20, nil).Once()
+	mockDevice1.On("Write", commandBytes(temperatureCommand(4000), BeamProductID)).Return(20, nil).Once()
+
+	err := RunEffect(ctx, 1, Blink{Period: time.Second})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	mockDevice1.AssertExpectations(t)
+}
+
+// Test each light gets its own state back after an effect on all lights, falling back to the config file
+func TestRunEffectRestoresEachDevice(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		if deviceIndex == 1 {
+			return DeviceState{Power: 1, Brightness: 30, Temperature: 4000}, nil
+		}
+		return DeviceState{}, ErrQueryFailed
+	}
+	mockConfigUpdater.On("ReadCurrentState", "test-serial-Glow").Return(60, 5000, 0).Once()
+
+	effect := &frameEffect{frames: []DeviceState{{Power: 1, Brightness: 50, Temperature: -1}}}
+
+	mockDevice1.On("Write", commandBytes(brightnessCommand(50), BeamProductID)).Return(20, nil).Once()
+	mockDevice1.On("Write", commandBytes(powerCommand(LightOnCode), BeamProductID)).Return(20, nil).Twice()
+	mockDevice1.On("Write", commandBytes(brightnessCommand(30), BeamProductID)).Return(20, nil).Once()
+	mockDevice1.On("Write", commandBytes(temperatureCommand(4000), BeamProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(brightnessCommand(50), GlowProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(powerCommand(LightOnCode), GlowProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(brightnessCommand(60), GlowProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(temperatureCommand(5000), GlowProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(powerCommand(LightOffCode), GlowProductID)).Return(20, nil).Once()
+
+	assert.NoError(t, RunEffect(context.Background(), 0, effect))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test the blink pattern and its end
+func TestBlinkFrame(t *testing.T) {
+	blink := Blink{Count: 2, Period: 100 * time.Millisecond}
+
+	for elapsed, power := range map[time.Duration]int{0: 1, 40 * time.Millisecond: 1, 60 * time.Millisecond: 0, 120 * time.Millisecond: 1, 199 * time.Millisecond: 0} {
+		state, done := blink.Frame(elapsed)
+		assert.False(t, done)
+		assert.Equal(t, DeviceState{Power: power, Brightness: -1, Temperature: -1}, state, elapsed)
+	}
+	_, done := blink.Frame(200 * time.Millisecond)
+	assert.True(t, done)
+
+	// A count of 0 blinks until cancelled
+	_, done = Blink{Period: 100 * time.Millisecond}.Frame(time.Hour)
+	assert.False(t, done)
+}
+
+// Test the pulse, breathe and sweep waves start at the low value and peak half way through a cycle
+func TestWaveFrames(t *testing.T) {
+	period := time.Second
+
+	for _, effect := range []Effect{Pulse{Min: 10, Max: 90, Period: period}, Breathe{Min: 10, Max: 90, Period: period}} {
+		state, _ := effect.Frame(0)
+		assert.Equal(t, 10, state.Brightness)
+		state, _ = effect.Frame(period / 2)
+		assert.Equal(t, 90, state.Brightness)
+		assert.Equal(t, 1, state.Power)
+		assert.Equal(t, -1, state.Temperature)
+	}
+
+	sweep := TemperatureSweep{From: 2700, To: 6500, Period: period, Count: 1}
+	state, _ := sweep.Frame(0)
+	assert.Equal(t, 2700, state.Temperature)
+	state, _ = sweep.Frame(period / 2)
+	assert.Equal(t, 6500, state.Temperature)
+	_, done := sweep.Frame(period)
+	assert.True(t, done)
+}
+
+// Test Identify blinks only the chosen device and ends where it started
+func TestIdentify(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	originalIdentifyEffect := IdentifyEffect
+	IdentifyEffect = Blink{Count: 1, Period: 200 * time.Millisecond}
+	defer func() { IdentifyEffect = originalIdentifyEffect }()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 1, Brightness: 40, Temperature: 5000}, nil
+	}
+
+	mockDevice1.On("Write", commandBytes(powerCommand(LightOnCode), BeamProductID)).Return(20, nil)
+	mockDevice1.On("Write", commandBytes(powerCommand(LightOffCode), BeamProductID)).Return(20, nil).Once()
+	mockDevice1.On("Write", commandBytes(brightnessCommand(40), BeamProductID)).Return(20, nil).Once()
+	mockDevice1.On("Write", commandBytes(temperatureCommand(5000), BeamProductID)).Return(20, nil).Once()
+
+	assert.NoError(t, Identify(context.Background(), 1))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+	lastWrite := mockDevice1.Calls[len(mockDevice1.Calls)-1]
+	assert.Equal(t, commandBytes(powerCommand(LightOnCode), BeamProductID), lastWrite.Arguments.Get(0))
+}
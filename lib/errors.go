@@ -0,0 +1,30 @@
+package lib
+
+import "errors"
+
+// Sentinel errors returned by the light functions. Callers should test for them with errors.Is,
+// since they are usually wrapped with the affected device and the underlying cause.
+var (
+	// ErrNoDevices is returned when no Litra devices are connected
+	ErrNoDevices = errors.New("no Litra devices found")
+	// ErrDeviceNotFound is returned when the requested device does not match a connected device
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrAmbiguousDevice is returned when a device specifier such as a model name matches more than one device
+	ErrAmbiguousDevice = errors.New("ambiguous device")
+	// ErrOpenFailed is returned when a device was found but could not be opened (e.g. permission denied)
+	ErrOpenFailed = errors.New("failed to open device")
+	// ErrFeatureNotSupported is returned when a device lacks the HID++ feature needed for a command
+	ErrFeatureNotSupported = errors.New("feature not supported by device")
+	// ErrOutOfRange is returned when a value is outside the range supported by a device
+	ErrOutOfRange = errors.New("value out of range")
+	// ErrWriteFailed is returned when sending a command to a device fails
+	ErrWriteFailed = errors.New("failed to write to device")
+	// ErrShortWrite is returned when a device accepts fewer bytes than were sent
+	ErrShortWrite = errors.New("short write to device")
+	// ErrPartialWrite is returned when a command reached some of the targeted devices but not all of them
+	ErrPartialWrite = errors.New("some devices were not updated")
+	// ErrQueryFailed is returned when the state of a device could not be read back
+	ErrQueryFailed = errors.New("failed to query device state")
+	// ErrDryRun is returned when a dry run would have to ask a device for something, see SetDryRun
+	ErrDryRun = errors.New("not sent to the device in a dry run")
+)
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+// hidppDeviceIndex addresses a light connected directly over USB rather than through a receiver
+const hidppDeviceIndex = 0xff
+
+// Feature is a HID++ 2.0 feature exposed by a light
+type Feature struct {
+	ID      protocol.FeatureID
+	Index   byte
+	Version byte
+}
+
+// getFeature asks IRoot for the index of a feature, which is 0 when the device does not support it.
+// It writes to the device directly rather than through Controller.write since it runs while the
+// device is being opened.
+func getFeature(d *discoveredDeviceInternal, id protocol.FeatureID) (byte, error) {
+	header := protocol.Header{DeviceIndex: hidppDeviceIndex, FeatureIndex: protocol.RootFeatureIndex}
+	query := protocol.GetFeature{ID: id}
+	if _, err := writeDevice(d, protocol.EncodeWith(header, query)); err != nil {
+		return 0, err
+	}
+	response, err := readResponse(d, header, query)
+	if err != nil {
+		return 0, err
+	}
+	return response.(protocol.GetFeature).Index, nil
+}
+
+// Function variable for testing
+var getFeatureFunc = getFeature
+
+// featureIndex returns the index of a feature on an open device. The device is asked the first time
+// and the answer is cached until the device is reopened. Returns ErrFeatureNotSupported when the
+// device does not have the feature, and ErrDryRun when it would have to be asked during a dry run.
+// Must be called with c.mu held.
+func featureIndex(d *discoveredDeviceInternal, id protocol.FeatureID) (byte, error) {
+	if id == protocol.RootFeature {
+		return protocol.RootFeatureIndex, nil
+	}
+
+	index, ok := d.features[id]
+	if !ok && dryRun() != DryRunOff {
+		return 0, fmt.Errorf("%w: the index of the %s feature of device %d (Litra %s, serial: %s) has not been looked up",
+			ErrDryRun, id, d.metadata.Index, d.metadata.Name, d.metadata.Serial)
+	}
+	if !ok {
+		var err error
+		if index, err = getFeatureFunc(d, id); err != nil {
+			return 0, err
+		}
+		cacheFeature(d, id, index)
+		log.Debug().Msgf("Feature %s of %s (serial: %s) is at index %d", id, d.metadata.Name, d.metadata.Serial, index)
+	}
+	if index == 0 {
+		return 0, fmt.Errorf("%w: device %d (Litra %s, serial: %s) has no %s feature",
+			ErrFeatureNotSupported, d.metadata.Index, d.metadata.Name, d.metadata.Serial, id)
+	}
+	return index, nil
+}
+
+// cacheFeature remembers the index of a feature until the device is reopened, which drops the cache
+func cacheFeature(d *discoveredDeviceInternal, id protocol.FeatureID, index byte) {
+	if d.features == nil {
+		d.features = make(map[protocol.FeatureID]byte)
+	}
+	d.features[id] = index
+}
+
+// featureHeader returns the header addressing a feature of an open device. Must be called with c.mu held.
+func featureHeader(d *discoveredDeviceInternal, id protocol.FeatureID) (protocol.Header, error) {
+	index, err := featureIndex(d, id)
+	if err != nil {
+		return protocol.Header{}, err
+	}
+	return protocol.Header{DeviceIndex: hidppDeviceIndex, FeatureIndex: index}, nil
+}
+
+// ListFeatures lists the HID++ 2.0 features of a light using IFeatureSet.
+// deviceIndex 1+ queries a specific device; deviceIndex 0 queries the first device.
+func ListFeatures(deviceIndex int) ([]Feature, error) {
+	return getDefaultController().ListFeatures(deviceIndex)
+}
+
+// ListFeatures lists the HID++ 2.0 features of a light using IFeatureSet, starting with IRoot at index 0.
+// deviceIndex 1+ queries a specific device; deviceIndex 0 queries the first device.
+func (c *Controller) ListFeatures(deviceIndex int) ([]Feature, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return nil, err
+	}
+	d := devices[0]
+
+	response, err := c.queryValue(d, protocol.GetFeatureCount{})
+	if err != nil {
+		return nil, err
+	}
+	count := int(response.(protocol.GetFeatureCount).Count)
+
+	// The count does not include IRoot, so the indices run from 0 to count
+	features := make([]Feature, 0, count+1)
+	for index := 0; index <= count; index++ {
+		response, err := c.queryValue(d, protocol.GetFeatureID{Index: byte(index)})
+		if err != nil {
+			return nil, err
+		}
+		info := response.(protocol.GetFeatureID)
+		features = append(features, Feature{ID: info.ID, Index: byte(index), Version: info.Version})
+		cacheFeature(d, info.ID, byte(index))
+	}
+	return features, nil
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// rootHeader addresses IRoot on a directly connected light
+var rootHeader = protocol.Header{DeviceIndex: hidppDeviceIndex, FeatureIndex: protocol.RootFeatureIndex}
+
+// expectGetFeature sets up the IRoot lookup of a feature on the mock device, answered with response
+func expectGetFeature(device *MockHIDDevice, id protocol.FeatureID, response []byte) {
+	device.On("Write", protocol.EncodeWith(rootHeader, protocol.GetFeature{ID: id})).Return(20, nil).Once()
+	expectResponse(device, response)
+}
+
+// Test the illumination feature index is looked up when a light is opened and used for every command
+func TestFeatureDiscovery(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	defer cleanup()
+	getFeatureFunc = getFeature
+
+	expectGetFeature(mockDevice1, protocol.IlluminationFeature,
+		protocol.EncodeResponse(rootHeader, protocol.GetFeature{Index: 0x07}))
+	expectGetFeature(mockDevice2, protocol.IlluminationFeature,
+		protocol.EncodeResponse(rootHeader, protocol.GetFeature{Index: 0x04}))
+
+	header := protocol.Header{DeviceIndex: hidppDeviceIndex, FeatureIndex: 0x07}
+	mockDevice1.On("Write", protocol.EncodeWith(header, protocol.SetPower{On: true})).Return(20, nil).Once()
+	mockDevice1.On("Write", protocol.EncodeWith(header, protocol.SetTemperature{Kelvin: 3000})).Return(20, nil).Once()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+	assert.NoError(t, controller.command(powerCommand(LightOnCode), 1))
+	assert.NoError(t, controller.command(temperatureCommand(3000), 1))
+
+	// The index is only looked up once
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+}
+
+// Test lights without the illumination feature, or that reject the lookup, are reported as not opened
+func TestFeatureDiscoveryErrors(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	defer cleanup()
+	getFeatureFunc = getFeature
+
+	expectGetFeature(mockDevice1, protocol.IlluminationFeature,
+		protocol.EncodeResponse(rootHeader, protocol.GetFeature{Index: 0}))
+	expectGetFeature(mockDevice2, protocol.IlluminationFeature,
+		protocol.EncodeError(rootHeader, protocol.GetFeatureFunction, 0x05))
+
+	_, err := NewController()
+
+	assert.ErrorIs(t, err, ErrOpenFailed)
+	assert.ErrorIs(t, err, ErrFeatureNotSupported)
+	assert.ErrorContains(t, err, "has no Illumination (0x1990) feature")
+	assert.ErrorIs(t, err, ErrQueryFailed)
+	var deviceErr protocol.DeviceError
+	assert.True(t, errors.As(err, &deviceErr))
+	assert.Equal(t, byte(0x05), deviceErr.Code)
+	mockDevice1.AssertCalled(t, "Close")
+	mockDevice2.AssertCalled(t, "Close")
+}
+
+// Test the features of a light are listed with IFeatureSet
+func TestListFeatures(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "beam:SIM2")
+	defer cleanup()
+
+	features, err := ListFeatures(1)
+
+	assert.NoError(t, err)
+	beam, _ := LookupProduct(BeamProductID)
+	assert.Len(t, features, len(simulatedFeatures(beam)))
+	assert.Equal(t, Feature{ID: protocol.RootFeature, Index: 0}, features[0])
+	assert.Equal(t, Feature{ID: protocol.IlluminationFeature, Index: 4}, features[4])
+
+	// The listed indices are cached, even when the cache was dropped
+	d := getDefaultController().devices[0]
+	d.features = nil
+	_, err = ListFeatures(1)
+	assert.NoError(t, err)
+	assert.Len(t, d.features, len(features))
+	assert.Equal(t, byte(4), d.features[protocol.IlluminationFeature])
+
+	_, err = ListFeatures(2)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
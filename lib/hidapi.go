@@ -0,0 +1,34 @@
+//go:build cgo && !hidraw
+
+package lib
+
+import "github.com/sstallion/go-hid"
+
+// HIDDeviceInfo describes a HID device found by a HIDEnumerator
+type HIDDeviceInfo = hid.DeviceInfo
+
+// errReadTimeout is returned by ReadWithTimeout when no report arrives in time
+var errReadTimeout = hid.ErrTimeout
+
+// hidapiEnumerator enumerates devices through hidapi
+type hidapiEnumerator struct{}
+
+func (e *hidapiEnumerator) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error {
+	return hid.Enumerate(vendorID, productID, enumerationCallback)
+}
+
+// hidapiOpener opens devices through hidapi
+type hidapiOpener struct{}
+
+func (o *hidapiOpener) Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error) {
+	return hid.Open(vendorID, productID, serialNumber)
+}
+
+func (o *hidapiOpener) OpenPath(path string) (HIDDevice, error) {
+	return hid.OpenPath(path)
+}
+
+// hidapiBackend returns the hid backend, which talks to lights through hidapi
+func hidapiBackend() (HIDEnumerator, HIDOpener, error) {
+	return &hidapiEnumerator{}, &hidapiOpener{}, nil
+}
@@ -0,0 +1,28 @@
+//go:build !cgo || hidraw
+
+package lib
+
+import "errors"
+
+// HIDDeviceInfo describes a HID device found by a HIDEnumerator. Builds with hidapi use
+// hid.DeviceInfo instead, which has the same fields and a bus type.
+type HIDDeviceInfo struct {
+	Path         string // platform-specific device path
+	VendorID     uint16
+	ProductID    uint16
+	SerialNbr    string
+	ReleaseNbr   uint16 // device version number
+	MfrStr       string
+	ProductStr   string
+	UsagePage    uint16
+	Usage        uint16
+	InterfaceNbr int // USB interface number
+}
+
+// errReadTimeout is returned by ReadWithTimeout when no report arrives in time
+var errReadTimeout = errors.New("timeout")
+
+// hidapiBackend reports that the hid backend, which needs cgo and libhidapi, is left out of this build
+func hidapiBackend() (HIDEnumerator, HIDOpener, error) {
+	return nil, nil, errors.New("the hid backend needs cgo and is not part of this build")
+}
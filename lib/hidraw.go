@@ -0,0 +1,285 @@
+//go:build linux
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Hidraw is a pure-Go backend implementing HIDEnumerator and HIDOpener on Linux. It finds lights
+// through the hidraw class in sysfs and talks to their /dev/hidrawN nodes directly, so it needs
+// neither cgo nor libhidapi.
+type Hidraw struct {
+	SysfsRoot string // where sysfs is mounted, normally /sys
+	DevRoot   string // where the hidraw device nodes are, normally /dev
+}
+
+// NewHidraw returns the hidraw backend for the sysfs and device nodes of the running system
+func NewHidraw() *Hidraw {
+	return &Hidraw{SysfsRoot: "/sys", DevRoot: "/dev"}
+}
+
+// Enumerate implements HIDEnumerator. A vendorID or productID of 0 matches any device.
+func (h *Hidraw) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error {
+	entries, err := os.ReadDir(filepath.Join(h.SysfsRoot, "class", "hidraw"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := h.deviceInfo(entry.Name())
+		if err != nil {
+			log.Debug().Msgf("Skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		if (vendorID != 0 && info.VendorID != vendorID) || (productID != 0 && info.ProductID != productID) {
+			continue
+		}
+		if err := enumerationCallback(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceInfo describes the hidraw device with the given name (e.g. hidraw3) from sysfs. The HID device
+// holds the IDs and serial number in its uevent, its parent is the USB interface and the USB device
+// above that has the descriptor strings.
+func (h *Hidraw) deviceInfo(name string) (*HIDDeviceInfo, error) {
+	hidDir, err := filepath.EvalSymlinks(filepath.Join(h.SysfsRoot, "class", "hidraw", name, "device"))
+	if err != nil {
+		return nil, err
+	}
+	uevent, err := readUevent(filepath.Join(hidDir, "uevent"))
+	if err != nil {
+		return nil, err
+	}
+	vendorID, productID, err := parseHIDID(uevent["HID_ID"])
+	if err != nil {
+		return nil, err
+	}
+
+	info := &HIDDeviceInfo{
+		Path:         filepath.Join(h.DevRoot, name),
+		VendorID:     vendorID,
+		ProductID:    productID,
+		SerialNbr:    uevent["HID_UNIQ"],
+		ProductStr:   uevent["HID_NAME"],
+		InterfaceNbr: -1,
+	}
+	interfaceDir := filepath.Dir(hidDir)
+	if value, ok := readSysfsValue(interfaceDir, "bInterfaceNumber"); ok {
+		if n, err := strconv.ParseUint(value, 16, 8); err == nil {
+			info.InterfaceNbr = int(n)
+		}
+	}
+	usbDir := filepath.Dir(interfaceDir)
+	if value, ok := readSysfsValue(usbDir, "product"); ok {
+		info.ProductStr = value
+	}
+	if value, ok := readSysfsValue(usbDir, "manufacturer"); ok {
+		info.MfrStr = value
+	}
+	if value, ok := readSysfsValue(usbDir, "bcdDevice"); ok {
+		if n, err := strconv.ParseUint(value, 16, 16); err == nil {
+			info.ReleaseNbr = uint16(n)
+		}
+	}
+	return info, nil
+}
+
+// port returns the USB port of the hidraw device with the given name (e.g. hidraw3) as bus-port path,
+// taken from its USB interface (e.g. 1-2.3:1.0), or an empty string if it is not a USB device
+func (h *Hidraw) port(name string) string {
+	hidDir, err := filepath.EvalSymlinks(filepath.Join(h.SysfsRoot, "class", "hidraw", name, "device"))
+	if err != nil {
+		return ""
+	}
+	port, _, _ := strings.Cut(filepath.Base(filepath.Dir(hidDir)), ":")
+	if !usbPortPattern.MatchString(port) {
+		return ""
+	}
+	return port
+}
+
+// hidrawPort returns the USB port of a hidraw device node such as /dev/hidraw3
+func hidrawPort(path string) string {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, "hidraw") {
+		return ""
+	}
+	return NewHidraw().port(name)
+}
+
+// readUevent reads the KEY=value lines of a uevent file
+func readUevent(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// parseHIDID parses the HID_ID of a uevent, written as bus:vendor:product in hex (e.g. 0003:0000046D:0000C900)
+func parseHIDID(id string) (vendorID uint16, productID uint16, err error) {
+	parts := strings.Split(id, ":")
+	if len(parts) == 3 {
+		vendor, vendorErr := strconv.ParseUint(parts[1], 16, 32)
+		product, productErr := strconv.ParseUint(parts[2], 16, 32)
+		if vendorErr == nil && productErr == nil && vendor <= 0xffff && product <= 0xffff {
+			return uint16(vendor), uint16(product), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid HID_ID %q", id)
+}
+
+// readSysfsValue reads a sysfs attribute, returning false when it does not exist
+func readSysfsValue(dir string, name string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// Open implements HIDOpener, opening the first device with the given IDs and serial number (any serial
+// number if empty). The IDs are checked against the device node, see openNode.
+func (h *Hidraw) Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error) {
+	var path string
+	err := h.Enumerate(vendorID, productID, func(info *HIDDeviceInfo) error {
+		if path == "" && (serialNumber == "" || info.SerialNbr == serialNumber) {
+			path = info.Path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no hidraw device %04x:%04x with serial %q", vendorID, productID, serialNumber)
+	}
+
+	return openNode(path, func(info hidrawDevinfo) error {
+		if info.Vendor != vendorID || info.Product != productID {
+			return fmt.Errorf("%s is device %04x:%04x, not %04x:%04x", path, info.Vendor, info.Product, vendorID, productID)
+		}
+		return nil
+	})
+}
+
+// OpenPath implements HIDPathOpener, opening a device node such as /dev/hidraw3. The node must be a
+// registered Litra model, see openNode.
+func (h *Hidraw) OpenPath(path string) (HIDDevice, error) {
+	return openNode(path, func(info hidrawDevinfo) error {
+		if _, ok := LookupProduct(info.Product); info.Vendor != VendorId || !ok {
+			return fmt.Errorf("%s is device %04x:%04x, not a Litra light", path, info.Vendor, info.Product)
+		}
+		return nil
+	})
+}
+
+// openNode opens a device node once check accepts the IDs it reports with HIDIOCGRAWINFO, in case the
+// node was reassigned to another device since sysfs was read
+func openNode(path string, check func(hidrawDevinfo) error) (HIDDevice, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := hidrawInfoFunc(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := check(info); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &hidrawDevice{file: file}, nil
+}
+
+// hidrawDevinfo is struct hidraw_devinfo from linux/hidraw.h, with the IDs unsigned
+type hidrawDevinfo struct {
+	Bustype uint32
+	Vendor  uint16
+	Product uint16
+}
+
+// hidiocgrawinfo is the HIDIOCGRAWINFO ioctl, _IOR('H', 0x03, struct hidraw_devinfo)
+const hidiocgrawinfo = 2<<30 | uintptr(unsafe.Sizeof(hidrawDevinfo{}))<<16 | 'H'<<8 | 0x03
+
+// hidrawInfo asks a hidraw device node for its bus type and IDs
+func hidrawInfo(file *os.File) (hidrawDevinfo, error) {
+	var info hidrawDevinfo
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return info, err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, hidiocgrawinfo, uintptr(unsafe.Pointer(&info)))
+	})
+	if err != nil {
+		return info, err
+	}
+	if errno != 0 {
+		return info, fmt.Errorf("HIDIOCGRAWINFO: %w", errno)
+	}
+	return info, nil
+}
+
+// Function variable for testing
+var hidrawInfoFunc = hidrawInfo
+
+// hidrawDevice is an open /dev/hidrawN node. Reports are written and read whole, starting with the report ID.
+type hidrawDevice struct {
+	file *os.File
+}
+
+func (d *hidrawDevice) Write(data []byte) (int, error) {
+	return d.file.Write(data)
+}
+
+// ReadWithTimeout reads one report, waiting at most timeout for it (forever if negative)
+func (d *hidrawDevice) ReadWithTimeout(data []byte, timeout time.Duration) (int, error) {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := d.file.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	n, err := d.file.Read(data)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return 0, errReadTimeout
+	}
+	return n, err
+}
+
+func (d *hidrawDevice) Close() error {
+	return d.file.Close()
+}
+
+// hidrawBackend returns the hidraw backend
+func hidrawBackend() (HIDEnumerator, HIDOpener, error) {
+	hidraw := NewHidraw()
+	return hidraw, hidraw, nil
+}
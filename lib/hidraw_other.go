@@ -0,0 +1,15 @@
+//go:build !linux
+
+package lib
+
+import "errors"
+
+// hidrawBackend reports that the hidraw backend only exists on Linux
+func hidrawBackend() (HIDEnumerator, HIDOpener, error) {
+	return nil, nil, errors.New("the hidraw backend is only available on Linux")
+}
+
+// hidrawPort returns an empty string, hidraw device nodes only exist on Linux
+func hidrawPort(path string) string {
+	return ""
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHidraw builds a sysfs tree and device nodes for a Glow and a Beam under a temporary directory,
+// laid out like a real system. The device nodes are FIFOs, so written reports can be read back.
+func fakeHidraw(t *testing.T) *Hidraw {
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := t.TempDir()
+	h := &Hidraw{SysfsRoot: filepath.Join(root, "sys"), DevRoot: filepath.Join(root, "dev")}
+	must(os.MkdirAll(h.DevRoot, 0o755))
+
+	addDevice := func(name string, port string, hidID string, serial string, product string) {
+		usbDir := filepath.Join(h.SysfsRoot, "devices", "pci0000:00", "usb1", port)
+		hidDir := filepath.Join(usbDir, port+":1.0", hidID+".0001")
+		must(os.MkdirAll(hidDir, 0o755))
+		must(os.WriteFile(filepath.Join(usbDir, "product"), []byte(product+"\n"), 0o644))
+		must(os.WriteFile(filepath.Join(usbDir, "manufacturer"), []byte("Logitech\n"), 0o644))
+		must(os.WriteFile(filepath.Join(usbDir, "bcdDevice"), []byte("0110\n"), 0o644))
+		must(os.WriteFile(filepath.Join(usbDir, port+":1.0", "bInterfaceNumber"), []byte("00\n"), 0o644))
+		uevent := "DRIVER=hid-generic\nHID_ID=" + hidID + "\nHID_NAME=Logitech " + product + "\nHID_UNIQ=" + serial + "\n"
+		must(os.WriteFile(filepath.Join(hidDir, "uevent"), []byte(uevent), 0o644))
+
+		classDir := filepath.Join(h.SysfsRoot, "class", "hidraw", name)
+		must(os.MkdirAll(classDir, 0o755))
+		must(os.Symlink(hidDir, filepath.Join(classDir, "device")))
+		must(syscall.Mkfifo(filepath.Join(h.DevRoot, name), 0o600))
+	}
+	addDevice("hidraw0", "1-2", "0003:0000046D:0000C900", "GLOW1", "Litra Glow")
+	addDevice("hidraw1", "1-3", "0003:0000046D:0000C901", "BEAM1", "Litra Beam")
+	addDevice("hidraw2", "1-4", "0003:0000046D:0000C52B", "", "USB Receiver")
+
+	// FIFOs do not answer HIDIOCGRAWINFO, so report the IDs sysfs has for the node
+	original := hidrawInfoFunc
+	hidrawInfoFunc = func(file *os.File) (hidrawDevinfo, error) {
+		info, err := h.deviceInfo(filepath.Base(file.Name()))
+		if err != nil {
+			return hidrawDevinfo{}, err
+		}
+		return hidrawDevinfo{Bustype: 3, Vendor: info.VendorID, Product: info.ProductID}, nil
+	}
+	t.Cleanup(func() { hidrawInfoFunc = original })
+	return h
+}
+
+// Test that hidraw devices are found through sysfs and filtered by vendor and product ID
+func TestHidrawEnumerate(t *testing.T) {
+	h := fakeHidraw(t)
+
+	var devices []HIDDeviceInfo
+	err := h.Enumerate(VendorId, GlowProductID, func(info *HIDDeviceInfo) error {
+		devices = append(devices, *info)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []HIDDeviceInfo{{
+		Path:         filepath.Join(h.DevRoot, "hidraw0"),
+		VendorID:     VendorId,
+		ProductID:    GlowProductID,
+		SerialNbr:    "GLOW1",
+		ReleaseNbr:   0x0110,
+		MfrStr:       "Logitech",
+		ProductStr:   "Litra Glow",
+		InterfaceNbr: 0,
+	}}, devices)
+
+	var serials []string
+	err = h.Enumerate(VendorId, 0, func(info *HIDDeviceInfo) error {
+		serials = append(serials, info.SerialNbr)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GLOW1", "BEAM1", ""}, serials)
+
+	// Without a hidraw class there are simply no devices
+	err = (&Hidraw{SysfsRoot: t.TempDir()}).Enumerate(0, 0, func(*HIDDeviceInfo) error {
+		t.Error("unexpected device")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+// Test that reports written to an opened device reach its node, and reads time out when nothing arrives
+func TestHidrawOpen(t *testing.T) {
+	h := fakeHidraw(t)
+
+	device, err := h.Open(VendorId, BeamProductID, "BEAM1")
+	if err != nil {
+		t.Fatalf("Failed to open the Beam: %v", err)
+	}
+	defer device.Close()
+	assert.Equal(t, filepath.Join(h.DevRoot, "hidraw1"), device.(*hidrawDevice).file.Name())
+
+	report := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode}
+	n, err := device.Write(report)
+	assert.NoError(t, err)
+	assert.Equal(t, len(report), n)
+
+	buffer := make([]byte, 20)
+	n, err = device.ReadWithTimeout(buffer, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, report, buffer[:n])
+
+	_, err = device.ReadWithTimeout(buffer, 10*time.Millisecond)
+	assert.ErrorIs(t, err, errReadTimeout)
+
+	_, err = h.Open(VendorId, BeamProductID, "GLOW1")
+	assert.Error(t, err)
+}
+
+// Test that a device node reporting other IDs than sysfs is not used
+func TestHidrawOpenChecksIDs(t *testing.T) {
+	h := fakeHidraw(t)
+	hidrawInfoFunc = func(*os.File) (hidrawDevinfo, error) {
+		return hidrawDevinfo{Bustype: 3, Vendor: VendorId, Product: BeamProductID}, nil
+	}
+
+	_, err := h.Open(VendorId, GlowProductID, "")
+	assert.ErrorContains(t, err, "is device 046d:c901, not 046d:c900")
+}
+
+// Test that only device nodes of Litra lights are opened by path
+func TestHidrawOpenPathChecksIDs(t *testing.T) {
+	h := fakeHidraw(t)
+
+	device, err := h.OpenPath(filepath.Join(h.DevRoot, "hidraw1"))
+	assert.NoError(t, err)
+	device.Close()
+
+	_, err = h.OpenPath(filepath.Join(h.DevRoot, "hidraw2"))
+	assert.ErrorContains(t, err, "is device 046d:c52b, not a Litra light")
+
+	// A node reassigned to another device since it was enumerated
+	hidrawInfoFunc = func(*os.File) (hidrawDevinfo, error) {
+		return hidrawDevinfo{Bustype: 3, Vendor: 0x1234, Product: BeamProductID}, nil
+	}
+	_, err = h.OpenPath(filepath.Join(h.DevRoot, "hidraw1"))
+	assert.ErrorContains(t, err, "is device 1234:c901, not a Litra light")
+}
+
+// Test the USB port of a hidraw device is taken from its USB interface
+func TestHidrawPort(t *testing.T) {
+	h := fakeHidraw(t)
+	assert.Equal(t, "1-3", h.port("hidraw1"))
+	assert.Equal(t, "", h.port("hidraw9"))
+}
+
+// Test parsing the HID_ID of a uevent
+func TestParseHIDID(t *testing.T) {
+	vendorID, productID, err := parseHIDID("0003:0000046D:0000C903")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(VendorId), vendorID)
+	assert.Equal(t, uint16(0xc903), productID)
+
+	for _, id := range []string{"", "0003:046D", "0003:0001046D:0000C903", "0003:zz:0000C903"} {
+		_, _, err := parseHIDID(id)
+		assert.Error(t, err, id)
+	}
+}
+
+// Test that the hidraw backend can be selected
+func TestUseHidrawBackend(t *testing.T) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	originalHIDOpener := defaultHIDOpener
+	defer func() {
+		defaultHIDEnumerator = originalHIDEnumerator
+		defaultHIDOpener = originalHIDOpener
+	}()
+
+	assert.NoError(t, UseBackend("hidraw"))
+	assert.IsType(t, &Hidraw{}, defaultHIDEnumerator)
+	assert.IsType(t, &Hidraw{}, defaultHIDOpener)
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// usbPortPattern matches a USB port as bus-port path, e.g. 1-2.3 for port 3 of the hub on port 2 of bus 1
+var usbPortPattern = regexp.MustCompile(`^\d+-\d+(\.\d+)*$`)
+
+// usbPort returns the USB port of a device from its HID path, or an empty string if the path does not
+// tell. Paths of the hidraw backend of hidapi and of the hidraw backend (/dev/hidrawN) are looked up
+// in sysfs, and paths of the libusb backend of hidapi (e.g. 1-2.3:1.0) start with the port.
+func usbPort(path string) string {
+	if port, _, ok := strings.Cut(path, ":"); ok && usbPortPattern.MatchString(port) {
+		return port
+	}
+	return hidrawPort(path)
+}
+
+// location returns where a light is plugged in: its USB port, or its HID path when the port is unknown
+func (d DiscoveredDevice) location() string {
+	if d.Port != "" {
+		return d.Port
+	}
+	return d.Path
+}
+
+// deviceIDs returns the identity of each device. A serial number identifies a light when no other
+// light reports it; lights with an empty or shared serial number are told apart by where they are
+// plugged in, so they are identified by serial number and location.
+func deviceIDs(devices []DiscoveredDevice) []string {
+	serials := make(map[string]int, len(devices))
+	for _, d := range devices {
+		serials[d.Serial]++
+	}
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.Serial
+		if d.Serial == "" || serials[d.Serial] > 1 {
+			ids[i] = d.Serial + "@" + d.location()
+		}
+	}
+	return ids
+}
+
+// HasStableID returns true if the identity of the light stays the same when it is reconnected, which
+// is the case unless it is told apart from other lights by its HID path because its USB port is unknown
+func (d DiscoveredDevice) HasStableID() bool {
+	return d.ID != "" && (d.ID == d.Serial || d.Port != "")
+}
+
+// isLight returns true if a HID device found by an enumerator is the given device
+func (d *discoveredDeviceInternal) isLight(info *HIDDeviceInfo) bool {
+	switch {
+	case info.SerialNbr != d.metadata.Serial:
+		return false
+	case d.metadata.ID == d.metadata.Serial:
+		return true
+	case d.metadata.Port != "":
+		return usbPort(info.Path) == d.metadata.Port
+	}
+	return info.Path == d.metadata.Path
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the USB port is taken from HID paths that tell it
+func TestUsbPort(t *testing.T) {
+	for path, expected := range map[string]string{
+		"1-2.3:1.0":                   "1-2.3",
+		"3-10:1.2":                    "3-10",
+		"sim:SIM1":                    "",
+		"path1":                       "",
+		"DevSrvsID:4294969341":        "",
+		`\\?\hid#vid_046d&pid_c900#1`: "",
+		"":                            "",
+	} {
+		assert.Equal(t, expected, usbPort(path), path)
+	}
+}
+
+// Test serial numbers identify lights unless they are empty or shared
+func TestDeviceIDs(t *testing.T) {
+	ids := deviceIDs([]DiscoveredDevice{
+		{Serial: "A", Port: "1-1"},
+		{Serial: "", Port: "1-2"},
+		{Serial: "", Path: "/dev/hidraw4"},
+		{Serial: "B", Port: "1-3"},
+		{Serial: "B", Port: "1-4"},
+	})
+	assert.Equal(t, []string{"A", "@1-2", "@/dev/hidraw4", "B@1-3", "B@1-4"}, ids)
+}
+
+// Test lights with empty or shared serial numbers are listed and controlled separately, and can be
+// addressed by port
+func TestControllerDuplicateSerials(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:@1-3,glow:@1-2,beam:X@1-4.1,beam:X@1-4.2,beam:Y")
+	defer cleanup()
+
+	devices, err := ListDevices()
+	assert.NoError(t, err)
+	assert.Equal(t, []DiscoveredDevice{
+		{Index: 1, Name: "Glow", Serial: "", ID: "@1-2", ProductID: 0xc900, Path: "1-2:1.0", Port: "1-2"},
+		{Index: 2, Name: "Glow", Serial: "", ID: "@1-3", ProductID: 0xc900, Path: "1-3:1.0", Port: "1-3"},
+		{Index: 3, Name: "Beam", Serial: "X", ID: "X@1-4.1", ProductID: 0xc901, Path: "1-4.1:1.0", Port: "1-4.1"},
+		{Index: 4, Name: "Beam", Serial: "X", ID: "X@1-4.2", ProductID: 0xc901, Path: "1-4.2:1.0", Port: "1-4.2"},
+		{Index: 5, Name: "Beam", Serial: "Y", ID: "Y", ProductID: 0xc901, Path: "sim:Y"},
+	}, devices)
+
+	index, err := ResolveDevice("port:1-4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, index)
+	index, err = ResolveDevice("y")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, index)
+	_, err = ResolveDevice("X")
+	assert.ErrorIs(t, err, ErrAmbiguousDevice)
+	_, err = ResolveDevice("port:1-9")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+	assert.NoError(t, LightOn(2))
+	assert.NoError(t, LightOn(4))
+	for i, power := range []int{0, 1, 0, 1, 0} {
+		state, err := QueryState(i + 1)
+		assert.NoError(t, err)
+		assert.Equal(t, power, state.Power, "device %d", i+1)
+	}
+
+	// Refreshing keeps each light apart. The three state queries count as writes too.
+	assert.NoError(t, Refresh())
+	stats := Stats()
+	assert.Len(t, stats, 5)
+	assert.Equal(t, DeviceStats{Serial: "", Port: "1-2", Name: "Glow", Writes: 3}, stats[0])
+	assert.Equal(t, DeviceStats{Serial: "X", Port: "1-4.2", Name: "Beam", Writes: 4}, stats[3])
+	assert.Equal(t, DeviceStats{Serial: "Y", Name: "Beam", Writes: 3}, stats[4])
+}
+
+// Test the state, curve and calibration of lights with empty or shared serial numbers are saved under
+// their identity, after moving their settings from where they were saved by serial number
+func TestControllerIdentityKeys(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:@1-2,beam:X@1-4.1,beam:X@1-4.2,beam:Y")
+	defer cleanup()
+	configUpdater := defaultConfigUpdater.(*MockConfigUpdater)
+
+	assert.NoError(t, LightOn(1))
+	assert.NoError(t, LightBrightness(3, 40))
+	assert.NoError(t, LightOn(4))
+	configUpdater.AssertCalled(t, "MigrateDeviceIdentities", map[string]string{"@1-2": "", "X@1-4.1": "X", "X@1-4.2": "X"})
+	configUpdater.AssertCalled(t, "UpdateCurrentState", "@1-2", -1, -1, 1)
+	configUpdater.AssertCalled(t, "UpdateCurrentState", "X@1-4.2", 40, -1, -1)
+	configUpdater.AssertCalled(t, "UpdateCurrentState", "Y", -1, -1, 1)
+	for _, id := range []string{"@1-2", "X@1-4.1", "X@1-4.2", "Y"} {
+		configUpdater.AssertCalled(t, "ReadCurve", id)
+		configUpdater.AssertCalled(t, "ReadCalibration", id)
+	}
+	configUpdater.AssertNotCalled(t, "ReadCalibration", "")
+	configUpdater.AssertNotCalled(t, "ReadCalibration", "X")
+
+	// Identities address lights too, so aliases can point at them
+	index, err := ResolveDevice("x@1-4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, index)
+	index, err = ResolveDevice("@1-2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, index)
+}
+
+// Test only identities that survive reconnecting the light are stable
+func TestHasStableID(t *testing.T) {
+	assert.True(t, DiscoveredDevice{Serial: "A", ID: "A"}.HasStableID())
+	assert.True(t, DiscoveredDevice{Serial: "", ID: "@1-2", Port: "1-2"}.HasStableID())
+	assert.False(t, DiscoveredDevice{Serial: "", ID: "@/dev/hidraw4", Path: "/dev/hidraw4"}.HasStableID())
+	assert.False(t, DiscoveredDevice{}.HasStableID())
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+// DeviceInfo returns the metadata of a light completed with the firmware version and the brightness
+// and temperature ranges it reports. Lights that cannot report a range are given the range of their
+// Product, and a firmware version that cannot be read is left empty.
+// deviceIndex 1+ queries a specific device; deviceIndex 0 queries the first device.
+func (c *Controller) DeviceInfo(deviceIndex int) (DiscoveredDevice, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+	d := devices[0]
+	if d.device == nil {
+		if err := c.reopen(d); err != nil {
+			return d.metadata, err
+		}
+	}
+
+	info := d.metadata
+	if info.Firmware, err = c.queryFirmware(d); err != nil {
+		log.Debug().Msgf("Unable to read the firmware version: %v", err)
+	}
+
+	product := d.product()
+	info.BrightnessRange = product.Brightness
+	if response, err := c.queryValue(d, protocol.GetBrightnessInfo{}); err != nil {
+		log.Debug().Msgf("Unable to read the brightness range, using the range of the Litra %s: %v", product.Name, err)
+	} else if r := response.(protocol.GetBrightnessInfo); r.Min < r.Max {
+		info.BrightnessRange = Range{Min: int(r.Min), Max: int(r.Max)}
+	}
+
+	info.TemperatureRange = product.Temperature
+	if response, err := c.queryValue(d, protocol.GetTemperatureInfo{}); err != nil {
+		log.Debug().Msgf("Unable to read the temperature range, using the range of the Litra %s: %v", product.Name, err)
+	} else if r := response.(protocol.GetTemperatureInfo); r.Min < r.Max {
+		info.TemperatureRange = Range{Min: int(r.Min), Max: int(r.Max)}
+	}
+
+	return info, nil
+}
+
+// queryFirmware returns the version of the main application firmware of a device, or of its first
+// firmware entity if none is marked as the application. Must be called with c.mu held.
+func (c *Controller) queryFirmware(d *discoveredDeviceInternal) (string, error) {
+	response, err := c.queryValue(d, protocol.GetDeviceInfo{})
+	if err != nil {
+		return "", err
+	}
+	count := int(response.(protocol.GetDeviceInfo).EntityCount)
+	if count == 0 {
+		return "", fmt.Errorf("device %d (Litra %s, serial: %s) reports no firmware", d.metadata.Index, d.metadata.Name, d.metadata.Serial)
+	}
+
+	var first string
+	for entity := 0; entity < count; entity++ {
+		response, err := c.queryValue(d, protocol.GetFirmwareInfo{Entity: byte(entity)})
+		if err != nil {
+			return "", err
+		}
+		firmware := response.(protocol.GetFirmwareInfo)
+		if firmware.Type == protocol.FirmwareTypeApplication {
+			return firmware.Version(), nil
+		}
+		if entity == 0 {
+			first = firmware.Version()
+		}
+	}
+	return first, nil
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test DeviceInfo reads the firmware version and ranges reported by a light
+func TestDeviceInfo(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1,beam:SIM2")
+	defer cleanup()
+
+	info, err := DeviceInfo(2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, DiscoveredDevice{
+		Index:            2,
+		Name:             "Beam",
+		Serial:           "SIM2",
+		ID:               "SIM2",
+		ProductID:        0xc901,
+		Path:             "sim:SIM2",
+		Firmware:         "SIM 01.00.B0001",
+		BrightnessRange:  Range{Min: 30, Max: 400},
+		TemperatureRange: Range{Min: 2700, Max: 6500},
+	}, info)
+
+	_, err = DeviceInfo(3)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
+
+// Test lights that cannot report their firmware or ranges are given the ranges of their model
+func TestDeviceInfoDefaults(t *testing.T) {
+	mockDevice1, _, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	mockDevice1.On("Write", mock.Anything).Return(20, nil)
+	mockDevice1.On("ReadWithTimeout", mock.Anything, mock.Anything).Return(0, errReadTimeout)
+
+	info, err := DeviceInfo(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "test-serial-Beam", info.Serial)
+	assert.Empty(t, info.Firmware)
+	assert.Equal(t, Range{Min: 30, Max: 400}, info.BrightnessRange)
+	assert.Equal(t, Range{Min: 2700, Max: 6500}, info.TemperatureRange)
+	mockDevice1.AssertCalled(t, "Write", protocol.Encode(protocol.GetBrightnessInfo{}))
+}
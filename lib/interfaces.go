@@ -1,19 +1,21 @@
 package lib
 
 import (
+	"time"
+
 	"github.com/kharyam/go-litra-driver/config"
-	"github.com/sstallion/go-hid"
 )
 
 // HIDDevice is an interface for HID device operations
 type HIDDevice interface {
 	Write(data []byte) (int, error)
+	ReadWithTimeout(data []byte, timeout time.Duration) (int, error)
 	Close() error
 }
 
 // HIDEnumerator is an interface for HID enumeration operations
 type HIDEnumerator interface {
-	Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*hid.DeviceInfo) error) error
+	Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error
 }
 
 // HIDOpener is an interface for opening HID devices
@@ -21,44 +23,74 @@ type HIDOpener interface {
 	Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error)
 }
 
-// DiscoveredDevice represents a connected Litra device with its metadata
+// HIDPathOpener is implemented by HIDOpeners that can open a device by its HID path, which tells
+// apart lights whose serial numbers are empty or shared
+type HIDPathOpener interface {
+	OpenPath(path string) (HIDDevice, error)
+}
+
+// DiscoveredDevice represents a connected Litra device with its metadata. Firmware and the ranges
+// are read from the light by DeviceInfo and left empty by ListDevices.
 type DiscoveredDevice struct {
-	Index     int
-	Name      string
-	Serial    string
-	ProductID uint16
+	Index            int
+	Name             string
+	Serial           string
+	ID               string // identity the settings of the light are saved under, see deviceIDs
+	ProductID        uint16
+	Path             string // HID device path
+	Interface        int    // USB interface number
+	Port             string // USB port as bus-port path (e.g. 1-2.3), empty when unknown
+	Firmware         string // firmware version of the main application
+	BrightnessRange  Range  // raw brightness values accepted by the light
+	TemperatureRange Range  // color temperatures in Kelvin accepted by the light
+}
+
+// Range is an inclusive range of values
+type Range struct {
+	Min int
+	Max int
 }
 
-// ConfigUpdater is an interface for updating config state
+// ConfigUpdater is an interface for updating config state. Per-device state, curves and calibration are
+// keyed by device identity (DiscoveredDevice.ID), with an empty identity holding the state last applied
+// to all devices.
 type ConfigUpdater interface {
-	UpdateCurrentState(deviceIndex int, brightness int, temperature int, power int)
-	ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int)
+	UpdateCurrentState(id string, brightness int, temperature int, power int)
+	ReadCurrentState(id string) (brightness int, temperature int, power int)
+	MigrateDeviceSections(ids []string)
+	MigrateDeviceIdentities(ids map[string]string)
+	ReadCurve(id string) string
+	ReadCalibration(id string) map[string]string
 }
 
 // Default implementations
-type defaultHIDEnumeratorImpl struct{}
+type defaultConfigUpdaterImpl struct{}
 
-func (e *defaultHIDEnumeratorImpl) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*hid.DeviceInfo) error) error {
-	return hid.Enumerate(vendorID, productID, enumerationCallback)
+func (c *defaultConfigUpdaterImpl) UpdateCurrentState(id string, brightness int, temperature int, power int) {
+	config.UpdateCurrentState(id, brightness, temperature, power)
 }
 
-type defaultHIDOpenerImpl struct{}
+func (c *defaultConfigUpdaterImpl) ReadCurrentState(id string) (brightness int, temperature int, power int) {
+	return config.ReadCurrentState(id)
+}
 
-func (o *defaultHIDOpenerImpl) Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error) {
-	return hid.Open(vendorID, productID, serialNumber)
+func (c *defaultConfigUpdaterImpl) MigrateDeviceSections(ids []string) {
+	config.MigrateDeviceSections(ids)
 }
 
-type defaultConfigUpdaterImpl struct{}
+func (c *defaultConfigUpdaterImpl) MigrateDeviceIdentities(ids map[string]string) {
+	config.MigrateDeviceIdentities(ids)
+}
 
-func (c *defaultConfigUpdaterImpl) UpdateCurrentState(deviceIndex int, brightness int, temperature int, power int) {
-	config.UpdateCurrentState(deviceIndex, brightness, temperature, power)
+func (c *defaultConfigUpdaterImpl) ReadCurve(id string) string {
+	return config.GetCurve(id)
 }
 
-func (c *defaultConfigUpdaterImpl) ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
-	return config.ReadCurrentState(deviceIndex)
+func (c *defaultConfigUpdaterImpl) ReadCalibration(id string) map[string]string {
+	return config.GetCalibration(id)
 }
 
-// Default instances
-var defaultHIDEnumerator HIDEnumerator = &defaultHIDEnumeratorImpl{}
-var defaultHIDOpener HIDOpener = &defaultHIDOpenerImpl{}
+// Default instances. The HID backend is selected by UseBackend when the package is initialized.
+var defaultHIDEnumerator HIDEnumerator
+var defaultHIDOpener HIDOpener
 var defaultConfigUpdater ConfigUpdater = &defaultConfigUpdaterImpl{}
@@ -3,212 +3,292 @@
 package lib
 
 import (
-	"encoding/binary"
-	"math"
-	"os"
+	"fmt"
 	"sort"
+	"sync"
 
-	"github.com/rs/zerolog"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
 	"github.com/rs/zerolog/log"
-	"github.com/sstallion/go-hid"
 )
 
 const VendorId = 0x046d
 const LightOffCode = 0x00
 const LightOnCode = 0x01
+
+// MinBrightness and MaxBrightness are the raw brightness range of the Litra Glow. The ranges of
+// every model are described by its Product.
 const MinBrightness = 0x14
 const MaxBrightness = 0xfa
 
-var firstRun = true
+// discoveredDeviceInternal pairs an opened HID device handle with its metadata.
+// device is nil when the device could not be opened; openErr then holds the reason.
+// features caches the feature indices looked up since the device was opened, and curve and calibration
+// are the brightness curve (nil for linear) and calibration configured for the device when it was opened.
+type discoveredDeviceInternal struct {
+	device      HIDDevice
+	metadata    DiscoveredDevice
+	openErr     error
+	features    map[protocol.FeatureID]byte
+	curve       Curve
+	calibration Calibration
+	stats       *DeviceStats
+}
 
-type litraDevice struct {
-	name      string
-	productId uint
+// target describes how values are converted for one light: its model, brightness curve and calibration
+type target struct {
+	product     Product
+	curve       Curve
+	calibration Calibration
 }
 
-var litraProducts = [2]litraDevice{
-	{"Glow",
-		0xc900},
-	{"Beam",
-		0xc901},
+// brightnessCurve returns the brightness curve of the light with its calibration applied (nil for linear)
+func (t target) brightnessCurve() Curve {
+	return t.calibration.curve(t.curve)
 }
 
-// discoveredDeviceInternal pairs an opened HID device handle with its metadata
-type discoveredDeviceInternal struct {
-	device   HIDDevice
-	metadata DiscoveredDevice
+// product returns the registered model of the device
+func (d *discoveredDeviceInternal) product() Product {
+	product, _ := LookupProduct(d.metadata.ProductID)
+	return product
 }
 
-// findDevicesWithDefaults finds all connected Litra devices using default implementations.
-// Devices are sorted by serial number for deterministic ordering and assigned 1-based indices.
-func findDevicesWithDefaults() []discoveredDeviceInternal {
-	var deviceInfos = make(map[string]*hid.DeviceInfo)
-	var productNames = make(map[string]string)
+// target returns the model, brightness curve and calibration of the device
+func (d *discoveredDeviceInternal) target() target {
+	return target{product: d.product(), curve: d.curve, calibration: d.calibration}
+}
 
-	for i := 0; i < len(litraProducts); i++ {
-		productName := litraProducts[i].name
-		defaultHIDEnumerator.Enumerate(VendorId, uint16(litraProducts[i].productId), func(info *hid.DeviceInfo) error {
-			deviceInfos[info.SerialNbr] = info
-			productNames[info.SerialNbr] = productName
+// hidppUsagePage is the vendor usage page of the HID collection that carries the HID++ reports
+const hidppUsagePage = 0xff43
+
+// enumerateDevices lists all connected Litra devices using the default enumerator without opening them.
+// Devices are sorted by serial number and then location for deterministic ordering, assigned 1-based
+// indices and identified (see deviceIDs). A light listed several times at the same location (e.g. once
+// per HID collection) is kept once. hidapi on Windows and macOS lists each collection of a light with
+// its own path, so when a light has a HID++ collection its other collections are left out.
+func enumerateDevices() []DiscoveredDevice {
+	type entry struct {
+		device    DiscoveredDevice
+		usagePage uint16
+	}
+	var entries []entry
+	for _, product := range Products() {
+		productName := product.Name
+		err := defaultHIDEnumerator.Enumerate(VendorId, product.ProductID, func(info *HIDDeviceInfo) error {
+			entries = append(entries, entry{DiscoveredDevice{
+				Name:      productName,
+				Serial:    info.SerialNbr,
+				ProductID: info.ProductID,
+				Path:      info.Path,
+				Interface: info.InterfaceNbr,
+				Port:      usbPort(info.Path),
+			}, info.UsagePage})
 			return nil
 		})
+		if err != nil {
+			log.Debug().Msgf("Failed to enumerate %s devices: %v", productName, err)
+		}
 	}
 
-	// Sort serials for deterministic ordering
-	serials := make([]string, 0, len(deviceInfos))
-	for serial := range deviceInfos {
-		serials = append(serials, serial)
+	// Collections of one light share the product, serial number and port
+	light := func(d DiscoveredDevice) string {
+		return fmt.Sprintf("%04x %s@%s", d.ProductID, d.Serial, d.Port)
 	}
-	sort.Strings(serials)
-
-	var devices []discoveredDeviceInternal
-	for idx, serial := range serials {
-		info := deviceInfos[serial]
-		device, err := defaultHIDOpener.Open(info.VendorID, info.ProductID, info.SerialNbr)
-		if firstRun {
-			log.Debug().Msgf("Found device %s (serial: %s)", productNames[serial], serial)
+	hidpp := make(map[string]bool)
+	for _, e := range entries {
+		if e.usagePage == hidppUsagePage {
+			hidpp[light(e.device)] = true
 		}
-		if err == nil {
-			devices = append(devices, discoveredDeviceInternal{
-				device: device,
-				metadata: DiscoveredDevice{
-					Index:     idx + 1,
-					Name:      productNames[serial],
-					Serial:    serial,
-					ProductID: info.ProductID,
-				},
-			})
-		} else {
-			log.Error().Msgf("ERROR %v", err)
+	}
+
+	var devices []DiscoveredDevice
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if hidpp[light(e.device)] && e.usagePage != hidppUsagePage {
+			continue
+		}
+		key := fmt.Sprintf("%04x %s@%s", e.device.ProductID, e.device.Serial, e.device.location())
+		if !seen[key] {
+			seen[key] = true
+			devices = append(devices, e.device)
 		}
 	}
 
-	firstRun = false
+	sort.SliceStable(devices, func(i, j int) bool {
+		if devices[i].Serial != devices[j].Serial {
+			return devices[i].Serial < devices[j].Serial
+		}
+		return devices[i].location() < devices[j].location()
+	})
+	for idx, id := range deviceIDs(devices) {
+		devices[idx].Index = idx + 1
+		devices[idx].ID = id
+	}
 	return devices
 }
 
-// commandDevices sends a command to connected devices.
-// deviceIndex 0 writes to all devices, deviceIndex > 0 writes only to the matching device.
-func commandDevices(bytes []byte, deviceIndex int) {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	var devices = findDevicesWithDefaults()
+// openDevice opens a device using the default opener, by HID path when the opener supports it so that
+// lights sharing a serial number are told apart. Failures are wrapped in ErrOpenFailed, and the
+// device is traced while tracing is on (see SetTracer).
+func openDevice(metadata DiscoveredDevice) (HIDDevice, error) {
+	var device HIDDevice
+	var err error
+	if opener, ok := defaultHIDOpener.(HIDPathOpener); ok && metadata.Path != "" {
+		device, err = opener.OpenPath(metadata.Path)
+	} else {
+		device, err = defaultHIDOpener.Open(VendorId, metadata.ProductID, metadata.Serial)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: device %d (Litra %s, serial: %s): %v",
+			ErrOpenFailed, metadata.Index, metadata.Name, metadata.Serial, err)
+	}
+	if defaultTracer != nil {
+		device = defaultTracer.wrap(device, metadata)
+	}
+	return device, nil
+}
+
+// writeDevice writes bytes to a single device, returning the number of bytes written and reporting
+// failed and short writes
+func writeDevice(d *discoveredDeviceInternal, bytes []byte) (int, error) {
+	n, err := d.device.Write(bytes)
+	return n, checkWrite(d, len(bytes), n, err)
+}
 
-	for i := 0; i < len(devices); i++ {
-		var d = devices[i]
-		defer d.device.Close()
-		if deviceIndex == 0 || d.metadata.Index == deviceIndex {
-			d.device.Write(bytes)
+// checkWrite wraps the error of a write of size bytes to a device in ErrWriteFailed, and reports a
+// write of fewer bytes as ErrShortWrite
+func checkWrite(d *discoveredDeviceInternal, size int, n int, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: device %d (Litra %s, serial: %s): %w",
+			ErrWriteFailed, d.metadata.Index, d.metadata.Name, d.metadata.Serial, err)
+	}
+	if n < size {
+		return fmt.Errorf("%w: device %d (Litra %s, serial: %s): wrote %d of %d bytes",
+			ErrShortWrite, d.metadata.Index, d.metadata.Name, d.metadata.Serial, n, size)
+	}
+	return nil
+}
+
+var defaultController *Controller
+var defaultControllerMutex sync.Mutex
+
+// getDefaultController returns the controller used by the package-level functions, creating it on first use.
+// While no devices are connected it re-enumerates on every call, so lights plugged in later are picked up.
+func getDefaultController() *Controller {
+	defaultControllerMutex.Lock()
+	defer defaultControllerMutex.Unlock()
+
+	if defaultController == nil {
+		defaultController = &Controller{}
+	}
+	if defaultController.isEmpty() {
+		if err := defaultController.Refresh(); err != nil {
+			log.Debug().Msgf("Failed to open devices: %v", err)
 		}
 	}
+	return defaultController
 }
 
-// ListDevices returns all connected Litra devices with their metadata
-func ListDevices() []DiscoveredDevice {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	devices := findDevicesWithDefaults()
-	result := make([]DiscoveredDevice, len(devices))
-	for i, d := range devices {
-		defer d.device.Close()
-		result[i] = d.metadata
+// Close releases the devices held open by the package-level functions.
+// They are reopened automatically by the next call.
+func Close() error {
+	defaultControllerMutex.Lock()
+	defer defaultControllerMutex.Unlock()
+
+	if defaultController == nil {
+		return nil
 	}
-	return result
+	err := defaultController.Close()
+	defaultController = nil
+	return err
 }
 
-// LightOn turns on detected lights. deviceIndex 0 targets all, 1+ targets a specific device.
-func LightOn(deviceIndex int) {
-	var bytes = []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+// Refresh re-enumerates the devices used by the package-level functions, opening newly connected
+// lights and releasing disconnected ones.
+func Refresh() error {
+	return getDefaultController().Refresh()
+}
 
-	commandDevices(bytes, deviceIndex)
-	defaultConfigUpdater.UpdateCurrentState(deviceIndex, -1, -1, 1)
+// ListDevices returns all connected Litra devices with their metadata. Devices that could not be
+// opened are omitted from the list and reported in the returned error.
+func ListDevices() ([]DiscoveredDevice, error) {
+	return getDefaultController().ListDevices()
 }
 
-// LightOff turns off detected lights. deviceIndex 0 targets all, 1+ targets a specific device.
-func LightOff(deviceIndex int) {
-	var bytes = []byte{0x11, 0xff, 0x04, 0x1c, LightOffCode, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+// DeviceInfo returns the metadata of a light completed with the firmware version and the brightness
+// and temperature ranges it reports. deviceIndex 1+ queries a specific device; deviceIndex 0 queries
+// the first device.
+func DeviceInfo(deviceIndex int) (DiscoveredDevice, error) {
+	return getDefaultController().DeviceInfo(deviceIndex)
+}
 
-	commandDevices(bytes, deviceIndex)
-	defaultConfigUpdater.UpdateCurrentState(deviceIndex, -1, -1, 0)
+// ResolveDevice returns the device index addressed by spec, which may be an index ("0" or "all"
+// for all devices), a serial number or a model name such as "beam".
+func ResolveDevice(spec string) (int, error) {
+	return getDefaultController().ResolveDevice(spec)
+}
+
+// LightOn turns on detected lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func LightOn(deviceIndex int) error {
+	return getDefaultController().LightOn(deviceIndex)
+}
+
+// LightOff turns off detected lights. deviceIndex 0 targets all, 1+ targets a specific device.
+func LightOff(deviceIndex int) error {
+	return getDefaultController().LightOff(deviceIndex)
 }
 
 // LightBrightness sets the brightness of connected lights. Specify a brightness between 0 and 100.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightBrightness(deviceIndex int, level int) {
-	var adjustedLevel = MinBrightness + math.Floor((float64(level)/float64(100))*(MaxBrightness-MinBrightness))
-
-	var bytes = []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(adjustedLevel), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	commandDevices(bytes, deviceIndex)
-	defaultConfigUpdater.UpdateCurrentState(deviceIndex, level, -1, -1)
+func LightBrightness(deviceIndex int, level int) error {
+	return getDefaultController().LightBrightness(deviceIndex, level)
 }
 
-// Function variables for testing
-var lightBrightnessFunc = LightBrightness
-var lightTemperatureFunc = LightTemperature
+// LightLumens sets the light output of connected lights in lumens, which must be within the lumen
+// range of every targeted model. deviceIndex 0 targets all, 1+ targets a specific device.
+func LightLumens(deviceIndex int, lm int) error {
+	return getDefaultController().LightLumens(deviceIndex, lm)
+}
 
 // LightBrightDown decreases the brightness by the amount specified.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightBrightDown(deviceIndex int, inc int) {
-	brightness, _, _ := defaultConfigUpdater.ReadCurrentState(deviceIndex)
-	brightness -= inc
-
-	if brightness < 1 {
-		brightness = 0
-	}
-
-	lightBrightnessFunc(deviceIndex, brightness)
+func LightBrightDown(deviceIndex int, inc int) error {
+	return getDefaultController().LightBrightDown(deviceIndex, inc)
 }
 
 // LightBrightUp increases the brightness by the amount specified.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightBrightUp(deviceIndex int, inc int) {
-	brightness, _, _ := defaultConfigUpdater.ReadCurrentState(deviceIndex)
-	brightness += inc
-
-	if brightness > 100 {
-		brightness = 100
-	}
-
-	lightBrightnessFunc(deviceIndex, brightness)
+func LightBrightUp(deviceIndex int, inc int) error {
+	return getDefaultController().LightBrightUp(deviceIndex, inc)
 }
 
-// LightTemperature sets a light temperature between 2700 and 6500.
+// LightTemperature sets a light temperature in Kelvin, clamped to the range of each model.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightTemperature(deviceIndex int, temp uint16) {
-	tempBytes := make([]byte, 2)
-
-	binary.BigEndian.PutUint16(tempBytes, temp)
-
-	var bytes = []byte{0x11, 0xff, 0x04, 0x9c, tempBytes[0], tempBytes[1], 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-
-	commandDevices(bytes, deviceIndex)
-	defaultConfigUpdater.UpdateCurrentState(deviceIndex, -1, int(temp), -1)
+func LightTemperature(deviceIndex int, temp uint16) error {
+	return getDefaultController().LightTemperature(deviceIndex, temp)
 }
 
 // LightTempDown decreases the temperature by the amount specified.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightTempDown(deviceIndex int, inc int) {
-	_, temp, _ := defaultConfigUpdater.ReadCurrentState(deviceIndex)
-	temp -= inc
-
-	if temp < 2700 {
-		temp = 2700
-	}
-
-	lightTemperatureFunc(deviceIndex, uint16(temp))
+func LightTempDown(deviceIndex int, inc int) error {
+	return getDefaultController().LightTempDown(deviceIndex, inc)
 }
 
 // LightTempUp increases the temperature by the amount specified.
 // deviceIndex 0 targets all, 1+ targets a specific device.
-func LightTempUp(deviceIndex int, inc int) {
-	_, temp, _ := defaultConfigUpdater.ReadCurrentState(deviceIndex)
-	temp += inc
+func LightTempUp(deviceIndex int, inc int) error {
+	return getDefaultController().LightTempUp(deviceIndex, inc)
+}
 
-	if temp > 6500 {
-		temp = 6500
-	}
+// QueryState reads the power, brightness and temperature directly from a light.
+// deviceIndex 1+ queries a specific device; deviceIndex 0 queries the first device,
+// which is representative when all lights are controlled together.
+func QueryState(deviceIndex int) (DeviceState, error) {
+	return getDefaultController().QueryState(deviceIndex)
+}
 
-	lightTemperatureFunc(deviceIndex, uint16(temp))
+// ReadCurrentState returns the brightness, temperature and power of a light. The state is read
+// from the device when possible; if querying fails the last state saved in the config file is used.
+// deviceIndex 0 means all devices, 1+ targets a specific device.
+func ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
+	return getDefaultController().ReadCurrentState(deviceIndex)
 }
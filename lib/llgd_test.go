@@ -1,9 +1,12 @@
 package lib
 
 import (
+	"errors"
 	"testing"
+	"time"
 
-	"github.com/sstallion/go-hid"
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -17,6 +20,11 @@ func (m *MockHIDDevice) Write(data []byte) (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *MockHIDDevice) ReadWithTimeout(data []byte, timeout time.Duration) (int, error) {
+	args := m.Called(data, timeout)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockHIDDevice) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -27,7 +35,7 @@ type MockHIDEnumerator struct {
 	mock.Mock
 }
 
-func (m *MockHIDEnumerator) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*hid.DeviceInfo) error) error {
+func (m *MockHIDEnumerator) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error {
 	args := m.Called(vendorID, productID, enumerationCallback)
 	return args.Error(0)
 }
@@ -47,15 +55,47 @@ type MockConfigUpdater struct {
 	mock.Mock
 }
 
-func (m *MockConfigUpdater) UpdateCurrentState(deviceIndex int, brightness int, temperature int, power int) {
-	m.Called(deviceIndex, brightness, temperature, power)
+func (m *MockConfigUpdater) UpdateCurrentState(serial string, brightness int, temperature int, power int) {
+	m.Called(serial, brightness, temperature, power)
 }
 
-func (m *MockConfigUpdater) ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
-	args := m.Called(deviceIndex)
+func (m *MockConfigUpdater) ReadCurrentState(serial string) (brightness int, temperature int, power int) {
+	args := m.Called(serial)
 	return args.Int(0), args.Int(1), args.Int(2)
 }
 
+func (m *MockConfigUpdater) ReadCurve(serial string) string {
+	args := m.Called(serial)
+	return args.String(0)
+}
+
+func (m *MockConfigUpdater) ReadCalibration(serial string) map[string]string {
+	args := m.Called(serial)
+	return args.Get(0).(map[string]string)
+}
+
+func (m *MockConfigUpdater) MigrateDeviceSections(serials []string) {
+	m.Called(serials)
+}
+
+func (m *MockConfigUpdater) MigrateDeviceIdentities(ids map[string]string) {
+	m.Called(ids)
+}
+
+// brightnessReport returns the report setting a light of the given model to level (0-100)
+func brightnessReport(productID uint16, level int) []byte {
+	product, _ := LookupProduct(productID)
+	raw := product.Brightness.Min + (product.Brightness.Max-product.Brightness.Min)*level/100
+	return []byte{0x11, 0xff, 0x04, 0x4c, byte(raw >> 8), byte(raw), 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+}
+
+// commandBytes returns the report a command builds for a light of the given model
+func commandBytes(build commandBuilder, productID uint16) []byte {
+	product, _ := LookupProduct(productID)
+	return protocol.Encode(build(target{product: product}))
+}
+
 // Setup test environment. Returns two mock devices: device1 is Beam (index 1, sorted first),
 // device2 is Glow (index 2, sorted second) since serials are sorted alphabetically.
 func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOpener, *MockConfigUpdater, func()) {
@@ -63,8 +103,9 @@ func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOp
 	originalHIDEnumerator := defaultHIDEnumerator
 	originalHIDOpener := defaultHIDOpener
 	originalConfigUpdater := defaultConfigUpdater
-	originalLightBrightnessFunc := lightBrightnessFunc
-	originalLightTemperatureFunc := lightTemperatureFunc
+	originalQueryStateFunc := queryStateFunc
+	originalGetFeatureFunc := getFeatureFunc
+	originalSleep := sleep
 
 	// Create mocks - two separate devices for Beam and Glow
 	mockDevice1 := new(MockHIDDevice) // Beam (serial "test-serial-Beam" sorts first)
@@ -77,6 +118,27 @@ func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOp
 	defaultHIDEnumerator = mockEnumerator
 	defaultHIDOpener = mockOpener
 	defaultConfigUpdater = mockConfigUpdater
+	defaultController = nil
+	legacyStateMigration.devices = 0
+	sleep = func(time.Duration) {}
+	mockConfigUpdater.On("MigrateDeviceSections", mock.Anything).Maybe()
+	mockConfigUpdater.On("MigrateDeviceIdentities", mock.Anything).Maybe()
+	mockConfigUpdater.On("ReadCurve", mock.Anything).Return("").Maybe()
+	mockConfigUpdater.On("ReadCalibration", mock.Anything).Return(map[string]string{}).Maybe()
+
+	// Every feature is found at the index the lights have always used
+	getFeatureFunc = func(d *discoveredDeviceInternal, id protocol.FeatureID) (byte, error) {
+		return protocol.DefaultHeader.FeatureIndex, nil
+	}
+
+	// Relative commands fall back to the config file unless a test provides a live device state
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{}, ErrQueryFailed
+	}
+
+	// Handles stay open between commands and are only closed when the controller is released
+	mockDevice1.On("Close").Return(nil).Maybe()
+	mockDevice2.On("Close").Return(nil).Maybe()
 
 	// Map product names to their mock devices (sorted by serial: Beam first, Glow second)
 	mockDevices := map[string]*MockHIDDevice{
@@ -84,23 +146,29 @@ func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOp
 		"Glow": mockDevice2,
 	}
 
-	// Setup mock behavior for findDevices
-	for _, product := range litraProducts {
+	// Setup mock behavior for findDevices. Only the Beam and Glow are connected.
+	for _, product := range Products() {
+		device, connected := mockDevices[product.Name]
+		if !connected {
+			mockEnumerator.On("Enumerate", uint16(VendorId), product.ProductID, mock.Anything).Return(nil)
+			continue
+		}
+
 		// Setup the enumerate call to invoke the callback with our device info
 		mockEnumerator.On("Enumerate",
 			uint16(VendorId),
-			uint16(product.productId),
+			product.ProductID,
 			mock.MatchedBy(func(fn interface{}) bool {
-				_, ok := fn.(func(*hid.DeviceInfo) error)
+				_, ok := fn.(func(*HIDDeviceInfo) error)
 				return ok
 			})).Return(nil).
 			Run(func(args mock.Arguments) {
-				callback := args.Get(2).(func(*hid.DeviceInfo) error)
-				deviceInfo := &hid.DeviceInfo{
+				callback := args.Get(2).(func(*HIDDeviceInfo) error)
+				deviceInfo := &HIDDeviceInfo{
 					VendorID:   uint16(VendorId),
-					ProductID:  uint16(product.productId),
-					SerialNbr:  "test-serial-" + product.name,
-					ProductStr: product.name,
+					ProductID:  product.ProductID,
+					SerialNbr:  "test-serial-" + product.Name,
+					ProductStr: product.Name,
 				}
 				callback(deviceInfo)
 			}).
@@ -109,9 +177,9 @@ func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOp
 		// Setup the open call for this device
 		mockOpener.On("Open",
 			uint16(VendorId),
-			uint16(product.productId),
-			"test-serial-"+product.name).
-			Return(mockDevices[product.name], nil).Once()
+			product.ProductID,
+			"test-serial-"+product.Name).
+			Return(device, nil).Once()
 	}
 
 	// Return cleanup function
@@ -119,13 +187,24 @@ func setupTest() (*MockHIDDevice, *MockHIDDevice, *MockHIDEnumerator, *MockHIDOp
 		defaultHIDEnumerator = originalHIDEnumerator
 		defaultHIDOpener = originalHIDOpener
 		defaultConfigUpdater = originalConfigUpdater
-		lightBrightnessFunc = originalLightBrightnessFunc
-		lightTemperatureFunc = originalLightTemperatureFunc
+		queryStateFunc = originalQueryStateFunc
+		getFeatureFunc = originalGetFeatureFunc
+		sleep = originalSleep
+		defaultController = nil
 	}
 
 	return mockDevice1, mockDevice2, mockEnumerator, mockOpener, mockConfigUpdater, cleanup
 }
 
+// expectEnumerate sets up a connected light to be found once more, as when it is looked up again to
+// reconnect after a failed write
+func expectEnumerate(mockEnumerator *MockHIDEnumerator, productID uint16, serial string) {
+	mockEnumerator.On("Enumerate", uint16(VendorId), productID, mock.Anything).Run(func(args mock.Arguments) {
+		callback := args.Get(2).(func(*HIDDeviceInfo) error)
+		callback(&HIDDeviceInfo{VendorID: uint16(VendorId), ProductID: productID, SerialNbr: serial})
+	}).Return(nil).Once()
+}
+
 // Test LightOn function
 func TestLightOn(t *testing.T) {
 	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
@@ -137,13 +216,11 @@ func TestLightOn(t *testing.T) {
 
 	// Setup expectations - both devices get the write (deviceIndex 0 = all)
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, -1, 1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, -1, 1).Once()
 
 	// Call the function
-	LightOn(0)
+	assert.NoError(t, LightOn(0))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -162,13 +239,11 @@ func TestLightOff(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, -1, 0).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, -1, 0).Once()
 
 	// Call the function
-	LightOff(0)
+	assert.NoError(t, LightOff(0))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -183,21 +258,17 @@ func TestLightBrightness(t *testing.T) {
 
 	// Test with 50% brightness
 	level := 50
-	adjustedLevel := MinBrightness + ((MaxBrightness - MinBrightness) * level / 100)
-
-	// Expected command bytes for setting brightness
-	expectedBytes := []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(adjustedLevel), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	// Expected command bytes for setting brightness, scaled to the range of each model
+	beamBytes := brightnessReport(BeamProductID, level)
+	glowBytes := brightnessReport(GlowProductID, level)
 
 	// Setup expectations
-	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, level, -1, -1).Once()
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", level, -1, -1).Once()
 
 	// Call the function
-	LightBrightness(0, level)
+	assert.NoError(t, LightBrightness(0, level))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -205,6 +276,36 @@ func TestLightBrightness(t *testing.T) {
 	mockConfigUpdater.AssertExpectations(t)
 }
 
+// Test LightLumens sets every model to the same light output and rejects outputs a model cannot reach
+func TestLightLumens(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	// Both models emit one lumen per raw brightness step
+	expectedBytes := protocol.Encode(protocol.SetBrightness{Raw: 180})
+	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
+	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", 41, -1, -1).Once()
+
+	assert.NoError(t, LightLumens(0, 180))
+
+	// The Glow tops out at 250 lm, so nothing is written
+	err := LightLumens(0, 300)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	assert.ErrorContains(t, err, "Litra Glow (serial: test-serial-Glow) supports 20-250 lm, not 300 lm")
+	assert.ErrorIs(t, LightLumens(1, 10), ErrOutOfRange)
+
+	// The Beam alone can
+	beamBytes := protocol.Encode(protocol.SetBrightness{Raw: 300})
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", 73, -1, -1).Once()
+	assert.NoError(t, LightLumens(1, 300))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
 // Test LightBrightDown function
 func TestLightBrightDown(t *testing.T) {
 	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
@@ -212,26 +313,22 @@ func TestLightBrightDown(t *testing.T) {
 
 	// Current brightness is 50%
 	currentBrightness := 50
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(currentBrightness, 4000, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(currentBrightness, 4000, 1).Once()
 
 	// Decrease by 10%
 	decreaseAmount := 10
 	newBrightness := currentBrightness - decreaseAmount
-	adjustedLevel := MinBrightness + ((MaxBrightness - MinBrightness) * newBrightness / 100)
-
-	// Expected command bytes for setting brightness
-	expectedBytes := []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(adjustedLevel), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	// Expected command bytes for setting brightness, scaled to the range of each model
+	beamBytes := brightnessReport(BeamProductID, newBrightness)
+	glowBytes := brightnessReport(GlowProductID, newBrightness)
 
 	// Setup expectations
-	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, newBrightness, -1, -1).Once()
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", newBrightness, -1, -1).Once()
 
 	// Call the function
-	LightBrightDown(0, decreaseAmount)
+	assert.NoError(t, LightBrightDown(0, decreaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -246,26 +343,22 @@ func TestLightBrightDownMinimum(t *testing.T) {
 
 	// Current brightness is 5%
 	currentBrightness := 5
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(currentBrightness, 4000, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(currentBrightness, 4000, 1).Once()
 
 	// Decrease by 10% (should clamp to 0%)
 	decreaseAmount := 10
 	newBrightness := 0
-	adjustedLevel := MinBrightness + ((MaxBrightness - MinBrightness) * newBrightness / 100)
-
-	// Expected command bytes for setting brightness
-	expectedBytes := []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(adjustedLevel), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	// Expected command bytes for setting brightness, scaled to the range of each model
+	beamBytes := brightnessReport(BeamProductID, newBrightness)
+	glowBytes := brightnessReport(GlowProductID, newBrightness)
 
 	// Setup expectations
-	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, newBrightness, -1, -1).Once()
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", newBrightness, -1, -1).Once()
 
 	// Call the function
-	LightBrightDown(0, decreaseAmount)
+	assert.NoError(t, LightBrightDown(0, decreaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -280,26 +373,22 @@ func TestLightBrightUp(t *testing.T) {
 
 	// Current brightness is 50%
 	currentBrightness := 50
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(currentBrightness, 4000, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(currentBrightness, 4000, 1).Once()
 
 	// Increase by 10%
 	increaseAmount := 10
 	newBrightness := currentBrightness + increaseAmount
-	adjustedLevel := MinBrightness + ((MaxBrightness - MinBrightness) * newBrightness / 100)
-
-	// Expected command bytes for setting brightness
-	expectedBytes := []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(adjustedLevel), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	// Expected command bytes for setting brightness, scaled to the range of each model
+	beamBytes := brightnessReport(BeamProductID, newBrightness)
+	glowBytes := brightnessReport(GlowProductID, newBrightness)
 
 	// Setup expectations
-	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, newBrightness, -1, -1).Once()
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", newBrightness, -1, -1).Once()
 
 	// Call the function
-	LightBrightUp(0, increaseAmount)
+	assert.NoError(t, LightBrightUp(0, increaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -314,25 +403,25 @@ func TestLightBrightUpMaximum(t *testing.T) {
 
 	// Current brightness is 95%
 	currentBrightness := 95
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(currentBrightness, 2900, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(currentBrightness, 2900, 1).Once()
 
 	// Increase by 10% (should clamp to 100%)
 	increaseAmount := 10
 	newBrightness := 100
 
-	// Expected command bytes for setting brightness
-	expectedBytes := []byte{0x11, 0xff, 0x04, 0x4c, 0x00, byte(MaxBrightness), 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	// Expected command bytes for setting the maximum brightness of each model
+	beamBytes := brightnessReport(BeamProductID, 100)
+	glowBytes := brightnessReport(GlowProductID, 100)
+	assert.Equal(t, []byte{0x01, 0x90}, beamBytes[4:6])
+	assert.Equal(t, []byte{0x00, MaxBrightness}, glowBytes[4:6])
 
 	// Setup expectations
-	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, newBrightness, -1, -1).Once()
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", newBrightness, -1, -1).Once()
 
 	// Call the function
-	LightBrightUp(0, increaseAmount)
+	assert.NoError(t, LightBrightUp(0, increaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -355,13 +444,11 @@ func TestLightTemperature(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, int(temp), -1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, int(temp), -1).Once()
 
 	// Call the function
-	LightTemperature(0, temp)
+	assert.NoError(t, LightTemperature(0, temp))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -376,7 +463,7 @@ func TestLightTempDown(t *testing.T) {
 
 	// Current temperature is 4000K
 	currentTemp := 4000
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(50, currentTemp, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(50, currentTemp, 1).Once()
 
 	// Decrease by 200K
 	decreaseAmount := 200
@@ -389,13 +476,11 @@ func TestLightTempDown(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, newTemp, -1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, newTemp, -1).Once()
 
 	// Call the function
-	LightTempDown(0, decreaseAmount)
+	assert.NoError(t, LightTempDown(0, decreaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -410,7 +495,7 @@ func TestLightTempDownMinimum(t *testing.T) {
 
 	// Current temperature is 2800K
 	currentTemp := 2800
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(50, currentTemp, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(50, currentTemp, 1).Once()
 
 	// Decrease by 200K (should clamp to 2700K)
 	decreaseAmount := 200
@@ -423,13 +508,11 @@ func TestLightTempDownMinimum(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, newTemp, -1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, newTemp, -1).Once()
 
 	// Call the function
-	LightTempDown(0, decreaseAmount)
+	assert.NoError(t, LightTempDown(0, decreaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -444,7 +527,7 @@ func TestLightTempUp(t *testing.T) {
 
 	// Current temperature is 4000K
 	currentTemp := 4000
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(50, currentTemp, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(50, currentTemp, 1).Once()
 
 	// Increase by 200K
 	increaseAmount := 200
@@ -457,13 +540,11 @@ func TestLightTempUp(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, newTemp, -1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, newTemp, -1).Once()
 
 	// Call the function
-	LightTempUp(0, increaseAmount)
+	assert.NoError(t, LightTempUp(0, increaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -478,7 +559,7 @@ func TestLightTempUpMaximum(t *testing.T) {
 
 	// Current temperature is 6400K
 	currentTemp := 6400
-	mockConfigUpdater.On("ReadCurrentState", 0).Return(50, currentTemp, 1).Once()
+	mockConfigUpdater.On("ReadCurrentState", "").Return(50, currentTemp, 1).Once()
 
 	// Increase by 200K (should clamp to 6500K)
 	increaseAmount := 200
@@ -491,13 +572,11 @@ func TestLightTempUpMaximum(t *testing.T) {
 
 	// Setup expectations
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
 	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 0, -1, newTemp, -1).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, newTemp, -1).Once()
 
 	// Call the function
-	LightTempUp(0, increaseAmount)
+	assert.NoError(t, LightTempUp(0, increaseAmount))
 
 	// Verify expectations
 	mockDevice1.AssertExpectations(t)
@@ -515,12 +594,10 @@ func TestLightOnSingleDevice(t *testing.T) {
 
 	// Only device 1 (Beam) should receive the write
 	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
-	mockDevice1.On("Close").Return(nil).Once()
-	// Device 2 (Glow) should only be closed, not written to
-	mockDevice2.On("Close").Return(nil).Once()
-	mockConfigUpdater.On("UpdateCurrentState", 1, -1, -1, 1).Once()
+	// Device 2 (Glow) should not be written to
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, -1, 1).Once()
 
-	LightOn(1)
+	assert.NoError(t, LightOn(1))
 
 	mockDevice1.AssertExpectations(t)
 	mockDevice2.AssertExpectations(t)
@@ -530,13 +607,11 @@ func TestLightOnSingleDevice(t *testing.T) {
 
 // Test ListDevices function
 func TestListDevices(t *testing.T) {
-	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	_, _, _, _, _, cleanup := setupTest()
 	defer cleanup()
 
-	mockDevice1.On("Close").Return(nil).Once()
-	mockDevice2.On("Close").Return(nil).Once()
-
-	devices := ListDevices()
+	devices, err := ListDevices()
+	assert.NoError(t, err)
 
 	if len(devices) != 2 {
 		t.Fatalf("Expected 2 devices, got %d", len(devices))
@@ -562,3 +637,144 @@ func TestListDevices(t *testing.T) {
 		t.Errorf("Expected second device serial to be test-serial-Glow, got %s", devices[1].Serial)
 	}
 }
+
+// Test that commands report ErrNoDevices when nothing is connected
+func TestLightOnNoDevices(t *testing.T) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	originalConfigUpdater := defaultConfigUpdater
+	defer func() {
+		defaultHIDEnumerator = originalHIDEnumerator
+		defaultConfigUpdater = originalConfigUpdater
+		defaultController = nil
+	}()
+	defaultController = nil
+
+	mockEnumerator := new(MockHIDEnumerator)
+	mockConfigUpdater := new(MockConfigUpdater)
+	defaultHIDEnumerator = mockEnumerator
+	defaultConfigUpdater = mockConfigUpdater
+	mockEnumerator.On("Enumerate", uint16(VendorId), mock.Anything, mock.Anything).Return(nil)
+
+	err := LightOn(0)
+
+	assert.ErrorIs(t, err, ErrNoDevices)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test that targeting a missing device index reports ErrDeviceNotFound
+func TestLightOnDeviceNotFound(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	err := LightOn(5)
+
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	mockDevice1.AssertNotCalled(t, "Write", mock.Anything)
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test that a device which cannot be opened reports ErrOpenFailed
+func TestLightOnOpenFailed(t *testing.T) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	originalHIDOpener := defaultHIDOpener
+	originalConfigUpdater := defaultConfigUpdater
+	defer func() {
+		defaultHIDEnumerator = originalHIDEnumerator
+		defaultHIDOpener = originalHIDOpener
+		defaultConfigUpdater = originalConfigUpdater
+		defaultController = nil
+	}()
+	defaultController = nil
+
+	mockEnumerator := new(MockHIDEnumerator)
+	mockOpener := new(MockHIDOpener)
+	mockConfigUpdater := new(MockConfigUpdater)
+	defaultHIDEnumerator = mockEnumerator
+	defaultHIDOpener = mockOpener
+	defaultConfigUpdater = mockConfigUpdater
+
+	mockEnumerator.On("Enumerate", uint16(VendorId), uint16(0xc900), mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) {
+			callback := args.Get(2).(func(*HIDDeviceInfo) error)
+			callback(&HIDDeviceInfo{VendorID: VendorId, ProductID: 0xc900, SerialNbr: "glow-serial"})
+		})
+	mockEnumerator.On("Enumerate", uint16(VendorId), mock.Anything, mock.Anything).Return(nil)
+	// Opening is retried when the command is sent
+	mockOpener.On("Open", uint16(VendorId), uint16(0xc900), "glow-serial").
+		Return((*MockHIDDevice)(nil), errors.New("permission denied")).Twice()
+
+	err := LightOn(1)
+
+	assert.ErrorIs(t, err, ErrOpenFailed)
+	assert.ErrorContains(t, err, "permission denied")
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test that a failed write reports ErrWriteFailed and leaves the config untouched
+func TestLightOnWriteFailed(t *testing.T) {
+	mockDevice1, mockDevice2, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	expectedBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	// The write fails both before and after the device is reopened
+	mockDevice1.On("Write", expectedBytes).Return(0, errors.New("device disconnected")).Twice()
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	mockOpener.On("Open", uint16(VendorId), uint16(0xc901), "test-serial-Beam").Return(mockDevice1, nil).Once()
+	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
+
+	err := LightOn(0)
+
+	assert.ErrorIs(t, err, ErrWriteFailed)
+	assert.ErrorContains(t, err, "test-serial-Beam")
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test that a partial write reports ErrShortWrite
+func TestLightOnShortWrite(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	expectedBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	mockDevice1.On("Write", expectedBytes).Return(4, nil).Once()
+
+	err := LightOn(1)
+
+	assert.ErrorIs(t, err, ErrShortWrite)
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+}
+
+// Test a light listed once per HID collection, each with its own path as on Windows and macOS, is
+// kept once with its HID++ collection, while lights whose enumerator reports no usage page are kept
+func TestEnumerateDevicesCollections(t *testing.T) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	defer func() { defaultHIDEnumerator = originalHIDEnumerator }()
+
+	mockEnumerator := new(MockHIDEnumerator)
+	defaultHIDEnumerator = mockEnumerator
+	mockEnumerator.On("Enumerate", uint16(VendorId), uint16(0xc900), mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) {
+			callback := args.Get(2).(func(*HIDDeviceInfo) error)
+			callback(&HIDDeviceInfo{ProductID: 0xc900, SerialNbr: "G1", Path: `\\?\hid#vid_046d&pid_c900&col01`, UsagePage: 0x000c})
+			callback(&HIDDeviceInfo{ProductID: 0xc900, SerialNbr: "G1", Path: `\\?\hid#vid_046d&pid_c900&col02`, UsagePage: hidppUsagePage})
+			callback(&HIDDeviceInfo{ProductID: 0xc900, SerialNbr: "G2", Path: "/dev/hidraw3"})
+		})
+	mockEnumerator.On("Enumerate", uint16(VendorId), mock.Anything, mock.Anything).Return(nil)
+
+	assert.Equal(t, []DiscoveredDevice{
+		{Index: 1, Name: "Glow", Serial: "G1", ID: "G1", ProductID: 0xc900, Path: `\\?\hid#vid_046d&pid_c900&col02`},
+		{Index: 2, Name: "Glow", Serial: "G2", ID: "G2", ProductID: 0xc900, Path: "/dev/hidraw3"},
+	}, enumerateDevices())
+
+	// Looking the light up again to reconnect it finds the same collection
+	metadata, found := findDevice(&discoveredDeviceInternal{metadata: DiscoveredDevice{ProductID: 0xc900, Serial: "G1", ID: "G1"}})
+	assert.True(t, found)
+	assert.Equal(t, `\\?\hid#vid_046d&pid_c900&col02`, metadata.Path)
+}
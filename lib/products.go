@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+)
+
+// Product IDs of the built-in Litra models
+const (
+	GlowProductID   = 0xc900
+	BeamProductID   = 0xc901
+	BeamLXProductID = 0xc903
+)
+
+// Product describes a Litra model: its product ID and name, the ranges of its settings and the
+// HID++ features it supports. Lights are detected and controlled through the registered products,
+// so supporting a new model means registering its Product.
+type Product struct {
+	ProductID       uint16
+	Name            string
+	Brightness      Range // raw brightness values accepted by the light
+	Lumens          Range // light output in lumens at the ends of the brightness range
+	Temperature     Range // color temperatures in Kelvin accepted by the light
+	TemperatureStep int   // temperatures are rounded to a multiple of this step
+	BackLightZones  int   // number of RGB zones of the back light, 0 without one
+	Features        []protocol.FeatureID
+}
+
+var productsMutex sync.RWMutex
+
+// products is the registry of known models, in enumeration order
+var products = []Product{
+	{
+		ProductID:       GlowProductID,
+		Name:            "Glow",
+		Brightness:      Range{Min: MinBrightness, Max: MaxBrightness},
+		Lumens:          Range{Min: 20, Max: 250},
+		Temperature:     Range{Min: 2700, Max: 6500},
+		TemperatureStep: 100,
+		Features:        []protocol.FeatureID{protocol.IlluminationFeature},
+	},
+	{
+		ProductID:       BeamProductID,
+		Name:            "Beam",
+		Brightness:      Range{Min: 30, Max: 400},
+		Lumens:          Range{Min: 30, Max: 400},
+		Temperature:     Range{Min: 2700, Max: 6500},
+		TemperatureStep: 100,
+		Features:        []protocol.FeatureID{protocol.IlluminationFeature},
+	},
+	{
+		ProductID:       BeamLXProductID,
+		Name:            "Beam LX",
+		Brightness:      Range{Min: 30, Max: 400},
+		Lumens:          Range{Min: 30, Max: 400},
+		Temperature:     Range{Min: 2700, Max: 6500},
+		TemperatureStep: 100,
+		BackLightZones:  7,
+		Features: []protocol.FeatureID{protocol.IlluminationFeature, protocol.BackLightFeature,
+			protocol.RGBEffectsFeature},
+	},
+}
+
+// RegisterProduct adds a model to the registry, so lights with its product ID are detected by the
+// next Refresh and controlled within its ranges. The product ID must not already be registered.
+func RegisterProduct(product Product) error {
+	if product.ProductID == 0 || product.Name == "" {
+		return errors.New("a product needs a product ID and a name")
+	}
+	if product.Brightness.Min >= product.Brightness.Max || product.Temperature.Min >= product.Temperature.Max {
+		return fmt.Errorf("product %s: invalid brightness or temperature range", product.Name)
+	}
+	if product.TemperatureStep <= 0 {
+		return fmt.Errorf("product %s: the temperature step must be positive", product.Name)
+	}
+	if product.BackLightZones < 0 {
+		return fmt.Errorf("product %s: the number of back light zones cannot be negative", product.Name)
+	}
+
+	productsMutex.Lock()
+	defer productsMutex.Unlock()
+
+	for _, p := range products {
+		if p.ProductID == product.ProductID {
+			return fmt.Errorf("product ID 0x%04x is already registered as %s", product.ProductID, p.Name)
+		}
+	}
+	products = append(products, product)
+	return nil
+}
+
+// Products returns the registered models
+func Products() []Product {
+	productsMutex.RLock()
+	defer productsMutex.RUnlock()
+	return slices.Clone(products)
+}
+
+// LookupProduct returns the registered model with the given product ID
+func LookupProduct(productID uint16) (Product, bool) {
+	productsMutex.RLock()
+	defer productsMutex.RUnlock()
+
+	for _, p := range products {
+		if p.ProductID == productID {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+// lookupProductByName returns the registered model with the given name, ignoring case
+func lookupProductByName(name string) (Product, bool) {
+	productsMutex.RLock()
+	defer productsMutex.RUnlock()
+
+	for _, p := range products {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+// Supports returns true if the model has the HID++ feature
+func (p Product) Supports(feature protocol.FeatureID) bool {
+	return slices.Contains(p.Features, feature)
+}
+
+// commonFeatures are the HID++ 2.0 features every Litra light has at the first indices, followed by
+// the Features of its model
+var commonFeatures = []protocol.FeatureID{
+	protocol.RootFeature,
+	protocol.FeatureSetFeature,
+	protocol.DeviceInformationFeature,
+	protocol.DeviceNameFeature,
+}
+
+// featureLayout lists the HID++ 2.0 features of lights of the model by index, as laid out by real
+// Litra lights
+func (p Product) featureLayout() []protocol.FeatureID {
+	return append(slices.Clone(commonFeatures), p.Features...)
+}
+
+// defaultFeatureIndex returns the index of a feature in the layout of the model, which is used when
+// the index cannot be looked up on the light, and false if the model does not have the feature
+func (p Product) defaultFeatureIndex(id protocol.FeatureID) (byte, bool) {
+	index := slices.Index(p.featureLayout(), id)
+	return byte(index), index >= 0
+}
+
+// rawBrightness converts a brightness level between 0 and 100 to the raw brightness of the model,
+// following the brightness curve (Linear if nil)
+func (p Product) rawBrightness(level int, curve Curve) uint16 {
+	level = min(max(level, 0), 100)
+	span := float64(p.Brightness.Max - p.Brightness.Min)
+	if curve == nil {
+		return uint16(p.Brightness.Min + int(math.Floor(float64(level)/100*span)))
+	}
+	// Round rather than truncate, so the level read back is the nearest to the one that was set
+	output := min(max(curve(float64(level)/100), 0), 1)
+	return uint16(p.Brightness.Min + int(math.Round(output*span)))
+}
+
+// brightnessLevel converts a raw brightness reported by a light of the model to a level between 0 and 100,
+// inverting the brightness curve (Linear if nil)
+func (p Product) brightnessLevel(raw uint16, curve Curve) int {
+	if p.Brightness.Max <= p.Brightness.Min {
+		return 0
+	}
+	if curve == nil {
+		level := int(math.Round(float64(int(raw)-p.Brightness.Min) * 100 / float64(p.Brightness.Max-p.Brightness.Min)))
+		return min(max(level, 0), 100)
+	}
+	output := min(max(float64(int(raw)-p.Brightness.Min)/float64(p.Brightness.Max-p.Brightness.Min), 0), 1)
+	return int(math.Round(invertCurve(curve, output) * 100))
+}
+
+// rawLumens converts a light output in lumens, within the lumen range of the model, to its raw brightness
+func (p Product) rawLumens(lm int) uint16 {
+	lm = min(max(lm, p.Lumens.Min), p.Lumens.Max)
+	if p.Lumens.Max <= p.Lumens.Min {
+		return uint16(p.Brightness.Min)
+	}
+	scale := float64(p.Brightness.Max-p.Brightness.Min) / float64(p.Lumens.Max-p.Lumens.Min)
+	return uint16(p.Brightness.Min + int(math.Round(float64(lm-p.Lumens.Min)*scale)))
+}
+
+// lumens converts a raw brightness reported by a light of the model to its light output in lumens
+func (p Product) lumens(raw uint16) int {
+	if p.Brightness.Max <= p.Brightness.Min {
+		return p.Lumens.Min
+	}
+	raw = uint16(min(max(int(raw), p.Brightness.Min), p.Brightness.Max))
+	scale := float64(p.Lumens.Max-p.Lumens.Min) / float64(p.Brightness.Max-p.Brightness.Min)
+	return p.Lumens.Min + int(math.Round(float64(int(raw)-p.Brightness.Min)*scale))
+}
+
+// clampTemperature limits a temperature to the range of the model and rounds it to the model's step
+func (p Product) clampTemperature(temp int) uint16 {
+	if p.TemperatureStep > 0 {
+		temp = p.Temperature.Min + int(math.Round(float64(temp-p.Temperature.Min)/float64(p.TemperatureStep)))*p.TemperatureStep
+	}
+	return uint16(min(max(temp, p.Temperature.Min), p.Temperature.Max))
+}
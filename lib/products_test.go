@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test brightnessLevel inverts the brightness calculation used by LightBrightness for every model
+func TestBrightnessLevel(t *testing.T) {
+	for _, product := range Products() {
+		for level := 0; level <= 100; level++ {
+			raw := float64(product.Brightness.Min) + math.Floor((float64(level)/float64(100))*float64(product.Brightness.Max-product.Brightness.Min))
+			assert.Equal(t, uint16(raw), product.rawBrightness(level, nil), product.Name)
+			assert.Equal(t, level, product.brightnessLevel(uint16(raw), nil), product.Name)
+		}
+		assert.Equal(t, 0, product.brightnessLevel(0, nil))
+		assert.Equal(t, 100, product.brightnessLevel(1000, nil))
+	}
+}
+
+// Test values outside the range of a model are clamped, and temperatures rounded to its step
+func TestProductClamping(t *testing.T) {
+	glow, ok := LookupProduct(GlowProductID)
+	assert.True(t, ok)
+
+	assert.Equal(t, uint16(MinBrightness), glow.rawBrightness(-10, nil))
+	assert.Equal(t, uint16(MaxBrightness), glow.rawBrightness(150, nil))
+	assert.Equal(t, uint16(6500), glow.clampTemperature(9000))
+	assert.Equal(t, uint16(2700), glow.clampTemperature(1000))
+	assert.Equal(t, uint16(4100), glow.clampTemperature(4060))
+	assert.Equal(t, uint16(4000), glow.clampTemperature(4049))
+}
+
+// Test lumens convert to raw brightness and back for every model
+func TestProductLumens(t *testing.T) {
+	for _, product := range Products() {
+		for lm := product.Lumens.Min; lm <= product.Lumens.Max; lm++ {
+			raw := product.rawLumens(lm)
+			assert.GreaterOrEqual(t, int(raw), product.Brightness.Min, product.Name)
+			assert.LessOrEqual(t, int(raw), product.Brightness.Max, product.Name)
+			assert.Equal(t, lm, product.lumens(raw), product.Name)
+		}
+		assert.Equal(t, product.Lumens.Max, product.lumens(product.rawBrightness(100, nil)), product.Name)
+		assert.Equal(t, product.Lumens.Min, product.lumens(0), product.Name)
+	}
+
+	lamp := Product{Brightness: Range{Min: 0, Max: 1000}, Lumens: Range{Min: 100, Max: 600}}
+	assert.Equal(t, uint16(500), lamp.rawLumens(350))
+	assert.Equal(t, 350, lamp.lumens(500))
+}
+
+// Test LightTemperature never sends a temperature a light does not support
+func TestLightTemperatureClamped(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	expectedBytes := protocol.Encode(protocol.SetTemperature{Kelvin: 6500})
+	mockDevice1.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
+	mockDevice2.On("Write", expectedBytes).Return(len(expectedBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", -1, 6500, -1).Once()
+
+	assert.NoError(t, LightTemperature(0, 9000))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test registering a model makes it detectable and rejects invalid or duplicate descriptors
+func TestRegisterProduct(t *testing.T) {
+	originalProducts := Products()
+	defer func() { products = originalProducts }()
+
+	lamp := Product{
+		ProductID:       0xc9ff,
+		Name:            "Lamp",
+		Brightness:      Range{Min: 10, Max: 100},
+		Lumens:          Range{Min: 10, Max: 100},
+		Temperature:     Range{Min: 3000, Max: 5000},
+		TemperatureStep: 50,
+		Features:        []protocol.FeatureID{protocol.IlluminationFeature},
+	}
+	assert.NoError(t, RegisterProduct(lamp))
+
+	registered, ok := LookupProduct(0xc9ff)
+	assert.True(t, ok)
+	assert.Equal(t, lamp, registered)
+	assert.True(t, registered.Supports(protocol.IlluminationFeature))
+	assert.False(t, registered.Supports(protocol.DeviceNameFeature))
+	found, ok := lookupProductByName("lamp")
+	assert.True(t, ok)
+	assert.Equal(t, lamp, found)
+
+	assert.ErrorContains(t, RegisterProduct(lamp), "already registered as Lamp")
+	assert.Error(t, RegisterProduct(Product{ProductID: 0xc9fe, Name: "Broken", TemperatureStep: 100}))
+	assert.Error(t, RegisterProduct(Product{Name: "Nameless"}))
+}
+
+// Test LightTempDown and LightTempUp stop at the temperature range of the light rather than 2700-6500
+func TestLightTempStepClamped(t *testing.T) {
+	originalProducts := Products()
+	defer func() { products = originalProducts }()
+	assert.NoError(t, RegisterProduct(Product{
+		ProductID:       0xc9ff,
+		Name:            "Lamp",
+		Brightness:      Range{Min: 10, Max: 100},
+		Lumens:          Range{Min: 10, Max: 100},
+		Temperature:     Range{Min: 3000, Max: 5000},
+		TemperatureStep: 50,
+		Features:        []protocol.FeatureID{protocol.IlluminationFeature},
+	}))
+	_, cleanup := setupSimulatorTest(t, "lamp:L1")
+	defer cleanup()
+
+	assert.NoError(t, LightTemperature(1, 3100))
+	assert.NoError(t, LightTempDown(1, 500))
+	state, err := QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, state.Temperature)
+
+	// Going below 0 does not wrap around to the highest temperature
+	assert.NoError(t, LightTempDown(1, 4000))
+	state, err = QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, state.Temperature)
+
+	assert.NoError(t, LightTempUp(1, 5000))
+	state, err = QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 5000, state.Temperature)
+}
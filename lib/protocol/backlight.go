@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Function codes of the back light of the Beam LX (BackLightFeature)
+const (
+	SetBackBrightnessFunction Function = 0x2b
+	SetBackPowerFunction      Function = 0x4b
+)
+
+// Function codes of the RGB zones of the Beam LX back light (RGBEffectsFeature)
+const (
+	SetZoneColorFunction Function = 0x1b
+	CommitColorsFunction Function = 0x7b
+)
+
+// commitColorsFlag is the last parameter of CommitColors, which the Beam LX expects to be set
+const commitColorsFlag = 0x01
+
+// SetBackPower switches the back light on or off
+type SetBackPower struct{ On bool }
+
+func (c SetBackPower) Feature() FeatureID { return BackLightFeature }
+func (c SetBackPower) Function() Function { return SetBackPowerFunction }
+func (c SetBackPower) Params() []byte     { return boolParams(c.On) }
+func (c SetBackPower) String() string     { return fmt.Sprintf("SetBackPower(on=%t)", c.On) }
+
+// SetBackBrightness sets the brightness of the back light as a percentage between 1 and 100
+type SetBackBrightness struct{ Percent byte }
+
+func (c SetBackBrightness) Feature() FeatureID { return BackLightFeature }
+func (c SetBackBrightness) Function() Function { return SetBackBrightnessFunction }
+func (c SetBackBrightness) Params() []byte     { return uint16Params(uint16(c.Percent)) }
+func (c SetBackBrightness) String() string {
+	return fmt.Sprintf("SetBackBrightness(percent=%d)", c.Percent)
+}
+
+// SetZoneColor sets the color of one zone of the back light. Colors only show once CommitColors is sent.
+type SetZoneColor struct {
+	Zone  byte
+	Red   byte
+	Green byte
+	Blue  byte
+}
+
+func (c SetZoneColor) Feature() FeatureID { return RGBEffectsFeature }
+func (c SetZoneColor) Function() Function { return SetZoneColorFunction }
+func (c SetZoneColor) Params() []byte     { return []byte{c.Zone, c.Red, c.Green, c.Blue} }
+func (c SetZoneColor) String() string {
+	return fmt.Sprintf("SetZoneColor(zone=%d, color=#%02x%02x%02x)", c.Zone, c.Red, c.Green, c.Blue)
+}
+
+// CommitColors applies the zone colors set since the last commit
+type CommitColors struct{}
+
+func (c CommitColors) Feature() FeatureID { return RGBEffectsFeature }
+func (c CommitColors) Function() Function { return CommitColorsFunction }
+func (c CommitColors) Params() []byte     { return []byte{0x00, 0x00, commitColorsFlag} }
+func (c CommitColors) String() string     { return "CommitColors()" }
+
+// decodeBackBrightness reads the percentage written by SetBackBrightness.Params
+func decodeBackBrightness(p []byte) Command {
+	return SetBackBrightness{Percent: byte(binary.BigEndian.Uint16(p))}
+}
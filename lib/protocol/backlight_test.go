@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test back light commands encode their parameters and decode back to the same command
+func TestBackLightCommands(t *testing.T) {
+	header := Header{DeviceIndex: 0xff, FeatureIndex: 0x0c}
+
+	report := EncodeWith(header, SetZoneColor{Zone: 3, Red: 0xff, Green: 0x88, Blue: 0x00})
+	assert.Equal(t, []byte{0x11, 0xff, 0x0c, 0x1b, 0x03, 0xff, 0x88, 0x00}, report[:8])
+	assert.Equal(t, []byte{0x00, 0x00, 0x01}, EncodeWith(header, CommitColors{})[4:7])
+
+	for _, cmd := range []Command{
+		SetZoneColor{Zone: 3, Red: 0xff, Green: 0x88, Blue: 0x00},
+		CommitColors{},
+		SetBackPower{On: true},
+		SetBackBrightness{Percent: 60},
+	} {
+		_, decoded, err := DecodeFeature(cmd.Feature(), EncodeWith(header, cmd))
+		assert.NoError(t, err)
+		assert.Equal(t, cmd, decoded)
+	}
+
+	assert.Equal(t, "SetZoneColor(zone=3, color=#ff8800)", SetZoneColor{Zone: 3, Red: 0xff, Green: 0x88}.String())
+	assert.Equal(t, "SetBackBrightness", FunctionName(BackLightFeature, SetBackBrightnessFunction))
+}
@@ -0,0 +1,225 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Function is the function code of a report, combining the HID++ function ID (high nibble) with
+// the software ID (low nibble)
+type Function byte
+
+// Function codes of the illumination feature (IlluminationFeature)
+const (
+	GetPowerFunction       Function = 0x01
+	SetPowerFunction       Function = 0x1c
+	GetBrightnessFunction  Function = 0x31
+	SetBrightnessFunction  Function = 0x4c
+	GetTemperatureFunction Function = 0x81
+	SetTemperatureFunction Function = 0x9c
+
+	GetBrightnessInfoFunction  Function = 0x21
+	GetTemperatureInfoFunction Function = 0x71
+)
+
+// FunctionInfo describes a known function code of a feature
+type FunctionInfo struct {
+	Name   string
+	decode func(params []byte) Command
+}
+
+// registry lists the known function codes of each feature. Function codes are only unique within
+// a feature, so reports are decoded by feature and function code.
+var registry = map[FeatureID]map[Function]FunctionInfo{
+	IlluminationFeature: {
+		GetPowerFunction: {"GetPower", func(p []byte) Command {
+			return GetPower{On: p[0] == 1}
+		}},
+		SetPowerFunction: {"SetPower", func(p []byte) Command {
+			return SetPower{On: p[0] == 1}
+		}},
+		GetBrightnessFunction: {"GetBrightness", func(p []byte) Command {
+			return GetBrightness{Raw: binary.BigEndian.Uint16(p)}
+		}},
+		SetBrightnessFunction: {"SetBrightness", func(p []byte) Command {
+			return SetBrightness{Raw: binary.BigEndian.Uint16(p)}
+		}},
+		GetTemperatureFunction: {"GetTemperature", func(p []byte) Command {
+			return GetTemperature{Kelvin: binary.BigEndian.Uint16(p)}
+		}},
+		SetTemperatureFunction: {"SetTemperature", func(p []byte) Command {
+			return SetTemperature{Kelvin: binary.BigEndian.Uint16(p)}
+		}},
+		GetBrightnessInfoFunction: {"GetBrightnessInfo", func(p []byte) Command {
+			return GetBrightnessInfo(decodeRangeInfo(p))
+		}},
+		GetTemperatureInfoFunction: {"GetTemperatureInfo", func(p []byte) Command {
+			return GetTemperatureInfo(decodeRangeInfo(p))
+		}},
+	},
+	BackLightFeature: {
+		SetBackPowerFunction: {"SetBackPower", func(p []byte) Command {
+			return SetBackPower{On: p[0] == 1}
+		}},
+		SetBackBrightnessFunction: {"SetBackBrightness", decodeBackBrightness},
+	},
+	RGBEffectsFeature: {
+		SetZoneColorFunction: {"SetZoneColor", func(p []byte) Command {
+			return SetZoneColor{Zone: p[0], Red: p[1], Green: p[2], Blue: p[3]}
+		}},
+		CommitColorsFunction: {"CommitColors", func(p []byte) Command {
+			return CommitColors{}
+		}},
+	},
+	DeviceInformationFeature: {
+		GetDeviceInfoFunction: {"GetDeviceInfo", func(p []byte) Command {
+			return GetDeviceInfo{EntityCount: p[0]}
+		}},
+		GetFirmwareInfoFunction: {"GetFirmwareInfo", decodeFirmwareInfo},
+	},
+	RootFeature: {
+		GetFeatureFunction: {"GetFeature", func(p []byte) Command {
+			return GetFeature{Index: p[0], Type: p[1], Version: p[2]}
+		}},
+	},
+	FeatureSetFeature: {
+		GetFeatureCountFunction: {"GetFeatureCount", func(p []byte) Command {
+			return GetFeatureCount{Count: p[0]}
+		}},
+		GetFeatureIDFunction: {"GetFeatureID", func(p []byte) Command {
+			return GetFeatureID{ID: decodeFeatureID(p), Type: p[2], Version: p[3]}
+		}},
+	},
+}
+
+// Lookup returns the registry entry of a function code of a feature
+func Lookup(feature FeatureID, function Function) (FunctionInfo, bool) {
+	info, ok := registry[feature][function]
+	return info, ok
+}
+
+// FunctionName returns the registered name of a function of a feature, or its code if it is unknown
+func FunctionName(feature FeatureID, function Function) string {
+	if info, ok := Lookup(feature, function); ok {
+		return info.Name
+	}
+	return fmt.Sprintf("0x%02x", byte(function))
+}
+
+// LookupFunction returns the function code of a feature registered under name, ignoring case
+func LookupFunction(feature FeatureID, name string) (Function, bool) {
+	for function, info := range registry[feature] {
+		if strings.EqualFold(info.Name, name) {
+			return function, true
+		}
+	}
+	return 0, false
+}
+
+// Command is a typed report payload. Params returns at most 16 bytes of parameters.
+type Command interface {
+	Feature() FeatureID
+	Function() Function
+	Params() []byte
+	String() string
+}
+
+// uint16Params encodes a 16 bit big endian value as the first parameters
+func uint16Params(value uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, value)
+}
+
+// boolParams encodes a flag as the first parameter
+func boolParams(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// GetPower reads whether the light is on. On is only set in responses.
+type GetPower struct{ On bool }
+
+func (c GetPower) Feature() FeatureID { return IlluminationFeature }
+func (c GetPower) Function() Function { return GetPowerFunction }
+func (c GetPower) Params() []byte     { return boolParams(c.On) }
+func (c GetPower) String() string     { return fmt.Sprintf("GetPower(on=%t)", c.On) }
+
+// SetPower switches the light on or off
+type SetPower struct{ On bool }
+
+func (c SetPower) Feature() FeatureID { return IlluminationFeature }
+func (c SetPower) Function() Function { return SetPowerFunction }
+func (c SetPower) Params() []byte     { return boolParams(c.On) }
+func (c SetPower) String() string     { return fmt.Sprintf("SetPower(on=%t)", c.On) }
+
+// GetBrightness reads the raw brightness. Raw is only set in responses.
+type GetBrightness struct{ Raw uint16 }
+
+func (c GetBrightness) Feature() FeatureID { return IlluminationFeature }
+func (c GetBrightness) Function() Function { return GetBrightnessFunction }
+func (c GetBrightness) Params() []byte     { return uint16Params(c.Raw) }
+func (c GetBrightness) String() string     { return fmt.Sprintf("GetBrightness(raw=%d)", c.Raw) }
+
+// SetBrightness sets the raw brightness, whose range depends on the model
+type SetBrightness struct{ Raw uint16 }
+
+func (c SetBrightness) Feature() FeatureID { return IlluminationFeature }
+func (c SetBrightness) Function() Function { return SetBrightnessFunction }
+func (c SetBrightness) Params() []byte     { return uint16Params(c.Raw) }
+func (c SetBrightness) String() string     { return fmt.Sprintf("SetBrightness(raw=%d)", c.Raw) }
+
+// GetTemperature reads the color temperature. Kelvin is only set in responses.
+type GetTemperature struct{ Kelvin uint16 }
+
+func (c GetTemperature) Feature() FeatureID { return IlluminationFeature }
+func (c GetTemperature) Function() Function { return GetTemperatureFunction }
+func (c GetTemperature) Params() []byte     { return uint16Params(c.Kelvin) }
+func (c GetTemperature) String() string     { return fmt.Sprintf("GetTemperature(kelvin=%d)", c.Kelvin) }
+
+// SetTemperature sets the color temperature in Kelvin
+type SetTemperature struct{ Kelvin uint16 }
+
+func (c SetTemperature) Feature() FeatureID { return IlluminationFeature }
+func (c SetTemperature) Function() Function { return SetTemperatureFunction }
+func (c SetTemperature) Params() []byte     { return uint16Params(c.Kelvin) }
+func (c SetTemperature) String() string     { return fmt.Sprintf("SetTemperature(kelvin=%d)", c.Kelvin) }
+
+// RangeInfo is the range of values a light supports for a setting
+type RangeInfo struct {
+	Capabilities byte
+	Min          uint16
+	Max          uint16
+}
+
+// params encodes the capabilities followed by the big endian minimum and maximum
+func (r RangeInfo) params() []byte {
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16([]byte{r.Capabilities}, r.Min), r.Max)
+}
+
+// decodeRangeInfo decodes the parameters written by RangeInfo.params
+func decodeRangeInfo(p []byte) RangeInfo {
+	return RangeInfo{Capabilities: p[0], Min: binary.BigEndian.Uint16(p[1:3]), Max: binary.BigEndian.Uint16(p[3:5])}
+}
+
+// GetBrightnessInfo reads the raw brightness range of the light. The range is only set in responses.
+type GetBrightnessInfo RangeInfo
+
+func (c GetBrightnessInfo) Feature() FeatureID { return IlluminationFeature }
+func (c GetBrightnessInfo) Function() Function { return GetBrightnessInfoFunction }
+func (c GetBrightnessInfo) Params() []byte     { return RangeInfo(c).params() }
+func (c GetBrightnessInfo) String() string {
+	return fmt.Sprintf("GetBrightnessInfo(min=%d, max=%d)", c.Min, c.Max)
+}
+
+// GetTemperatureInfo reads the color temperature range of the light in Kelvin. The range is only set
+// in responses.
+type GetTemperatureInfo RangeInfo
+
+func (c GetTemperatureInfo) Feature() FeatureID { return IlluminationFeature }
+func (c GetTemperatureInfo) Function() Function { return GetTemperatureInfoFunction }
+func (c GetTemperatureInfo) Params() []byte     { return RangeInfo(c).params() }
+func (c GetTemperatureInfo) String() string {
+	return fmt.Sprintf("GetTemperatureInfo(min=%d, max=%d)", c.Min, c.Max)
+}
@@ -0,0 +1,41 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the registry names functions and commands describe themselves
+func TestFunctionNames(t *testing.T) {
+	info, ok := Lookup(IlluminationFeature, SetBrightnessFunction)
+	assert.True(t, ok)
+	assert.Equal(t, "SetBrightness", info.Name)
+	_, ok = Lookup(IlluminationFeature, 0x2c)
+	assert.False(t, ok)
+
+	// Function codes are only unique within a feature
+	assert.Equal(t, "GetPower", FunctionName(IlluminationFeature, 0x01))
+	assert.Equal(t, "GetFeature", FunctionName(RootFeature, 0x01))
+	assert.Equal(t, "GetFeatureCount", FunctionName(FeatureSetFeature, 0x01))
+	assert.Equal(t, "0x2c", FunctionName(IlluminationFeature, 0x2c))
+
+	function, ok := LookupFunction(IlluminationFeature, "setbrightness")
+	assert.True(t, ok)
+	assert.Equal(t, SetBrightnessFunction, function)
+	function, ok = LookupFunction(FeatureSetFeature, "GetFeatureID")
+	assert.True(t, ok)
+	assert.Equal(t, GetFeatureIDFunction, function)
+	_, ok = LookupFunction(RootFeature, "SetBrightness")
+	assert.False(t, ok)
+	assert.Equal(t, "SetTemperature(kelvin=4000)", SetTemperature{Kelvin: 4000}.String())
+	assert.Equal(t, "SetPower(on=true)", SetPower{On: true}.String())
+
+	for feature, functions := range registry {
+		for function, info := range functions {
+			decoded := info.decode(make([]byte, 16))
+			assert.Equal(t, feature, decoded.Feature(), info.Name)
+			assert.Equal(t, function, decoded.Function(), info.Name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Function codes of the device information feature (DeviceInformationFeature)
+const (
+	GetDeviceInfoFunction   Function = 0x01
+	GetFirmwareInfoFunction Function = 0x11
+)
+
+// FirmwareTypeApplication is the firmware type of the main application, as opposed to e.g. the bootloader
+const FirmwareTypeApplication = 0x00
+
+// GetDeviceInfo reads how many firmware entities the device has. EntityCount is only set in responses.
+type GetDeviceInfo struct{ EntityCount byte }
+
+func (c GetDeviceInfo) Feature() FeatureID { return DeviceInformationFeature }
+func (c GetDeviceInfo) Function() Function { return GetDeviceInfoFunction }
+func (c GetDeviceInfo) Params() []byte     { return []byte{c.EntityCount} }
+func (c GetDeviceInfo) String() string {
+	return fmt.Sprintf("GetDeviceInfo(entities=%d)", c.EntityCount)
+}
+
+// GetFirmwareInfo reads the firmware of the entity at Entity. The other fields are only set in responses.
+type GetFirmwareInfo struct {
+	Entity   byte
+	Type     byte
+	Prefix   string
+	Number   byte
+	Revision byte
+	Build    uint16
+}
+
+func (c GetFirmwareInfo) Feature() FeatureID { return DeviceInformationFeature }
+func (c GetFirmwareInfo) Function() Function { return GetFirmwareInfoFunction }
+func (c GetFirmwareInfo) Params() []byte     { return []byte{c.Entity} }
+func (c GetFirmwareInfo) ResponseParams() []byte {
+	params := []byte{c.Type, 0, 0, 0, c.Number, c.Revision}
+	copy(params[1:4], c.Prefix)
+	return binary.BigEndian.AppendUint16(params, c.Build)
+}
+func (c GetFirmwareInfo) String() string {
+	return fmt.Sprintf("GetFirmwareInfo(entity=%d, type=%d, version=%s)", c.Entity, c.Type, c.Version())
+}
+
+// Version formats the firmware version as prefix, number, revision and build, e.g. "LIT 01.02.B0012"
+func (c GetFirmwareInfo) Version() string {
+	version := fmt.Sprintf("%02X.%02X", c.Number, c.Revision)
+	if c.Build != 0 {
+		version += fmt.Sprintf(".B%04X", c.Build)
+	}
+	if c.Prefix == "" {
+		return version
+	}
+	return c.Prefix + " " + version
+}
+
+// decodeFirmwareInfo decodes the response to GetFirmwareInfo
+func decodeFirmwareInfo(p []byte) Command {
+	return GetFirmwareInfo{
+		Type:     p[0],
+		Prefix:   strings.TrimRight(string(p[1:4]), "\x00 "),
+		Number:   p[4],
+		Revision: p[5],
+		Build:    binary.BigEndian.Uint16(p[6:8]),
+	}
+}
@@ -0,0 +1,28 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test firmware information is requested by entity and decoded from responses
+func TestFirmwareInfo(t *testing.T) {
+	header := Header{DeviceIndex: 0xff, FeatureIndex: 0x02}
+
+	_, decoded, err := DecodeRequest(DeviceInformationFeature, EncodeWith(header, GetFirmwareInfo{Entity: 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, GetFirmwareInfo{Entity: 1}, decoded)
+
+	response := EncodeResponse(header, GetFirmwareInfo{Prefix: "LIT", Number: 0x01, Revision: 0x02, Build: 0x12})
+	assert.Equal(t, []byte{0x00, 'L', 'I', 'T', 0x01, 0x02, 0x00, 0x12}, response[4:12])
+	_, decoded, err = DecodeFeature(DeviceInformationFeature, response)
+	assert.NoError(t, err)
+	assert.Equal(t, "LIT 01.02.B0012", decoded.(GetFirmwareInfo).Version())
+
+	assert.Equal(t, "26.01", GetFirmwareInfo{Number: 0x26, Revision: 0x01}.Version())
+
+	_, decoded, err = DecodeFeature(DeviceInformationFeature, EncodeResponse(header, GetDeviceInfo{EntityCount: 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, GetDeviceInfo{EntityCount: 3}, decoded)
+}
@@ -0,0 +1,209 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// FeatureID identifies a HID++ 2.0 feature. Devices expose their features at indices that may differ
+// between models and firmware versions, which IRoot (RootFeature) translates.
+type FeatureID uint16
+
+// Known feature IDs
+const (
+	RootFeature              FeatureID = 0x0000
+	FeatureSetFeature        FeatureID = 0x0001
+	DeviceInformationFeature FeatureID = 0x0003
+	DeviceNameFeature        FeatureID = 0x0005
+	BackLightFeature         FeatureID = 0x1982
+	IlluminationFeature      FeatureID = 0x1990
+	RGBEffectsFeature        FeatureID = 0x8071
+)
+
+// featureNames names the known feature IDs
+var featureNames = map[FeatureID]string{
+	RootFeature:              "Root",
+	FeatureSetFeature:        "FeatureSet",
+	DeviceInformationFeature: "DeviceInformation",
+	DeviceNameFeature:        "DeviceName",
+	BackLightFeature:         "BackLight",
+	IlluminationFeature:      "Illumination",
+	RGBEffectsFeature:        "RGBEffects",
+}
+
+// String returns the name and ID of the feature, or just its ID if it is unknown
+func (f FeatureID) String() string {
+	if name, ok := featureNames[f]; ok {
+		return fmt.Sprintf("%s (0x%04x)", name, uint16(f))
+	}
+	return fmt.Sprintf("0x%04x", uint16(f))
+}
+
+// LookupFeature returns the known feature with the given name, ignoring case
+func LookupFeature(name string) (FeatureID, bool) {
+	for id, featureName := range featureNames {
+		if strings.EqualFold(featureName, name) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// RootFeatureIndex is the index of IRoot, which is the same on every HID++ 2.0 device
+const RootFeatureIndex = 0x00
+
+// Function codes of IRoot (RootFeature) and IFeatureSet (FeatureSetFeature)
+const (
+	GetFeatureFunction      Function = 0x01
+	GetFeatureCountFunction Function = 0x01
+	GetFeatureIDFunction    Function = 0x11
+)
+
+// Response is implemented by commands whose responses lay out their parameters differently from
+// their requests
+type Response interface {
+	ResponseParams() []byte
+}
+
+// requestDecoders decode the requests of commands implementing Response, whose registry entries
+// decode responses
+var requestDecoders = map[FeatureID]map[Function]func(params []byte) Command{
+	RootFeature: {
+		GetFeatureFunction: func(p []byte) Command { return GetFeature{ID: decodeFeatureID(p)} },
+	},
+	FeatureSetFeature: {
+		GetFeatureCountFunction: func(p []byte) Command { return GetFeatureCount{} },
+		GetFeatureIDFunction:    func(p []byte) Command { return GetFeatureID{Index: p[0]} },
+	},
+	DeviceInformationFeature: {
+		GetFirmwareInfoFunction: func(p []byte) Command { return GetFirmwareInfo{Entity: p[0]} },
+	},
+}
+
+// DecodeRequest is like DecodeFeature for reports sent to a device rather than received from it,
+// for simulators and sniffers
+func DecodeRequest(feature FeatureID, report []byte) (Header, Command, error) {
+	header, function, err := DecodeHeader(report)
+	if err != nil {
+		return header, nil, err
+	}
+	if decode, ok := requestDecoders[feature][function]; ok {
+		return header, decode(report[headerLength:]), nil
+	}
+	return DecodeFeature(feature, report)
+}
+
+// EncodeResponse returns the report a device sends in answer to cmd, for simulators and tests
+func EncodeResponse(header Header, cmd Command) []byte {
+	report := EncodeWith(header, cmd)
+	if response, ok := cmd.(Response); ok {
+		clear(report[headerLength:])
+		copy(report[headerLength:], response.ResponseParams())
+	}
+	return report
+}
+
+// GetFeature asks IRoot for the index of the feature ID. Index, Type and Version are only set in
+// responses, with an Index of 0 meaning the device does not support the feature.
+type GetFeature struct {
+	ID      FeatureID
+	Index   byte
+	Type    byte
+	Version byte
+}
+
+func (c GetFeature) Feature() FeatureID     { return RootFeature }
+func (c GetFeature) Function() Function     { return GetFeatureFunction }
+func (c GetFeature) Params() []byte         { return uint16Params(uint16(c.ID)) }
+func (c GetFeature) ResponseParams() []byte { return []byte{c.Index, c.Type, c.Version} }
+func (c GetFeature) String() string {
+	return fmt.Sprintf("GetFeature(id=0x%04x, index=%d, version=%d)", uint16(c.ID), c.Index, c.Version)
+}
+
+// GetFeatureCount asks IFeatureSet how many features the device has, not counting IRoot. Count is
+// only set in responses.
+type GetFeatureCount struct{ Count byte }
+
+func (c GetFeatureCount) Feature() FeatureID     { return FeatureSetFeature }
+func (c GetFeatureCount) Function() Function     { return GetFeatureCountFunction }
+func (c GetFeatureCount) Params() []byte         { return nil }
+func (c GetFeatureCount) ResponseParams() []byte { return []byte{c.Count} }
+func (c GetFeatureCount) String() string         { return fmt.Sprintf("GetFeatureCount(count=%d)", c.Count) }
+
+// GetFeatureID asks IFeatureSet for the feature at Index. ID, Type and Version are only set in
+// responses.
+type GetFeatureID struct {
+	Index   byte
+	ID      FeatureID
+	Type    byte
+	Version byte
+}
+
+func (c GetFeatureID) Feature() FeatureID { return FeatureSetFeature }
+func (c GetFeatureID) Function() Function { return GetFeatureIDFunction }
+func (c GetFeatureID) Params() []byte     { return []byte{c.Index} }
+func (c GetFeatureID) ResponseParams() []byte {
+	return append(uint16Params(uint16(c.ID)), c.Type, c.Version)
+}
+func (c GetFeatureID) String() string {
+	return fmt.Sprintf("GetFeatureID(index=%d, id=0x%04x, version=%d)", c.Index, uint16(c.ID), c.Version)
+}
+
+// errorFeatureIndex marks a HID++ 2.0 error report
+const errorFeatureIndex = 0xff
+
+// errorNames names the HID++ 2.0 error codes
+var errorNames = map[byte]string{
+	0x01: "unknown",
+	0x02: "invalid argument",
+	0x03: "out of range",
+	0x04: "hardware error",
+	0x05: "internal error",
+	0x06: "invalid feature index",
+	0x07: "invalid function",
+	0x08: "busy",
+	0x09: "unsupported",
+}
+
+// DeviceError is the error a device reports instead of answering a request
+type DeviceError struct {
+	FeatureIndex byte
+	Function     Function
+	Code         byte
+}
+
+func (e DeviceError) Error() string {
+	name, ok := errorNames[e.Code]
+	if !ok {
+		name = "unknown error"
+	}
+	return fmt.Sprintf("device error 0x%02x (%s) for function 0x%02x of feature index %d",
+		e.Code, name, byte(e.Function), e.FeatureIndex)
+}
+
+// DecodeError returns the error carried by an error report, and false if report is not one
+func DecodeError(report []byte) (DeviceError, bool) {
+	if len(report) != ReportLength || report[0] != ReportID || report[2] != errorFeatureIndex {
+		return DeviceError{}, false
+	}
+	return DeviceError{FeatureIndex: report[3], Function: Function(report[4]), Code: report[5]}, true
+}
+
+// EncodeError returns the error report answering a request to header and function, for simulators
+// and tests
+func EncodeError(header Header, function Function, code byte) []byte {
+	report := make([]byte, ReportLength)
+	report[0] = ReportID
+	report[1] = header.DeviceIndex
+	report[2] = errorFeatureIndex
+	report[3] = header.FeatureIndex
+	report[4] = byte(function)
+	report[5] = code
+	return report
+}
+
+// decodeFeatureID reads a big endian feature ID
+func decodeFeatureID(p []byte) FeatureID {
+	return FeatureID(binary.BigEndian.Uint16(p))
+}
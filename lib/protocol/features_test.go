@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test discovery requests and responses use their own parameter layouts
+func TestFeatureDiscoveryCommands(t *testing.T) {
+	root := Header{DeviceIndex: 0xff, FeatureIndex: RootFeatureIndex}
+	assert.Equal(t, []byte{0x11, 0xff, 0x00, 0x01, 0x19, 0x90, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		EncodeWith(root, GetFeature{ID: IlluminationFeature}))
+
+	header, decoded, err := DecodeRequest(RootFeature, EncodeWith(root, GetFeature{ID: IlluminationFeature}))
+	assert.NoError(t, err)
+	assert.Equal(t, root, header)
+	assert.Equal(t, GetFeature{ID: IlluminationFeature}, decoded)
+
+	response := EncodeResponse(root, GetFeature{ID: IlluminationFeature, Index: 4, Version: 1})
+	assert.Equal(t, []byte{0x04, 0x00, 0x01, 0x00}, response[4:8])
+	header, decoded, err = Decode(response)
+	assert.NoError(t, err)
+	assert.Equal(t, root, header)
+	assert.Equal(t, GetFeature{Index: 4, Version: 1}, decoded)
+
+	featureSet := Header{DeviceIndex: 0xff, FeatureIndex: 0x01}
+	_, decoded, err = DecodeFeature(FeatureSetFeature, EncodeResponse(featureSet, GetFeatureCount{Count: 4}))
+	assert.NoError(t, err)
+	assert.Equal(t, GetFeatureCount{Count: 4}, decoded)
+
+	_, decoded, err = DecodeRequest(FeatureSetFeature, EncodeWith(featureSet, GetFeatureID{Index: 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, GetFeatureID{Index: 3}, decoded)
+	_, decoded, err = DecodeFeature(FeatureSetFeature, EncodeResponse(featureSet, GetFeatureID{Index: 3, ID: IlluminationFeature}))
+	assert.NoError(t, err)
+	assert.Equal(t, GetFeatureID{ID: IlluminationFeature}, decoded)
+}
+
+// Test features are named and error reports are recognised
+func TestFeatureNamesAndErrors(t *testing.T) {
+	assert.Equal(t, "Illumination (0x1990)", IlluminationFeature.String())
+	assert.Equal(t, "RGBEffects (0x8071)", RGBEffectsFeature.String())
+	assert.Equal(t, "0x8070", FeatureID(0x8070).String())
+
+	feature, ok := LookupFeature("illumination")
+	assert.True(t, ok)
+	assert.Equal(t, IlluminationFeature, feature)
+	_, ok = LookupFeature("Lamp")
+	assert.False(t, ok)
+
+	report := EncodeError(DefaultHeader, SetBrightnessFunction, 0x02)
+	deviceErr, ok := DecodeError(report)
+	assert.True(t, ok)
+	assert.Equal(t, DeviceError{FeatureIndex: 0x04, Function: SetBrightnessFunction, Code: 0x02}, deviceErr)
+	assert.Equal(t, "device error 0x02 (invalid argument) for function 0x4c of feature index 4", deviceErr.Error())
+
+	_, ok = DecodeError(Encode(SetPower{On: true}))
+	assert.False(t, ok)
+}
@@ -0,0 +1,89 @@
+// Package protocol encodes and decodes the HID++ reports used to control Logitech Litra lights.
+// Every report is a 20 byte HID++ long report: report ID, device index, feature index, function
+// code and 16 bytes of parameters. Responses echo the header of the request they answer. The
+// feature index addressing a HID++ 2.0 feature is looked up with the IRoot GetFeature command.
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReportID identifies a HID++ long report
+const ReportID = 0x11
+
+// ReportLength is the length of a HID++ long report, including the report ID
+const ReportLength = 20
+
+// headerLength is the number of bytes before the parameters
+const headerLength = 4
+
+var (
+	// ErrReportLength is returned when decoding a report that is not ReportLength bytes long
+	ErrReportLength = errors.New("invalid report length")
+	// ErrReportID is returned when decoding a report that is not a HID++ long report
+	ErrReportID = errors.New("invalid report ID")
+	// ErrUnknownFunction is returned when decoding a report for a function missing from the registry
+	ErrUnknownFunction = errors.New("unknown function")
+)
+
+// Header addresses a report to a feature of a device
+type Header struct {
+	DeviceIndex  byte
+	FeatureIndex byte
+}
+
+// DefaultHeader addresses the illumination feature of a directly connected Litra light
+var DefaultHeader = Header{DeviceIndex: 0xff, FeatureIndex: 0x04}
+
+// Encode returns the report sending cmd with DefaultHeader
+func Encode(cmd Command) []byte {
+	return EncodeWith(DefaultHeader, cmd)
+}
+
+// EncodeWith returns the report sending cmd with the given header
+func EncodeWith(header Header, cmd Command) []byte {
+	report := make([]byte, ReportLength)
+	report[0] = ReportID
+	report[1] = header.DeviceIndex
+	report[2] = header.FeatureIndex
+	report[3] = byte(cmd.Function())
+	copy(report[headerLength:], cmd.Params())
+	return report
+}
+
+// DecodeHeader validates the length and report ID of a report and returns its header and function code
+func DecodeHeader(report []byte) (Header, Function, error) {
+	if len(report) != ReportLength {
+		return Header{}, 0, fmt.Errorf("%w: %d bytes, expected %d", ErrReportLength, len(report), ReportLength)
+	}
+	if report[0] != ReportID {
+		return Header{}, 0, fmt.Errorf("%w: 0x%02x, expected 0x%02x", ErrReportID, report[0], ReportID)
+	}
+	return Header{DeviceIndex: report[1], FeatureIndex: report[2]}, Function(report[3]), nil
+}
+
+// Decode validates a report and decodes it into the typed command registered for its function code.
+// Reports addressed to RootFeatureIndex are decoded as IRoot commands and all others as illumination
+// commands; use DecodeFeature when the feature at the index is known.
+// Responses decode to the same type as the request they answer, with the reported value filled in.
+func Decode(report []byte) (Header, Command, error) {
+	if len(report) > 2 && report[2] == RootFeatureIndex {
+		return DecodeFeature(RootFeature, report)
+	}
+	return DecodeFeature(IlluminationFeature, report)
+}
+
+// DecodeFeature validates a report addressed to feature and decodes it into the typed command
+// registered for its function code
+func DecodeFeature(feature FeatureID, report []byte) (Header, Command, error) {
+	header, function, err := DecodeHeader(report)
+	if err != nil {
+		return header, nil, err
+	}
+	info, ok := Lookup(feature, function)
+	if !ok {
+		return header, nil, fmt.Errorf("%w: 0x%02x of feature %s", ErrUnknownFunction, byte(function), feature)
+	}
+	return header, info.decode(report[headerLength:]), nil
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test commands encode to the reports the lights expect
+func TestEncode(t *testing.T) {
+	assert.Equal(t, []byte{0x11, 0xff, 0x04, 0x1c, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, Encode(SetPower{On: true}))
+	assert.Equal(t, []byte{0x11, 0xff, 0x04, 0x4c, 0x00, 0x87, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, Encode(SetBrightness{Raw: 0x87}))
+	assert.Equal(t, []byte{0x11, 0xff, 0x04, 0x9c, 0x0f, 0xa0, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, Encode(SetTemperature{Kelvin: 4000}))
+	assert.Equal(t, []byte{0x11, 0x01, 0x07, 0x31, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		EncodeWith(Header{DeviceIndex: 0x01, FeatureIndex: 0x07}, GetBrightness{}))
+}
+
+// Test every registered command decodes back to itself
+func TestDecodeRoundTrip(t *testing.T) {
+	commands := []Command{
+		GetPower{On: true}, SetPower{On: false},
+		GetBrightness{Raw: 0xfa}, SetBrightness{Raw: 0x14},
+		GetTemperature{Kelvin: 6500}, SetTemperature{Kelvin: 2700},
+		GetBrightnessInfo{Capabilities: 1, Min: 20, Max: 250}, GetTemperatureInfo{Min: 2700, Max: 6500},
+	}
+	assert.Len(t, commands, len(registry[IlluminationFeature]))
+
+	for _, cmd := range commands {
+		header, decoded, err := Decode(Encode(cmd))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultHeader, header)
+		assert.Equal(t, cmd, decoded)
+	}
+}
+
+// Test malformed and unknown reports are rejected
+func TestDecodeErrors(t *testing.T) {
+	_, _, err := Decode([]byte{0x11, 0xff, 0x04, 0x1c})
+	assert.ErrorIs(t, err, ErrReportLength)
+
+	report := Encode(SetPower{On: true})
+	report[0] = 0x10
+	_, _, err = Decode(report)
+	assert.ErrorIs(t, err, ErrReportID)
+
+	report = Encode(SetPower{On: true})
+	report[3] = 0x2c
+	header, function, err := DecodeHeader(report)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultHeader, header)
+	assert.Equal(t, Function(0x2c), function)
+	_, _, err = Decode(report)
+	assert.ErrorIs(t, err, ErrUnknownFunction)
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+// queryTimeout is how long to wait for the device to answer a single query
+var queryTimeout = 500 * time.Millisecond
+
+// DeviceState is the state of a light as reported by the device itself
+type DeviceState struct {
+	Power       int // 1 when on, 0 when off
+	Brightness  int // brightness between 0 and 100
+	Temperature int // temperature in Kelvin
+	Lumens      int // light output in lumens, only set by QueryState
+}
+
+// QueryState reads the power, brightness and temperature directly from a light.
+// deviceIndex 1+ queries a specific device; deviceIndex 0 queries the first device,
+// which is representative when all lights are controlled together.
+func (c *Controller) QueryState(deviceIndex int) (DeviceState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return DeviceState{}, err
+	}
+	return c.queryDevice(devices[0])
+}
+
+// queryDevice reads the complete state of a single device. Must be called with c.mu held.
+func (c *Controller) queryDevice(d *discoveredDeviceInternal) (DeviceState, error) {
+	var state DeviceState
+
+	response, err := c.queryValue(d, protocol.GetPower{})
+	if err != nil {
+		return state, err
+	}
+	if response.(protocol.GetPower).On {
+		state.Power = 1
+	}
+
+	response, err = c.queryValue(d, protocol.GetBrightness{})
+	if err != nil {
+		return state, err
+	}
+	raw := response.(protocol.GetBrightness).Raw
+	t := d.target()
+	state.Brightness = t.product.brightnessLevel(raw, t.brightnessCurve())
+	state.Lumens = t.calibration.lumens(t.product, raw)
+
+	response, err = c.queryValue(d, protocol.GetTemperature{})
+	if err != nil {
+		return state, err
+	}
+	state.Temperature = t.calibration.requestedTemperature(t.product, int(response.(protocol.GetTemperature).Kelvin))
+
+	return state, nil
+}
+
+// queryValue sends a get command and waits for the matching response, which decodes to the same
+// command type with the value filled in. Queries are not sent in a dry run, which returns ErrQueryFailed
+// wrapping ErrDryRun. Must be called with c.mu held.
+func (c *Controller) queryValue(d *discoveredDeviceInternal, query protocol.Command) (protocol.Command, error) {
+	if dryRun() != DryRunOff {
+		return nil, fmt.Errorf("%w: device %d (Litra %s, serial: %s): %w", ErrQueryFailed,
+			d.metadata.Index, d.metadata.Name, d.metadata.Serial, ErrDryRun)
+	}
+	if _, err := c.send(d, query); err != nil {
+		return nil, err
+	}
+	header, err := featureHeader(d, query.Feature())
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(d, header, query)
+}
+
+// readResponse waits for the response to a query sent to header. Reports that do not answer the
+// query (e.g. notifications caused by the physical buttons) are skipped, and an error reported by
+// the device for the query is returned wrapped in ErrQueryFailed.
+func readResponse(d *discoveredDeviceInternal, header protocol.Header, query protocol.Command) (protocol.Command, error) {
+	deadline := time.Now().Add(queryTimeout)
+	response := make([]byte, protocol.ReportLength)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("%w: device %d (Litra %s, serial: %s): no response to %s",
+				ErrQueryFailed, d.metadata.Index, d.metadata.Name, d.metadata.Serial,
+				protocol.FunctionName(query.Feature(), query.Function()))
+		}
+		n, err := d.device.ReadWithTimeout(response, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("%w: device %d (Litra %s, serial: %s): %v",
+				ErrQueryFailed, d.metadata.Index, d.metadata.Name, d.metadata.Serial, err)
+		}
+		if deviceErr, ok := protocol.DecodeError(response[:n]); ok {
+			if deviceErr.FeatureIndex == header.FeatureIndex && deviceErr.Function == query.Function() {
+				return nil, fmt.Errorf("%w: device %d (Litra %s, serial: %s): %w",
+					ErrQueryFailed, d.metadata.Index, d.metadata.Name, d.metadata.Serial, deviceErr)
+			}
+			continue
+		}
+		responseHeader, function, err := protocol.DecodeHeader(response[:n])
+		if err != nil || responseHeader != header || function != query.Function() {
+			continue
+		}
+		_, decoded, err := protocol.DecodeFeature(query.Feature(), response[:n])
+		if err != nil {
+			continue
+		}
+		return decoded, nil
+	}
+}
+
+// Function variable for testing
+var queryStateFunc = (*Controller).QueryState
+
+// ReadCurrentState returns the brightness, temperature and power of a light. The state is read
+// from the device when possible; if querying fails the last state saved in the config file is used.
+// deviceIndex 0 means all devices, 1+ targets a specific device.
+func (c *Controller) ReadCurrentState(deviceIndex int) (brightness int, temperature int, power int) {
+	state, err := queryStateFunc(c, deviceIndex)
+	if err != nil {
+		log.Debug().Msgf("Unable to query device state, using config file: %v", err)
+		return defaultConfigUpdater.ReadCurrentState(c.stateKey(deviceIndex))
+	}
+	return state.Brightness, state.Temperature, state.Power
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// expectResponse sets up a single read on the mock device returning the given report
+func expectResponse(device *MockHIDDevice, response []byte) {
+	device.On("ReadWithTimeout", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			copy(args.Get(0).([]byte), response)
+		}).
+		Return(len(response), nil).Once()
+}
+
+// Test QueryState parses the power, brightness and temperature responses
+func TestQueryState(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	for _, query := range []protocol.Command{protocol.GetPower{}, protocol.GetBrightness{}, protocol.GetTemperature{}} {
+		mockDevice1.On("Write", protocol.Encode(query)).Return(20, nil).Once()
+	}
+	// A button notification and a malformed report arrive before the power response and must be skipped
+	expectResponse(mockDevice1, []byte{0x11, 0xff, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	expectResponse(mockDevice1, []byte{0x11, 0xff, 0x04, 0x01, 0x01, 0x00})
+	expectResponse(mockDevice1, protocol.Encode(protocol.GetPower{On: true}))
+	expectResponse(mockDevice1, protocol.Encode(protocol.GetBrightness{Raw: 215})) // half way between 30 and 400
+	expectResponse(mockDevice1, protocol.Encode(protocol.GetTemperature{Kelvin: 4000}))
+
+	state, err := QueryState(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceState{Power: 1, Brightness: 50, Temperature: 4000, Lumens: 215}, state)
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+}
+
+// Test QueryState reports ErrQueryFailed when the device does not answer
+func TestQueryStateTimeout(t *testing.T) {
+	mockDevice1, _, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	mockDevice1.On("Write", protocol.Encode(protocol.GetPower{})).Return(20, nil).Once()
+	mockDevice1.On("ReadWithTimeout", mock.Anything, mock.Anything).Return(0, errReadTimeout).Once()
+
+	_, err := QueryState(0)
+
+	assert.ErrorIs(t, err, ErrQueryFailed)
+	mockDevice1.AssertExpectations(t)
+}
+
+// Test relative commands use the live device state instead of the config file
+func TestLightBrightUpLiveState(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 1, Brightness: 30, Temperature: 4000}, nil
+	}
+
+	newBrightness := 40
+	beamBytes := brightnessReport(BeamProductID, newBrightness)
+	glowBytes := brightnessReport(GlowProductID, newBrightness)
+
+	mockDevice1.On("Write", beamBytes).Return(len(beamBytes), nil).Once()
+	mockDevice2.On("Write", glowBytes).Return(len(glowBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "", newBrightness, -1, -1).Once()
+
+	assert.NoError(t, LightBrightUp(0, 10))
+
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+	mockConfigUpdater.AssertNotCalled(t, "ReadCurrentState", mock.Anything)
+}
+
+// Test ReadCurrentState falls back to the config file when the device cannot be queried
+func TestReadCurrentStateFallback(t *testing.T) {
+	_, _, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	mockConfigUpdater.On("ReadCurrentState", "test-serial-Glow").Return(70, 3500, 1).Once()
+
+	brightness, temperature, power := ReadCurrentState(2)
+
+	assert.Equal(t, 70, brightness)
+	assert.Equal(t, 3500, temperature)
+	assert.Equal(t, 1, power)
+	mockConfigUpdater.AssertExpectations(t)
+}
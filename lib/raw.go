@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+)
+
+// RawReport is a report written to or read from a light by SendRaw, with its meaning when known
+type RawReport struct {
+	Data    []byte
+	Decoded string // empty when the report could not be decoded
+}
+
+// rawTimeout is how long SendRaw waits for the light to answer
+var rawTimeout = queryTimeout
+
+// SendRaw writes a report to a light using the default controller. See Controller.SendRaw.
+func SendRaw(deviceIndex int, report []byte) (RawReport, []RawReport, error) {
+	return getDefaultController().SendRaw(deviceIndex, report)
+}
+
+// SendFunction sends a function of a feature to a light using the default controller. See Controller.SendFunction.
+func SendFunction(deviceIndex int, feature protocol.FeatureID, function protocol.Function, params []byte) (RawReport, []RawReport, error) {
+	return getDefaultController().SendFunction(deviceIndex, feature, function, params)
+}
+
+// SendRaw writes a report to a light, padded with zeros to protocol.ReportLength, for experimenting
+// with functions the package does not know. It returns the report as written and the reports read
+// from the light until one answers it (echoing its header or reporting an error for it) or
+// rawTimeout passes. Reports are decoded using the feature indices looked up on the light so far.
+// A dry run prints the report instead and returns no responses.
+// deviceIndex 1+ selects a specific device; deviceIndex 0 selects the first device.
+func (c *Controller) SendRaw(deviceIndex int, report []byte) (RawReport, []RawReport, error) {
+	if len(report) == 0 || len(report) > protocol.ReportLength {
+		return RawReport{}, nil, fmt.Errorf("%w: report of %d bytes, expected 1 to %d", ErrOutOfRange, len(report), protocol.ReportLength)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return RawReport{}, nil, err
+	}
+	return c.sendRaw(devices[0], report)
+}
+
+// SendFunction sends params to a function of a feature of a light, looking up the index of the feature
+// on the light first, and returns like SendRaw. Returns ErrFeatureNotSupported when the light does not
+// have the feature.
+func (c *Controller) SendFunction(deviceIndex int, feature protocol.FeatureID, function protocol.Function, params []byte) (RawReport, []RawReport, error) {
+	if len(params) > protocol.ReportLength-4 {
+		return RawReport{}, nil, fmt.Errorf("%w: %d bytes of parameters, expected at most %d", ErrOutOfRange, len(params), protocol.ReportLength-4)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices, err := c.targets(deviceIndex)
+	if err != nil {
+		return RawReport{}, nil, err
+	}
+	d := devices[0]
+	if d.device == nil {
+		if err := c.reopen(d); err != nil {
+			return RawReport{}, nil, err
+		}
+	}
+	header, err := featureHeader(d, feature)
+	if err != nil {
+		return RawReport{}, nil, err
+	}
+	report := append([]byte{protocol.ReportID, header.DeviceIndex, header.FeatureIndex, byte(function)}, params...)
+	return c.sendRaw(d, report)
+}
+
+// sendRaw writes a report of at most protocol.ReportLength bytes to a device and reads the answer.
+// Must be called with c.mu held.
+func (c *Controller) sendRaw(d *discoveredDeviceInternal, report []byte) (RawReport, []RawReport, error) {
+	data := make([]byte, protocol.ReportLength)
+	copy(data, report)
+	sent := RawReport{Data: data, Decoded: describeReport(d, data, true)}
+	if _, err := c.write(d, data); err != nil {
+		return sent, nil, err
+	}
+	if dryRun() != DryRunOff {
+		return sent, nil, nil
+	}
+
+	var responses []RawReport
+	deadline := time.Now().Add(rawTimeout)
+	for remaining := rawTimeout; remaining > 0; remaining = time.Until(deadline) {
+		buffer := make([]byte, protocol.ReportLength)
+		n, err := d.device.ReadWithTimeout(buffer, remaining)
+		if errors.Is(err, errReadTimeout) {
+			break
+		}
+		if err != nil {
+			return sent, responses, fmt.Errorf("%w: device %d (Litra %s, serial: %s): %v",
+				ErrQueryFailed, d.metadata.Index, d.metadata.Name, d.metadata.Serial, err)
+		}
+		response := RawReport{Data: buffer[:n], Decoded: describeReport(d, buffer[:n], false)}
+		responses = append(responses, response)
+		if answers(response.Data, data) {
+			break
+		}
+	}
+	return sent, responses, nil
+}
+
+// answers returns true if response is the answer of a device to request, echoing its header or
+// reporting an error for it
+func answers(response []byte, request []byte) bool {
+	if deviceErr, ok := protocol.DecodeError(response); ok {
+		return deviceErr.FeatureIndex == request[2] && deviceErr.Function == protocol.Function(request[3])
+	}
+	return len(response) >= 4 && response[0] == request[0] && response[1] == request[1] &&
+		response[2] == request[2] && response[3] == request[3]
+}
+
+// describeReport decodes a report written to (request) or read from a device, using the feature
+// indices looked up on the device. Returns an empty string if the report cannot be decoded.
+func describeReport(d *discoveredDeviceInternal, report []byte, request bool) string {
+	if deviceErr, ok := protocol.DecodeError(report); ok {
+		return deviceErr.Error()
+	}
+	if len(report) < 3 {
+		return ""
+	}
+	feature, ok := protocol.RootFeature, report[2] == protocol.RootFeatureIndex
+	for id, index := range d.features {
+		if !ok && index == report[2] {
+			feature, ok = id, true
+		}
+	}
+	if !ok {
+		return ""
+	}
+	decode := protocol.DecodeFeature
+	if request {
+		decode = protocol.DecodeRequest
+	}
+	_, cmd, err := decode(feature, report)
+	if err != nil {
+		return ""
+	}
+	return cmd.String()
+}
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test raw reports are padded, written and answered, with the answers decoded
+func TestSendRaw(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1")
+	defer cleanup()
+
+	sent, responses, err := SendRaw(1, []byte{0x11, 0xff, 0x04, 0x1c, 0x01})
+	assert.NoError(t, err)
+	assert.Equal(t, RawReport{Data: protocol.Encode(protocol.SetPower{On: true}), Decoded: "SetPower(on=true)"}, sent)
+	assert.Empty(t, responses)
+
+	_, responses, err = SendRaw(0, []byte{0x11, 0xff, 0x04, 0x01})
+	assert.NoError(t, err)
+	assert.Equal(t, []RawReport{{
+		Data:    protocol.EncodeResponse(protocol.DefaultHeader, protocol.GetPower{On: true}),
+		Decoded: "GetPower(on=true)",
+	}}, responses)
+
+	// Errors reported by the light answer the report too
+	sent, responses, err = SendRaw(1, []byte{0x11, 0xff, 0x09, 0x1c})
+	assert.NoError(t, err)
+	assert.Equal(t, "", sent.Decoded)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "device error 0x06 (invalid feature index) for function 0x1c of feature index 9", responses[0].Decoded)
+
+	_, _, err = SendRaw(1, make([]byte, 21))
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	_, _, err = SendRaw(2, []byte{0x11})
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
+
+// Test functions of a feature are sent to the index of the feature on the light
+func TestSendFunction(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "beam lx:SIM3")
+	defer cleanup()
+
+	sent, responses, err := SendFunction(1, protocol.DeviceInformationFeature, protocol.GetFirmwareInfoFunction, []byte{0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(2), sent.Data[2])
+	assert.Equal(t, "GetFirmwareInfo(entity=0, type=0, version=00.00)", sent.Decoded)
+	assert.Len(t, responses, 1)
+	assert.Contains(t, responses[0].Decoded, "GetFirmwareInfo(")
+
+	_, _, err = SendFunction(1, protocol.FeatureID(0x8070), 0x01, nil)
+	assert.ErrorIs(t, err, ErrFeatureNotSupported)
+	_, _, err = SendFunction(1, protocol.IlluminationFeature, protocol.SetPowerFunction, make([]byte, 17))
+	assert.ErrorIs(t, err, ErrOutOfRange)
+}
@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy controls how writes to a light are retried. USB hubs and suspend/resume can leave a
+// stale handle behind, so before each retry the light is looked up again by serial number and
+// reopened.
+type RetryPolicy struct {
+	Timeout    time.Duration // time allowed for each write, 0 waits for as long as the write takes
+	Retries    int           // retries after the first attempt fails
+	Backoff    time.Duration // wait before the first retry, doubled for each further retry
+	MaxBackoff time.Duration // longest wait between retries, 0 for no limit
+}
+
+// DefaultRetryPolicy is used by controllers that have not been given a policy with SetRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	Timeout:    time.Second,
+	Retries:    1,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// backoff returns the wait before the given retry, counting from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 {
+		wait = min(wait, p.MaxBackoff)
+	}
+	return wait
+}
+
+// DeviceStats counts the writes to a light since it was first seen by a controller, so flaky lights
+// can be spotted. The counts are kept when the light is unplugged and reconnected.
+type DeviceStats struct {
+	Serial     string
+	Port       string // USB port, set when the serial number does not identify the light on its own
+	Name       string
+	Writes     uint64 // reports written successfully
+	Errors     uint64 // write attempts that failed, including timeouts
+	Timeouts   uint64 // write attempts that timed out
+	Retries    uint64 // retries of failed writes, including those where the light could not be reopened
+	Reconnects uint64 // times the light was looked up and reopened after a failed write
+	Failed     uint64 // writes that still failed after every retry
+	LastError  error  // the most recent failed attempt, nil if none
+}
+
+// sleep waits between retries. Function variable for testing.
+var sleep = time.Sleep
+
+// SetRetryPolicy sets how the controller retries failed writes
+func (c *Controller) SetRetryPolicy(policy RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = &policy
+}
+
+// retryPolicy returns the policy set with SetRetryPolicy, or DefaultRetryPolicy. Must be called with c.mu held.
+func (c *Controller) retryPolicy() RetryPolicy {
+	if c.policy != nil {
+		return *c.policy
+	}
+	return DefaultRetryPolicy
+}
+
+// Stats returns the write counters of every light the controller has seen, sorted by serial number and port
+func (c *Controller) Stats() []DeviceStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]DeviceStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b DeviceStats) int {
+		switch {
+		case a.Serial < b.Serial:
+			return -1
+		case a.Serial > b.Serial:
+			return 1
+		}
+		return strings.Compare(a.Port, b.Port)
+	})
+	return stats
+}
+
+// deviceStats returns the counters of a device, creating them the first time it is seen.
+// Must be called with c.mu held, before writing to devices concurrently.
+func (c *Controller) deviceStats(id string, metadata DiscoveredDevice) *DeviceStats {
+	if c.stats == nil {
+		c.stats = make(map[string]*DeviceStats)
+	}
+	s, ok := c.stats[id]
+	if !ok {
+		s = &DeviceStats{Serial: metadata.Serial, Name: metadata.Name}
+		if id != metadata.Serial {
+			s.Port = metadata.Port
+		}
+		c.stats[id] = s
+	}
+	return s
+}
+
+// write sends bytes to a device and returns the number of bytes written. Devices that are not open
+// are opened first. Failed writes are retried following the retry policy, looking the device up again
+// and reopening it before each retry, which recovers handles that went stale (e.g. after the light was
+// unplugged and reconnected, or the computer resumed from suspend). Short writes are not retried.
+// In a dry run the bytes are printed instead. Must be called with c.mu held, and only for one device at a time.
+func (c *Controller) write(d *discoveredDeviceInternal, bytes []byte) (int, error) {
+	if d.device == nil {
+		if err := c.reopen(d); err != nil {
+			return 0, err
+		}
+	}
+	if dryRun() != DryRunOff {
+		return dryRunWrite(d, bytes), nil
+	}
+
+	policy := c.retryPolicy()
+	n, err := writeWithTimeout(d, bytes, policy.Timeout)
+	d.stats.count(err)
+	for retry := 1; retry <= policy.Retries && errors.Is(err, ErrWriteFailed); retry++ {
+		log.Debug().Msgf("Write to %s (serial: %s) failed, reconnecting (retry %d of %d): %v",
+			d.metadata.Name, d.metadata.Serial, retry, policy.Retries, err)
+		sleep(policy.backoff(retry))
+		d.stats.Retries++
+		if reconnectErr := c.reconnect(d); reconnectErr != nil {
+			log.Debug().Msgf("Failed to reconnect %s (serial: %s): %v", d.metadata.Name, d.metadata.Serial, reconnectErr)
+			continue
+		}
+		d.stats.Reconnects++
+		n, err = writeWithTimeout(d, bytes, policy.Timeout)
+		d.stats.count(err)
+	}
+	if errors.Is(err, ErrWriteFailed) {
+		d.stats.Failed++
+	}
+	return n, err
+}
+
+// count records the outcome of a write attempt
+func (s *DeviceStats) count(err error) {
+	if err == nil {
+		s.Writes++
+		return
+	}
+	s.Errors++
+	s.LastError = err
+	if errors.Is(err, errWriteTimeout) {
+		s.Timeouts++
+	}
+}
+
+// errWriteTimeout is wrapped by write errors caused by a write that did not complete in time
+var errWriteTimeout = errors.New("write timed out")
+
+// writeWithTimeout writes bytes to a device, giving up after timeout (0 for no timeout). A handle whose
+// write timed out is dropped straight away, but only closed by the goroutine of the write once the write
+// returns, since closing it during a write frees memory the write still uses with hidapi. A write that
+// never returns therefore keeps its goroutine and handle until the program exits.
+func writeWithTimeout(d *discoveredDeviceInternal, bytes []byte, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		return writeDevice(d, bytes)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	device := d.device
+	done := make(chan result)
+	abandoned := make(chan struct{})
+	go func() {
+		n, err := device.Write(bytes)
+		select {
+		case done <- result{n, err}:
+		case <-abandoned:
+			device.Close()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.n, checkWrite(d, len(bytes), r.n, r.err)
+	case <-timer.C:
+		d.device = nil
+		d.features = nil
+		close(abandoned)
+		return 0, checkWrite(d, len(bytes), 0, fmt.Errorf("%w after %v", errWriteTimeout, timeout))
+	}
+}
+
+// reconnect looks a device up again by its identity, which picks up a new HID path if it was
+// reconnected, and reopens it. Must be called with c.mu held, and only for one device at a time.
+// Like reopen, devices are reconnected one at a time.
+func (c *Controller) reconnect(d *discoveredDeviceInternal) error {
+	c.openMu.Lock()
+	defer c.openMu.Unlock()
+
+	metadata, found := findDevice(d)
+	if !found {
+		if d.device != nil {
+			d.device.Close()
+			d.device = nil
+		}
+		return fmt.Errorf("%w: Litra %s (serial: %s) is no longer connected", ErrDeviceNotFound, d.metadata.Name, d.metadata.Serial)
+	}
+	d.metadata = metadata
+	return c.reopenDevice(d)
+}
+
+// findDevice enumerates the model of a device again and returns its current metadata, keeping its
+// index and preferring its HID++ collection when the light is listed once per collection. It returns
+// false when the device is no longer connected.
+func findDevice(d *discoveredDeviceInternal) (DiscoveredDevice, bool) {
+	metadata := d.metadata
+	found := false
+	err := defaultHIDEnumerator.Enumerate(VendorId, metadata.ProductID, func(info *HIDDeviceInfo) error {
+		if d.isLight(info) && (!found || info.UsagePage == hidppUsagePage) {
+			metadata.Path = info.Path
+			metadata.Interface = info.InterfaceNbr
+			metadata.Port = usbPort(info.Path)
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debug().Msgf("Failed to enumerate %s devices: %v", metadata.Name, err)
+	}
+	return metadata, found
+}
+
+// SetRetryPolicy sets how the default controller retries failed writes
+func SetRetryPolicy(policy RetryPolicy) {
+	getDefaultController().SetRetryPolicy(policy)
+}
+
+// Stats returns the write counters of every light seen by the default controller, sorted by serial number
+func Stats() []DeviceStats {
+	return getDefaultController().Stats()
+}
@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test the wait between retries doubles up to the limit
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, policy.backoff(4))
+	assert.Equal(t, time.Second, policy.backoff(5))
+	assert.Equal(t, time.Second, policy.backoff(60))
+
+	policy.MaxBackoff = 0
+	assert.Equal(t, 1600*time.Millisecond, policy.backoff(5))
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.backoff(3))
+}
+
+// Test a failed write is retried with backoff, reconnecting the light before each retry
+func TestControllerRetriesWrites(t *testing.T) {
+	mockDevice1, _, mockEnumerator, mockOpener, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	// The light is missing while the hub resets, then is found again but still fails once
+	mockDevice1.On("Write", onBytes).Return(0, errors.New("stale handle")).Twice()
+	mockEnumerator.On("Enumerate", uint16(VendorId), uint16(BeamProductID), mock.Anything).Return(nil).Once()
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	expectEnumerate(mockEnumerator, BeamProductID, "test-serial-Beam")
+	reopenedDevice := new(MockHIDDevice)
+	mockOpener.On("Open", uint16(VendorId), uint16(BeamProductID), "test-serial-Beam").Return(mockDevice1, nil).Once()
+	mockOpener.On("Open", uint16(VendorId), uint16(BeamProductID), "test-serial-Beam").Return(reopenedDevice, nil).Once()
+	reopenedDevice.On("Write", onBytes).Return(len(onBytes), nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, -1, 1).Once()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+	controller.SetRetryPolicy(RetryPolicy{Retries: 3, Backoff: 10 * time.Millisecond})
+
+	assert.NoError(t, controller.LightOn(1))
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}, waits)
+
+	stats := controller.Stats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "test-serial-Beam", stats[0].Serial)
+	assert.Equal(t, uint64(1), stats[0].Writes)
+	assert.Equal(t, uint64(2), stats[0].Errors)
+	assert.Equal(t, uint64(3), stats[0].Retries)
+	assert.Equal(t, uint64(2), stats[0].Reconnects)
+	assert.Equal(t, uint64(0), stats[0].Failed)
+	assert.ErrorContains(t, stats[0].LastError, "stale handle")
+	assert.Equal(t, DeviceStats{Serial: "test-serial-Glow", Name: "Glow"}, stats[1])
+
+	mockDevice1.AssertExpectations(t)
+	reopenedDevice.AssertExpectations(t)
+	mockEnumerator.AssertExpectations(t)
+	mockOpener.AssertExpectations(t)
+}
+
+// Test a write that hangs times out, and its handle is only closed once the write returns
+func TestControllerWriteTimeout(t *testing.T) {
+	mockDevice1, _, _, _, _, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	release := make(chan struct{})
+	closed := make(chan struct{})
+	mockDevice1.On("Write", onBytes).Return(len(onBytes), nil).Run(func(mock.Arguments) { <-release }).Once()
+	mockDevice1.ExpectedCalls = append([]*mock.Call{mockDevice1.On("Close").Return(nil).Run(func(mock.Arguments) {
+		close(closed)
+	}).Once()}, mockDevice1.ExpectedCalls...)
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+	controller.SetRetryPolicy(RetryPolicy{Timeout: 10 * time.Millisecond})
+
+	err = controller.LightOn(1)
+	assert.ErrorIs(t, err, ErrWriteFailed)
+	assert.ErrorIs(t, err, errWriteTimeout)
+	assert.ErrorContains(t, err, "write timed out after 10ms")
+
+	select {
+	case <-closed:
+		t.Error("the handle was closed while the write was still in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("the handle was not closed once the write returned")
+	}
+
+	stats := controller.Stats()
+	assert.Equal(t, uint64(1), stats[0].Timeouts)
+	assert.Equal(t, uint64(1), stats[0].Failed)
+}
+
+// Test the package-level functions use the policy and counters of the default controller
+func TestDefaultRetryPolicy(t *testing.T) {
+	mockDevice1, _, mockEnumerator, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	onBytes := []byte{0x11, 0xff, 0x04, 0x1c, LightOnCode, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	// With no retries the light is neither looked up again nor reopened
+	mockDevice1.On("Write", onBytes).Return(0, errors.New("device disconnected")).Once()
+	SetRetryPolicy(RetryPolicy{})
+
+	assert.ErrorIs(t, LightOn(1), ErrWriteFailed)
+	assert.Equal(t, uint64(1), Stats()[0].Failed)
+	mockDevice1.AssertExpectations(t)
+	mockEnumerator.AssertExpectations(t)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test lights are written to in parallel but reopened one at a time
+func TestControllerReopensOneAtATime(t *testing.T) {
+	mockDevice1, mockDevice2, _, mockOpener, _, cleanup := setupTest()
+	defer cleanup()
+
+	controller, err := NewController()
+	assert.NoError(t, err)
+	for _, d := range controller.devices {
+		d.device = nil
+	}
+
+	var opening, overlaps atomic.Int32
+	opened := func(mock.Arguments) {
+		if opening.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(20 * time.Millisecond)
+		opening.Add(-1)
+	}
+	mockOpener.On("Open", uint16(VendorId), uint16(BeamProductID), "test-serial-Beam").Return(mockDevice1, nil).Run(opened).Once()
+	mockOpener.On("Open", uint16(VendorId), uint16(GlowProductID), "test-serial-Glow").Return(mockDevice2, nil).Run(opened).Once()
+	mockDevice1.On("Write", commandBytes(powerCommand(LightOnCode), BeamProductID)).Return(20, nil).Once()
+	mockDevice2.On("Write", commandBytes(powerCommand(LightOnCode), GlowProductID)).Return(20, nil).Once()
+
+	assert.NoError(t, controller.command(powerCommand(LightOnCode), 0))
+	assert.Zero(t, overlaps.Load())
+	mockOpener.AssertExpectations(t)
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertExpectations(t)
+}
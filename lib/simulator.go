@@ -0,0 +1,367 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+)
+
+// Environment variables configuring the simulator backend
+const (
+	// SimDevicesEnv lists the simulated lights as comma separated model:serial pairs, e.g. "glow:SIM1,beam:SIM2".
+	// A light can be put on a USB port with model:serial@port, e.g. "glow:@1-2,glow:@1-3" for two lights
+	// without serial numbers.
+	SimDevicesEnv = "LLGD_SIM_DEVICES"
+	// SimStateEnv is the file the simulated light state is persisted to
+	SimStateEnv = "LLGD_SIM_STATE"
+)
+
+// defaultSimDevices is used when SimDevicesEnv is not set
+const defaultSimDevices = "glow:SIMGLOW0001,beam:SIMBEAM0001"
+
+// SimulatedDevice describes a light provided by the Simulator
+type SimulatedDevice struct {
+	ProductID uint16
+	Serial    string
+	Port      string // USB port, e.g. 1-2.3, empty for none
+}
+
+// path returns the HID path of a simulated light. Lights on a USB port get a path like those of the
+// libusb backend of hidapi, which starts with the port.
+func (d SimulatedDevice) path() string {
+	if d.Port != "" {
+		return d.Port + ":1.0"
+	}
+	return "sim:" + d.Serial
+}
+
+// stateKey returns the key of the persisted state of a simulated light
+func (d SimulatedDevice) stateKey() string {
+	if d.Port != "" {
+		return d.Serial + "@" + d.Port
+	}
+	return d.Serial
+}
+
+// simulatedState is the persisted state of one simulated light
+type simulatedState struct {
+	Power       byte   `json:"power"`
+	Brightness  uint16 `json:"brightness"` // raw value within the brightness range of the product
+	Temperature uint16 `json:"temperature"`
+
+	// Back light of models that have one
+	BackPower      byte     `json:"back_power,omitempty"`
+	BackBrightness byte     `json:"back_brightness,omitempty"`
+	BackColors     []string `json:"back_colors,omitempty"` // #rrggbb color of each zone
+}
+
+// Simulator is a software Litra backend implementing HIDEnumerator and HIDOpener. Simulated devices
+// decode the commands written to them, keep their power, brightness, temperature and back light
+// colors, and answer state queries. The state is saved to a file after every change so it survives between processes,
+// which lets lcli commands build on each other just like with real lights.
+type Simulator struct {
+	mu        sync.Mutex
+	devices   []SimulatedDevice
+	statePath string
+}
+
+// NewSimulator returns a simulator providing the given devices, persisting their state to statePath
+func NewSimulator(devices []SimulatedDevice, statePath string) *Simulator {
+	return &Simulator{devices: devices, statePath: statePath}
+}
+
+// NewSimulatorFromEnv returns a simulator configured by SimDevicesEnv and SimStateEnv. The state
+// is kept in llgd-sim.json in the temp directory unless SimStateEnv says otherwise.
+func NewSimulatorFromEnv() (*Simulator, error) {
+	spec := os.Getenv(SimDevicesEnv)
+	if spec == "" {
+		spec = defaultSimDevices
+	}
+	devices, err := parseSimDevices(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	statePath := os.Getenv(SimStateEnv)
+	if statePath == "" {
+		statePath = filepath.Join(os.TempDir(), "llgd-sim.json")
+	}
+	return NewSimulator(devices, statePath), nil
+}
+
+// parseSimDevices parses a list of model:serial pairs, each optionally followed by @port
+func parseSimDevices(spec string) ([]SimulatedDevice, error) {
+	var devices []SimulatedDevice
+	for _, entry := range strings.Split(spec, ",") {
+		model, serial, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		serial, port, hasPort := strings.Cut(serial, "@")
+		if !ok || (serial == "" && port == "") || (hasPort && !usbPortPattern.MatchString(port)) {
+			return nil, fmt.Errorf("invalid simulated device %q, expected model:serial or model:serial@port", entry)
+		}
+		product, ok := lookupProductByName(model)
+		if !ok {
+			return nil, fmt.Errorf("invalid simulated device %q: unknown model %s", entry, model)
+		}
+		devices = append(devices, SimulatedDevice{ProductID: product.ProductID, Serial: serial, Port: port})
+	}
+	return devices, nil
+}
+
+// Enumerate implements HIDEnumerator
+func (s *Simulator) Enumerate(vendorID uint16, productID uint16, enumerationCallback func(*HIDDeviceInfo) error) error {
+	if vendorID != VendorId {
+		return nil
+	}
+	for _, d := range s.devices {
+		if d.ProductID != productID {
+			continue
+		}
+		info := &HIDDeviceInfo{
+			Path:       d.path(),
+			VendorID:   VendorId,
+			ProductID:  d.ProductID,
+			SerialNbr:  d.Serial,
+			MfrStr:     "Logitech (simulated)",
+			ProductStr: "Litra",
+		}
+		if err := enumerationCallback(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open implements HIDOpener, opening the first simulated light with the given IDs and serial number
+func (s *Simulator) Open(vendorID uint16, productID uint16, serialNumber string) (HIDDevice, error) {
+	for _, d := range s.devices {
+		if vendorID == VendorId && d.ProductID == productID && d.Serial == serialNumber {
+			return s.open(d), nil
+		}
+	}
+	return nil, fmt.Errorf("no simulated device %04x:%04x with serial %s", vendorID, productID, serialNumber)
+}
+
+// OpenPath implements HIDPathOpener
+func (s *Simulator) OpenPath(path string) (HIDDevice, error) {
+	for _, d := range s.devices {
+		if d.path() == path {
+			return s.open(d), nil
+		}
+	}
+	return nil, fmt.Errorf("no simulated device at %s", path)
+}
+
+// open returns a handle on a simulated light
+func (s *Simulator) open(d SimulatedDevice) HIDDevice {
+	product, _ := LookupProduct(d.ProductID)
+	return &simulatedDevice{simulator: s, key: d.stateKey(), product: product}
+}
+
+// loadState reads the state of all simulated lights. Must be called with s.mu held.
+func (s *Simulator) loadState() (map[string]simulatedState, error) {
+	states := make(map[string]simulatedState)
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &states); err != nil {
+			return nil, fmt.Errorf("invalid simulator state file %s: %v", s.statePath, err)
+		}
+	}
+	return states, nil
+}
+
+// saveState writes the state of all simulated lights. Must be called with s.mu held.
+func (s *Simulator) saveState(states map[string]simulatedState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath, data, 0o644)
+}
+
+// simulatedDevice is an open handle on a simulated light
+type simulatedDevice struct {
+	simulator *Simulator
+	key       string // key of the persisted state
+	product   Product
+	responses [][]byte
+	colors    map[byte]Color // zone colors waiting for CommitColors
+	closed    bool
+}
+
+// simulatedFeatures lists the HID++ 2.0 features of a simulated light of the model by index,
+// matching the layout of real Litra lights
+func simulatedFeatures(product Product) []protocol.FeatureID {
+	return product.featureLayout()
+}
+
+// simulatedFirmware is the firmware reported by simulated lights
+var simulatedFirmware = protocol.GetFirmwareInfo{Type: protocol.FirmwareTypeApplication, Prefix: "SIM", Number: 0x01, Build: 0x0001}
+
+// HID++ 2.0 error codes returned by simulated lights
+const (
+	simErrorOutOfRange          = 0x03
+	simErrorInvalidFeatureIndex = 0x06
+	simErrorInvalidFunction     = 0x07
+)
+
+// Write implements HIDDevice. Set commands update the persisted state, while get commands and feature
+// discovery queue a response for ReadWithTimeout. Requests the light would not understand queue an
+// error report.
+func (d *simulatedDevice) Write(data []byte) (int, error) {
+	if d.closed {
+		return 0, errors.New("simulated device is closed")
+	}
+	header, function, err := protocol.DecodeHeader(data)
+	if err != nil {
+		return 0, fmt.Errorf("simulated device: %w", err)
+	}
+	features := simulatedFeatures(d.product)
+	if header.DeviceIndex != hidppDeviceIndex || int(header.FeatureIndex) >= len(features) {
+		d.responses = append(d.responses, protocol.EncodeError(header, function, simErrorInvalidFeatureIndex))
+		return len(data), nil
+	}
+	_, cmd, err := protocol.DecodeRequest(features[header.FeatureIndex], data)
+	if err != nil {
+		d.responses = append(d.responses, protocol.EncodeError(header, function, simErrorInvalidFunction))
+		return len(data), nil
+	}
+
+	switch cmd := cmd.(type) {
+	case protocol.GetFeature:
+		for index, id := range features {
+			if id == cmd.ID {
+				cmd.Index = byte(index)
+			}
+		}
+		d.responses = append(d.responses, protocol.EncodeResponse(header, cmd))
+		return len(data), nil
+	case protocol.GetFeatureCount:
+		cmd.Count = byte(len(features) - 1)
+		d.responses = append(d.responses, protocol.EncodeResponse(header, cmd))
+		return len(data), nil
+	case protocol.GetFeatureID:
+		if int(cmd.Index) >= len(features) {
+			d.responses = append(d.responses, protocol.EncodeError(header, function, simErrorOutOfRange))
+			return len(data), nil
+		}
+		cmd.ID = features[cmd.Index]
+		d.responses = append(d.responses, protocol.EncodeResponse(header, cmd))
+		return len(data), nil
+	case protocol.GetDeviceInfo:
+		d.responses = append(d.responses, protocol.EncodeResponse(header, protocol.GetDeviceInfo{EntityCount: 1}))
+		return len(data), nil
+	case protocol.GetFirmwareInfo:
+		if cmd.Entity != 0 {
+			d.responses = append(d.responses, protocol.EncodeError(header, function, simErrorOutOfRange))
+			return len(data), nil
+		}
+		d.responses = append(d.responses, protocol.EncodeResponse(header, simulatedFirmware))
+		return len(data), nil
+	case protocol.GetBrightnessInfo:
+		brightness := d.product.Brightness
+		d.responses = append(d.responses, protocol.EncodeResponse(header,
+			protocol.GetBrightnessInfo{Min: uint16(brightness.Min), Max: uint16(brightness.Max)}))
+		return len(data), nil
+	case protocol.GetTemperatureInfo:
+		temperature := d.product.Temperature
+		d.responses = append(d.responses, protocol.EncodeResponse(header,
+			protocol.GetTemperatureInfo{Min: uint16(temperature.Min), Max: uint16(temperature.Max)}))
+		return len(data), nil
+	case protocol.SetZoneColor:
+		if cmd.Zone == 0 || int(cmd.Zone) > d.product.BackLightZones {
+			d.responses = append(d.responses, protocol.EncodeError(header, function, simErrorOutOfRange))
+			return len(data), nil
+		}
+		if d.colors == nil {
+			d.colors = make(map[byte]Color)
+		}
+		d.colors[cmd.Zone] = Color{Red: cmd.Red, Green: cmd.Green, Blue: cmd.Blue}
+		return len(data), nil
+	}
+
+	d.simulator.mu.Lock()
+	defer d.simulator.mu.Unlock()
+
+	states, err := d.simulator.loadState()
+	if err != nil {
+		return 0, err
+	}
+	state, ok := states[d.key]
+	if !ok {
+		state = simulatedState{Brightness: uint16(d.product.Brightness.Min), Temperature: 4000}
+	}
+
+	switch cmd := cmd.(type) {
+	case protocol.SetPower:
+		state.Power = 0
+		if cmd.On {
+			state.Power = 1
+		}
+	case protocol.SetBrightness:
+		state.Brightness = uint16(min(max(int(cmd.Raw), d.product.Brightness.Min), d.product.Brightness.Max))
+	case protocol.SetTemperature:
+		state.Temperature = uint16(min(max(int(cmd.Kelvin), d.product.Temperature.Min), d.product.Temperature.Max))
+	case protocol.SetBackPower:
+		state.BackPower = 0
+		if cmd.On {
+			state.BackPower = 1
+		}
+	case protocol.SetBackBrightness:
+		state.BackBrightness = min(max(cmd.Percent, 1), 100)
+	case protocol.CommitColors:
+		for len(state.BackColors) < d.product.BackLightZones {
+			state.BackColors = append(state.BackColors, Color{}.String())
+		}
+		for zone, color := range d.colors {
+			state.BackColors[zone-1] = color.String()
+		}
+		d.colors = nil
+	case protocol.GetPower:
+		d.responses = append(d.responses, protocol.EncodeResponse(header, protocol.GetPower{On: state.Power == 1}))
+		return len(data), nil
+	case protocol.GetBrightness:
+		d.responses = append(d.responses, protocol.EncodeResponse(header, protocol.GetBrightness{Raw: state.Brightness}))
+		return len(data), nil
+	case protocol.GetTemperature:
+		d.responses = append(d.responses, protocol.EncodeResponse(header, protocol.GetTemperature{Kelvin: state.Temperature}))
+		return len(data), nil
+	}
+
+	states[d.key] = state
+	if err := d.simulator.saveState(states); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ReadWithTimeout implements HIDDevice, returning queued responses or a timeout straight away
+func (d *simulatedDevice) ReadWithTimeout(data []byte, timeout time.Duration) (int, error) {
+	if d.closed {
+		return 0, errors.New("simulated device is closed")
+	}
+	if len(d.responses) == 0 {
+		return 0, errReadTimeout
+	}
+	n := copy(data, d.responses[0])
+	d.responses = d.responses[1:]
+	return n, nil
+}
+
+// Close implements HIDDevice
+func (d *simulatedDevice) Close() error {
+	d.closed = true
+	return nil
+}
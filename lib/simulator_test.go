@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// setupSimulatorTest makes the simulator the backend, with its state in a temp directory
+func setupSimulatorTest(t *testing.T, devices string) (string, func()) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	originalHIDOpener := defaultHIDOpener
+	originalConfigUpdater := defaultConfigUpdater
+
+	statePath := filepath.Join(t.TempDir(), "sim.json")
+	t.Setenv(SimDevicesEnv, devices)
+	t.Setenv(SimStateEnv, statePath)
+
+	mockConfigUpdater := new(MockConfigUpdater)
+	mockConfigUpdater.On("UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	mockConfigUpdater.On("MigrateDeviceSections", mock.Anything).Maybe()
+	mockConfigUpdater.On("MigrateDeviceIdentities", mock.Anything).Maybe()
+	mockConfigUpdater.On("ReadCurve", mock.Anything).Return("").Maybe()
+	mockConfigUpdater.On("ReadCalibration", mock.Anything).Return(map[string]string{}).Maybe()
+	defaultConfigUpdater = mockConfigUpdater
+	defaultController = nil
+
+	assert.NoError(t, UseBackend("sim"))
+
+	return statePath, func() {
+		Close()
+		defaultHIDEnumerator = originalHIDEnumerator
+		defaultHIDOpener = originalHIDOpener
+		defaultConfigUpdater = originalConfigUpdater
+	}
+}
+
+// Test commands sent to the simulator are reflected by state queries
+func TestSimulatorEndToEnd(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1,beam:SIM2")
+	defer cleanup()
+
+	devices, err := ListDevices()
+	assert.NoError(t, err)
+	assert.Equal(t, []DiscoveredDevice{
+		{Index: 1, Name: "Glow", Serial: "SIM1", ID: "SIM1", ProductID: 0xc900, Path: "sim:SIM1"},
+		{Index: 2, Name: "Beam", Serial: "SIM2", ID: "SIM2", ProductID: 0xc901, Path: "sim:SIM2"},
+	}, devices)
+
+	assert.NoError(t, LightOn(2))
+	assert.NoError(t, LightBrightness(2, 60))
+	assert.NoError(t, LightTemperature(2, 5000))
+	assert.NoError(t, LightTempUp(2, 200))
+
+	state, err := QueryState(2)
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceState{Power: 1, Brightness: 60, Temperature: 5200, Lumens: 252}, state)
+
+	// The other light is untouched
+	state, err = QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceState{Power: 0, Brightness: 0, Temperature: 4000, Lumens: 20}, state)
+}
+
+// Test the simulated state is persisted and shared between simulator instances
+func TestSimulatorPersistsState(t *testing.T) {
+	statePath, cleanup := setupSimulatorTest(t, "beam:SIM2")
+	defer cleanup()
+
+	assert.NoError(t, LightBrightness(0, 25))
+
+	simulator := NewSimulator([]SimulatedDevice{{ProductID: 0xc901, Serial: "SIM2"}}, statePath)
+	device, err := simulator.Open(VendorId, 0xc901, "SIM2")
+	assert.NoError(t, err)
+	defer device.Close()
+
+	_, err = device.Write(protocol.Encode(protocol.GetBrightness{}))
+	assert.NoError(t, err)
+	response := make([]byte, 20)
+	n, err := device.ReadWithTimeout(response, queryTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, n)
+	_, decoded, err := protocol.Decode(response[:n])
+	assert.NoError(t, err)
+	beam, _ := LookupProduct(BeamProductID)
+	assert.Equal(t, 25, beam.brightnessLevel(decoded.(protocol.GetBrightness).Raw, nil))
+}
+
+// Test invalid simulator and backend configurations are rejected
+func TestSimulatorConfiguration(t *testing.T) {
+	devices, err := parseSimDevices("Glow:A, beam:B")
+	assert.NoError(t, err)
+	assert.Equal(t, []SimulatedDevice{{ProductID: 0xc900, Serial: "A"}, {ProductID: 0xc901, Serial: "B"}}, devices)
+
+	devices, err = parseSimDevices("glow:@1-2,beam:B@1-3.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []SimulatedDevice{{ProductID: 0xc900, Port: "1-2"}, {ProductID: 0xc901, Serial: "B", Port: "1-3.1"}}, devices)
+
+	_, err = parseSimDevices("glow")
+	assert.Error(t, err)
+	_, err = parseSimDevices("glow:")
+	assert.Error(t, err)
+	_, err = parseSimDevices("glow:A@desk")
+	assert.Error(t, err)
+	_, err = parseSimDevices("lamp:C")
+	assert.Error(t, err)
+
+	assert.Error(t, UseBackend("bluetooth"))
+
+	simulator := NewSimulator(devices, filepath.Join(t.TempDir(), "sim.json"))
+	_, err = simulator.Open(VendorId, 0xc900, "B")
+	assert.Error(t, err)
+}
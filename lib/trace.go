@@ -0,0 +1,292 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+// TraceEnv names a file every packet written to or read from the lights is appended to, as JSON lines
+const TraceEnv = "LLGD_TRACE"
+
+// Directions of traced packets
+const (
+	TraceWrite = "write"
+	TraceRead  = "read"
+)
+
+// TraceRecord is a packet written to or read from a light, as recorded in a trace
+type TraceRecord struct {
+	Time      time.Time `json:"time"`
+	Serial    string    `json:"serial"`
+	Port      string    `json:"port,omitempty"`
+	Name      string    `json:"name"`
+	Direction string    `json:"direction"`         // TraceWrite or TraceRead
+	Data      string    `json:"data"`              // the packet in hex
+	Decoded   string    `json:"decoded,omitempty"` // the meaning of the packet, when known
+	Error     string    `json:"error,omitempty"`   // why the write or read failed
+}
+
+// Tracer records the packets written to and read from the lights. A Tracer is safe for concurrent use.
+type Tracer struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewTracer returns a tracer writing a TraceRecord per line to w
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{writer: w}
+}
+
+// record writes a record, logging failures rather than failing the packet that was traced
+func (t *Tracer) record(record TraceRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Warn().Msgf("Failed to trace a packet: %v", err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.writer.Write(append(line, '\n')); err != nil {
+		log.Warn().Msgf("Failed to trace a packet: %v", err)
+	}
+}
+
+// wrap returns a device recording its packets to the tracer
+func (t *Tracer) wrap(device HIDDevice, metadata DiscoveredDevice) HIDDevice {
+	return &tracedDevice{HIDDevice: device, tracer: t, metadata: metadata}
+}
+
+// defaultTracer traces the devices opened by every controller, nil when tracing is off
+var defaultTracer *Tracer
+
+func init() {
+	path := os.Getenv(TraceEnv)
+	if path == "" {
+		return
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Error().Msgf("Ignoring %s: %v", TraceEnv, err)
+		return
+	}
+	defaultTracer = NewTracer(file)
+}
+
+// SetTracer records the packets of every device opened from now on to t, or stops tracing if t is
+// nil. Devices held open by the package-level functions are released first.
+func SetTracer(t *Tracer) {
+	Close()
+	defaultTracer = t
+}
+
+// tracedDevice is a HIDDevice recording its packets. Feature indices differ between lights, so it
+// follows the GetFeature and GetFeatureID exchanges to learn which feature each index addresses.
+type tracedDevice struct {
+	HIDDevice
+	tracer   *Tracer
+	metadata DiscoveredDevice
+
+	mu       sync.Mutex
+	features map[byte]protocol.FeatureID
+	pending  protocol.FeatureID // feature asked for by the last GetFeature request
+}
+
+func (d *tracedDevice) Write(data []byte) (int, error) {
+	n, err := d.HIDDevice.Write(data)
+	d.trace(TraceWrite, data, err)
+	return n, err
+}
+
+func (d *tracedDevice) ReadWithTimeout(data []byte, timeout time.Duration) (int, error) {
+	n, err := d.HIDDevice.ReadWithTimeout(data, timeout)
+	if errors.Is(err, errReadTimeout) {
+		return n, err
+	}
+	d.trace(TraceRead, data[:n], err)
+	return n, err
+}
+
+// trace records a packet
+func (d *tracedDevice) trace(direction string, data []byte, err error) {
+	record := TraceRecord{
+		Time:      time.Now(),
+		Serial:    d.metadata.Serial,
+		Port:      d.metadata.Port,
+		Name:      d.metadata.Name,
+		Direction: direction,
+		Data:      hex.EncodeToString(data),
+		Decoded:   d.decode(direction, data),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	d.tracer.record(record)
+}
+
+// decode describes a packet, learning feature indices from the exchanges that look them up.
+// Packets addressed to an index whose feature is not known yet are left undescribed.
+func (d *tracedDevice) decode(direction string, data []byte) string {
+	if deviceErr, ok := protocol.DecodeError(data); ok {
+		return deviceErr.Error()
+	}
+	if len(data) < 3 {
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	feature, ok := protocol.RootFeature, data[2] == protocol.RootFeatureIndex
+	if !ok {
+		feature, ok = d.features[data[2]]
+	}
+	if !ok {
+		return ""
+	}
+
+	var cmd protocol.Command
+	var err error
+	if direction == TraceWrite {
+		_, cmd, err = protocol.DecodeRequest(feature, data)
+	} else {
+		_, cmd, err = protocol.DecodeFeature(feature, data)
+	}
+	if err != nil {
+		return ""
+	}
+
+	if d.features == nil {
+		d.features = make(map[byte]protocol.FeatureID)
+	}
+	switch cmd := cmd.(type) {
+	case protocol.GetFeature:
+		if direction == TraceWrite {
+			d.pending = cmd.ID
+			break
+		}
+		cmd.ID = d.pending
+		if cmd.Index != 0 {
+			d.features[cmd.Index] = cmd.ID
+		}
+		return cmd.String()
+	case protocol.GetFeatureID:
+		if direction == TraceRead {
+			d.features[cmd.Index] = cmd.ID
+		}
+	}
+	return cmd.String()
+}
+
+// ReadTrace reads the records of a trace written by a Tracer
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record TraceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, err := hex.DecodeString(record.Data); err != nil {
+			return nil, fmt.Errorf("line %d: invalid data %q", line, record.Data)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Replay re-sends the packets written in a trace using the default controller. See Controller.Replay.
+func Replay(ctx context.Context, records []TraceRecord, deviceIndex int, speed float64) error {
+	return getDefaultController().Replay(ctx, records, deviceIndex, speed)
+}
+
+// Replay re-sends the packets written in a trace, skipping those read from the lights and those that
+// failed. Each packet goes to the light it was recorded for, found by serial number and port, or to
+// the light at deviceIndex if it is not 0. The time between packets is the recorded time divided by
+// speed, with a speed of 0 sending them without waiting. When ctx is cancelled the replay stops and
+// ctx.Err() is returned.
+func (c *Controller) Replay(ctx context.Context, records []TraceRecord, deviceIndex int, speed float64) error {
+	var writes []TraceRecord
+	for _, record := range records {
+		if record.Direction == TraceWrite && record.Error == "" {
+			writes = append(writes, record)
+		}
+	}
+
+	// Check every light of the trace is connected before sending anything
+	c.mu.Lock()
+	targets := make([]*discoveredDeviceInternal, len(writes))
+	var err error
+	for i, record := range writes {
+		if targets[i], err = c.replayTarget(record, deviceIndex); err != nil {
+			break
+		}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range writes {
+		if i > 0 && speed > 0 {
+			wait := time.Duration(float64(record.Time.Sub(writes[i-1].Time)) / speed)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, _ := hex.DecodeString(record.Data)
+		c.mu.Lock()
+		_, err := c.write(targets[i], data)
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayTarget returns the light to send a traced packet to. Must be called with c.mu held.
+func (c *Controller) replayTarget(record TraceRecord, deviceIndex int) (*discoveredDeviceInternal, error) {
+	if deviceIndex != 0 {
+		devices, err := c.targets(deviceIndex)
+		if err != nil {
+			return nil, err
+		}
+		return devices[0], nil
+	}
+
+	var match *discoveredDeviceInternal
+	for _, d := range c.devices {
+		if d.metadata.Serial != record.Serial || (record.Port != "" && d.metadata.Port != record.Port) {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("%w: serial number %q of the trace is shared by several devices", ErrAmbiguousDevice, record.Serial)
+		}
+		match = d
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%w: Litra %s (serial: %s) of the trace is not connected", ErrDeviceNotFound, record.Name, record.Serial)
+	}
+	return match, nil
+}
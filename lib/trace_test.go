@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kharyam/go-litra-driver/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the packets written to and read from a light are traced and decoded
+func TestTracerRecordsPackets(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "beam:SIM2@1-2")
+	defer cleanup()
+
+	var trace bytes.Buffer
+	SetTracer(NewTracer(&trace))
+	defer SetTracer(nil)
+
+	assert.NoError(t, LightOn(1))
+	_, err := QueryState(1)
+	assert.NoError(t, err)
+
+	records, err := ReadTrace(&trace)
+	assert.NoError(t, err)
+	var decoded []string
+	for _, record := range records {
+		assert.Equal(t, "SIM2", record.Serial)
+		assert.Equal(t, "1-2", record.Port)
+		assert.Equal(t, "Beam", record.Name)
+		decoded = append(decoded, record.Direction+" "+record.Decoded)
+	}
+	assert.Equal(t, []string{
+		"write GetFeature(id=0x1990, index=0, version=0)",
+		"read GetFeature(id=0x1990, index=4, version=0)",
+		"write SetPower(on=true)",
+		"write GetPower(on=false)",
+		"read GetPower(on=true)",
+		"write GetBrightness(raw=0)",
+		"read GetBrightness(raw=30)",
+		"write GetTemperature(kelvin=0)",
+		"read GetTemperature(kelvin=4000)",
+	}, decoded)
+	assert.Equal(t, hex.EncodeToString(protocol.Encode(protocol.SetPower{On: true})), records[2].Data)
+}
+
+// Test a recorded session sets a light to the same state when it is replayed
+func TestReplay(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "glow:SIM1,beam:SIM2")
+	defer cleanup()
+
+	var trace bytes.Buffer
+	SetTracer(NewTracer(&trace))
+	assert.NoError(t, LightOn(2))
+	assert.NoError(t, LightBrightness(2, 60))
+	assert.NoError(t, LightTemperature(2, 5000))
+	SetTracer(nil)
+	records, err := ReadTrace(&trace)
+	assert.NoError(t, err)
+
+	// Replay on fresh lights, once to the light of the trace and once redirected to another light
+	t.Setenv(SimStateEnv, filepath.Join(t.TempDir(), "replay.json"))
+	assert.NoError(t, UseBackend("sim"))
+	assert.NoError(t, Replay(context.Background(), records, 0, 0))
+	state, err := QueryState(2)
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceState{Power: 1, Brightness: 60, Temperature: 5000, Lumens: 252}, state)
+	state, err = QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, state.Power)
+
+	assert.NoError(t, Replay(context.Background(), records, 1, 0))
+	state, err = QueryState(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.Power)
+}
+
+// Test the time between replayed packets follows the trace, scaled by the speed
+func TestReplayTiming(t *testing.T) {
+	_, cleanup := setupSimulatorTest(t, "beam:SIM2")
+	defer cleanup()
+
+	start := time.Now()
+	records := []TraceRecord{
+		{Time: start, Serial: "SIM2", Direction: TraceWrite, Data: hex.EncodeToString(protocol.Encode(protocol.SetPower{On: true}))},
+		{Time: start.Add(100 * time.Millisecond), Serial: "SIM2", Direction: TraceRead, Data: "00"},
+		{Time: start.Add(200 * time.Millisecond), Serial: "SIM2", Direction: TraceWrite, Data: hex.EncodeToString(protocol.Encode(protocol.SetPower{On: false}))},
+	}
+
+	began := time.Now()
+	assert.NoError(t, Replay(context.Background(), records, 0, 4))
+	elapsed := time.Since(began)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	assert.Less(t, elapsed, 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Replay(ctx, records, 0, 1), context.Canceled)
+
+	records[0].Serial = "SIM9"
+	assert.ErrorIs(t, Replay(context.Background(), records, 0, 0), ErrDeviceNotFound)
+}
+
+// Test traces are read line by line, rejecting invalid records
+func TestReadTrace(t *testing.T) {
+	records, err := ReadTrace(strings.NewReader(`{"time":"2026-01-02T03:04:05Z","serial":"A","name":"Glow","direction":"write","data":"11ff041c01"}
+
+{"time":"2026-01-02T03:04:06Z","serial":"A","name":"Glow","direction":"read","data":"11ff041c01"}
+`))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, TraceRead, records[1].Direction)
+
+	_, err = ReadTrace(strings.NewReader("{\"data\":\"11\"}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+	_, err = ReadTrace(strings.NewReader(`{"data":"xyz"}`))
+	assert.ErrorContains(t, err, "invalid data")
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Easing maps the elapsed fraction of a transition (0 to 1) to the fraction of the change applied
+type Easing func(progress float64) float64
+
+// Linear changes the light at a constant rate
+func Linear(progress float64) float64 {
+	return progress
+}
+
+// EaseInOut starts and ends the change slowly, which looks more natural on camera
+func EaseInOut(progress float64) float64 {
+	return (1 - math.Cos(math.Pi*progress)) / 2
+}
+
+// easings maps the names accepted by EasingByName to their curves
+var easings = map[string]Easing{
+	"linear":      Linear,
+	"ease-in-out": EaseInOut,
+}
+
+// EasingByName returns the easing curve with the given name ("linear" or "ease-in-out")
+func EasingByName(name string) (Easing, error) {
+	easing, ok := easings[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown easing %q, expected linear or ease-in-out", name)
+	}
+	return easing, nil
+}
+
+// TransitionFrameRate is the number of times per second transitions and effects update the lights
+var TransitionFrameRate = 25
+
+// Transition gradually changes the brightness (0-100) and/or temperature (in Kelvin, clamped to the range
+// of the lights) of lights from their current state to the targets over duration, following the easing
+// curve (Linear if nil).
+// Set a target to -1 to leave it unchanged. deviceIndex 0 targets all, 1+ targets a specific device.
+func Transition(ctx context.Context, deviceIndex int, targetBrightness int, targetTemp int, duration time.Duration, easing Easing) error {
+	return getDefaultController().Transition(ctx, deviceIndex, targetBrightness, targetTemp, duration, easing)
+}
+
+// Transition gradually changes the brightness and/or temperature of lights. When ctx is cancelled
+// the lights are left at the last step written and ctx.Err() is returned. The config file is
+// updated once, with the last values written, rather than on every step.
+func (c *Controller) Transition(ctx context.Context, deviceIndex int, targetBrightness int, targetTemp int, duration time.Duration, easing Easing) error {
+	if easing == nil {
+		easing = Linear
+	}
+
+	if targetTemp != -1 {
+		limits := c.temperatureRange(deviceIndex)
+		targetTemp = min(max(targetTemp, limits.Min), limits.Max)
+	}
+	startBrightness, startTemp, _ := c.ReadCurrentState(deviceIndex)
+	brightness, temp := -1, -1
+	defer func() {
+		if brightness != -1 || temp != -1 {
+			updateCurrentState(c.stateKey(deviceIndex), brightness, temp, -1)
+		}
+	}()
+
+	// Without a known starting point, jump straight to the target
+	if startBrightness < 0 {
+		startBrightness = targetBrightness
+	}
+	if startTemp < 0 {
+		startTemp = targetTemp
+	}
+
+	steps := int(duration.Seconds() * float64(TransitionFrameRate))
+	var frames <-chan time.Time
+	if steps > 1 {
+		ticker := time.NewTicker(duration / time.Duration(steps))
+		defer ticker.Stop()
+		frames = ticker.C
+	} else {
+		steps = 1
+	}
+
+	for step := 1; step <= steps; step++ {
+		if frames != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-frames:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		progress := easing(float64(step) / float64(steps))
+		if targetBrightness != -1 {
+			next := interpolate(startBrightness, targetBrightness, progress)
+			if next != brightness {
+				if err := c.command(brightnessCommand(next), deviceIndex); err != nil {
+					return err
+				}
+				brightness = next
+			}
+		}
+		if targetTemp != -1 {
+			next := interpolate(startTemp, targetTemp, progress)
+			if next != temp {
+				if err := c.command(temperatureCommand(uint16(next)), deviceIndex); err != nil {
+					return err
+				}
+				temp = next
+			}
+		}
+	}
+	return nil
+}
+
+// interpolate returns the value the fraction progress of the way from start to end
+func interpolate(start int, end int, progress float64) int {
+	return start + int(math.Round(float64(end-start)*progress))
+}
@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test Transition steps brightness and temperature towards the targets and saves the final state once
+func TestTransition(t *testing.T) {
+	mockDevice1, mockDevice2, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	originalFrameRate := TransitionFrameRate
+	TransitionFrameRate = 100
+	defer func() { TransitionFrameRate = originalFrameRate }()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 1, Brightness: 20, Temperature: 3000}, nil
+	}
+
+	for _, step := range []struct{ brightness, temp int }{{30, 3500}, {40, 4000}, {50, 4500}, {60, 5000}} {
+		mockDevice1.On("Write", commandBytes(brightnessCommand(step.brightness), BeamProductID)).Return(20, nil).Once()
+		mockDevice1.On("Write", commandBytes(temperatureCommand(uint16(step.temp)), BeamProductID)).Return(20, nil).Once()
+	}
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", 60, 5000, -1).Once()
+
+	err := Transition(context.Background(), 1, 60, 5000, 40*time.Millisecond, Linear)
+
+	assert.NoError(t, err)
+	mockDevice1.AssertExpectations(t)
+	mockDevice2.AssertNotCalled(t, "Write", mock.Anything)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test a zero duration transition jumps to the target, leaving unset values alone
+func TestTransitionImmediate(t *testing.T) {
+	mockDevice1, _, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	mockConfigUpdater.On("ReadCurrentState", "test-serial-Beam").Return(-1, -1, -1).Once()
+	mockDevice1.On("Write", commandBytes(brightnessCommand(80), BeamProductID)).Return(20, nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", 80, -1, -1).Once()
+
+	assert.NoError(t, Transition(context.Background(), 1, 80, -1, 0, nil))
+
+	mockDevice1.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test a target temperature outside the range of the lights is clamped, including in the saved state
+func TestTransitionTemperatureClamped(t *testing.T) {
+	mockDevice1, _, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	mockConfigUpdater.On("ReadCurrentState", "test-serial-Beam").Return(-1, -1, -1).Once()
+	mockDevice1.On("Write", commandBytes(temperatureCommand(6500), BeamProductID)).Return(20, nil).Once()
+	mockConfigUpdater.On("UpdateCurrentState", "test-serial-Beam", -1, 6500, -1).Once()
+
+	assert.NoError(t, Transition(context.Background(), 1, -1, 9000, 0, nil))
+
+	mockDevice1.AssertExpectations(t)
+	mockConfigUpdater.AssertExpectations(t)
+}
+
+// Test a cancelled transition stops without writing
+func TestTransitionCancelled(t *testing.T) {
+	mockDevice1, _, _, _, mockConfigUpdater, cleanup := setupTest()
+	defer cleanup()
+
+	queryStateFunc = func(c *Controller, deviceIndex int) (DeviceState, error) {
+		return DeviceState{Power: 1, Brightness: 20, Temperature: 3000}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Transition(ctx, 1, 60, 5000, time.Second, EaseInOut)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	mockDevice1.AssertNotCalled(t, "Write", mock.Anything)
+	mockConfigUpdater.AssertNotCalled(t, "UpdateCurrentState", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test the easing curves and their lookup by name
+func TestEasing(t *testing.T) {
+	for _, easing := range []Easing{Linear, EaseInOut} {
+		assert.InDelta(t, 0, easing(0), 1e-9)
+		assert.InDelta(t, 0.5, easing(0.5), 1e-9)
+		assert.InDelta(t, 1, easing(1), 1e-9)
+	}
+	assert.Less(t, EaseInOut(0.25), Linear(0.25))
+
+	easing, err := EasingByName("Ease-In-Out")
+	assert.NoError(t, err)
+	assert.InDelta(t, EaseInOut(0.3), easing(0.3), 1e-9)
+	_, err = EasingByName("bounce")
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"context"
+	"time"
+)
+
+// DeviceEventType identifies whether a device was connected or disconnected
+type DeviceEventType int
+
+const (
+	// DeviceAdded is reported when a Litra device is connected
+	DeviceAdded DeviceEventType = iota
+	// DeviceRemoved is reported when a Litra device is disconnected
+	DeviceRemoved
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case DeviceAdded:
+		return "added"
+	case DeviceRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// DeviceEvent reports a device being connected or disconnected. For added devices, Device carries
+// the metadata of the new enumeration; for removed devices, the metadata it was last seen with.
+type DeviceEvent struct {
+	Type   DeviceEventType
+	Device DiscoveredDevice
+}
+
+// watchInterval is how often Watch enumerates the connected devices
+var watchInterval = 2 * time.Second
+
+// Watch monitors Litra devices being connected and disconnected until ctx is cancelled, at which
+// point the returned channel is closed. Devices are detected by periodically enumerating with the
+// HID enumerator and comparing serial numbers and locations; devices already connected when Watch is called
+// do not produce events. Watch does not open devices, so it can run alongside a Controller,
+// which should be refreshed when events arrive.
+func Watch(ctx context.Context) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+	previous := enumerateDevices()
+
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := enumerateDevices()
+			for _, event := range diffDevices(previous, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+
+	return events
+}
+
+// diffDevices returns the events that turn the previous device list into the current one.
+// Removals are reported before additions, each in index order. Lights are matched by serial number
+// and location rather than by identity, since the identity of a light changes when another light with
+// the same serial number is plugged in, and lights matching the same way are counted.
+func diffDevices(previous []DiscoveredDevice, current []DiscoveredDevice) []DeviceEvent {
+	key := func(d DiscoveredDevice) string {
+		return d.Serial + "@" + d.location()
+	}
+	unmatched := func(devices []DiscoveredDevice, others []DiscoveredDevice) []DiscoveredDevice {
+		counts := make(map[string]int, len(others))
+		for _, d := range others {
+			counts[key(d)]++
+		}
+		var left []DiscoveredDevice
+		for _, d := range devices {
+			if counts[key(d)] > 0 {
+				counts[key(d)]--
+				continue
+			}
+			left = append(left, d)
+		}
+		return left
+	}
+
+	var events []DeviceEvent
+	for _, d := range unmatched(previous, current) {
+		events = append(events, DeviceEvent{Type: DeviceRemoved, Device: d})
+	}
+	for _, d := range unmatched(current, previous) {
+		events = append(events, DeviceEvent{Type: DeviceAdded, Device: d})
+	}
+	return events
+}
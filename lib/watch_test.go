@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeBus drives a mock enumerator with a set of connected devices that tests can change
+type fakeBus struct {
+	mu      sync.Mutex
+	devices map[string]uint16 // serial -> product ID
+}
+
+func (b *fakeBus) set(devices map[string]uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices = devices
+}
+
+// setupWatchTest replaces the default enumerator with one backed by a fakeBus
+func setupWatchTest(initial map[string]uint16) (*fakeBus, func()) {
+	originalHIDEnumerator := defaultHIDEnumerator
+	originalWatchInterval := watchInterval
+
+	bus := &fakeBus{devices: initial}
+	mockEnumerator := new(MockHIDEnumerator)
+	mockEnumerator.On("Enumerate", uint16(VendorId), mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) {
+			productID := args.Get(1).(uint16)
+			callback := args.Get(2).(func(*HIDDeviceInfo) error)
+			bus.mu.Lock()
+			defer bus.mu.Unlock()
+			for serial, pid := range bus.devices {
+				if pid == productID {
+					callback(&HIDDeviceInfo{VendorID: VendorId, ProductID: pid, SerialNbr: serial})
+				}
+			}
+		})
+
+	defaultHIDEnumerator = mockEnumerator
+	watchInterval = 5 * time.Millisecond
+
+	return bus, func() {
+		defaultHIDEnumerator = originalHIDEnumerator
+		watchInterval = originalWatchInterval
+	}
+}
+
+// nextEvent waits for an event on the channel
+func nextEvent(t *testing.T, events <-chan DeviceEvent) DeviceEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a device event")
+		return DeviceEvent{}
+	}
+}
+
+// Test Watch reports devices being plugged in and unplugged
+func TestWatch(t *testing.T) {
+	bus, cleanup := setupWatchTest(map[string]uint16{"GLOW1": 0xc900})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := Watch(ctx)
+
+	bus.set(map[string]uint16{"GLOW1": 0xc900, "BEAM1": 0xc901})
+	event := nextEvent(t, events)
+	assert.Equal(t, DeviceAdded, event.Type)
+	assert.Equal(t, DiscoveredDevice{Index: 1, Name: "Beam", Serial: "BEAM1", ID: "BEAM1", ProductID: 0xc901}, event.Device)
+
+	bus.set(map[string]uint16{"BEAM1": 0xc901})
+	event = nextEvent(t, events)
+	assert.Equal(t, DeviceRemoved, event.Type)
+	assert.Equal(t, DiscoveredDevice{Index: 2, Name: "Glow", Serial: "GLOW1", ID: "GLOW1", ProductID: 0xc900}, event.Device)
+
+	cancel()
+	for range events {
+		// Drain until Watch closes the channel
+	}
+}
+
+// Test diffDevices reports removals before additions
+func TestDiffDevices(t *testing.T) {
+	previous := []DiscoveredDevice{
+		{Index: 1, Name: "Beam", Serial: "A"},
+		{Index: 2, Name: "Glow", Serial: "B"},
+	}
+	current := []DiscoveredDevice{
+		{Index: 1, Name: "Glow", Serial: "B"},
+		{Index: 2, Name: "Beam", Serial: "C"},
+	}
+
+	events := diffDevices(previous, current)
+
+	assert.Equal(t, []DeviceEvent{
+		{Type: DeviceRemoved, Device: previous[0]},
+		{Type: DeviceAdded, Device: current[1]},
+	}, events)
+	assert.Empty(t, diffDevices(current, current))
+	assert.Equal(t, "added", DeviceAdded.String())
+
+	// Lights sharing a serial number, or without one, are told apart by location
+	one := []DiscoveredDevice{{Index: 1, Serial: "X", ID: "X", Port: "1-1"}, {Index: 2, Serial: "", ID: "@1-3", Port: "1-3"}}
+	two := []DiscoveredDevice{
+		{Index: 1, Serial: "", ID: "@1-3", Port: "1-3"},
+		{Index: 2, Serial: "", ID: "@1-4", Port: "1-4"},
+		{Index: 3, Serial: "X", ID: "X@1-1", Port: "1-1"},
+		{Index: 4, Serial: "X", ID: "X@1-2", Port: "1-2"},
+	}
+	assert.Equal(t, []DeviceEvent{
+		{Type: DeviceAdded, Device: two[1]},
+		{Type: DeviceAdded, Device: two[3]},
+	}, diffDevices(one, two))
+	assert.Equal(t, []DeviceEvent{
+		{Type: DeviceRemoved, Device: two[1]},
+		{Type: DeviceRemoved, Device: two[3]},
+	}, diffDevices(two, one))
+
+	// Lights whose location is unknown are counted
+	same := []DiscoveredDevice{{Index: 1, Serial: "Y"}, {Index: 2, Serial: "Y"}}
+	assert.Equal(t, []DeviceEvent{{Type: DeviceRemoved, Device: same[1]}}, diffDevices(same, same[:1]))
+	assert.Equal(t, "removed", DeviceRemoved.String())
+}